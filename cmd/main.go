@@ -2,15 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/ed25519"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/peterbourgon/ff/v3/ffcli"
 
+	"github.com/lutaod/tinydock/internal/build"
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/completion"
+	"github.com/lutaod/tinydock/internal/config"
 	"github.com/lutaod/tinydock/internal/container"
+	"github.com/lutaod/tinydock/internal/metrics"
 	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/preflight"
+	"github.com/lutaod/tinydock/internal/registry"
 	"github.com/lutaod/tinydock/internal/volume"
 )
 
@@ -19,28 +32,98 @@ const appName = "tinydock"
 func main() {
 	// Handle container init process
 	if len(os.Args) > 1 && os.Args[1] == "init" {
-		if err := container.Run(); err != nil {
+		if err := container.Run(os.Args[2:]); err != nil {
 			log.Fatal(err)
 		}
 
 		return
 	}
 
+	// Handle shim supervising a detached container, given root it was run with
+	// and whether stdin of container is kept open
+	if len(os.Args) > 3 && os.Args[1] == "shim" {
+		args := os.Args[2:]
+		openStdin := args[0] == "-i"
+		if openStdin {
+			args = args[1:]
+		}
+		if len(args) < 2 {
+			log.Fatal("shim requires root directory and container ID")
+		}
+
+		if err := config.SetRoot(args[0]); err != nil {
+			log.Fatal(err)
+		}
+
+		code, err := container.RunShim(args[1], args[2:], openStdin)
+		if err != nil {
+			log.Print(err)
+		}
+		os.Exit(code)
+	}
+
+	if dir := os.Getenv(config.RootEnv); dir != "" {
+		if err := config.SetRoot(dir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Handle candidate listing of shell completion scripts
+	if len(os.Args) > 1 && os.Args[1] == completion.HelperCommand {
+		if err := listCandidates(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	rootFlagSet := flag.NewFlagSet(appName, flag.ExitOnError)
+	rootDir := rootFlagSet.String("root", config.Root(), "Root directory of images, containers and networks (or set "+config.RootEnv+")")
+
 	root := &ffcli.Command{
 		Name:       appName,
 		ShortHelp:  "tinydock is a minimal implementation of container runtime",
-		ShortUsage: "tinydock COMMAND",
-		FlagSet:    flag.NewFlagSet(appName, flag.ExitOnError),
+		ShortUsage: "tinydock [-root DIR] COMMAND",
+		FlagSet:    rootFlagSet,
 		Subcommands: []*ffcli.Command{
 			newRunCmd(),
 			newListCmd(),
+			newInspectCmd(),
+			newVerifyCmd(),
 			newStopCmd(),
+			newKillCmd(),
+			newWaitCmd(),
+			newAttachCmd(),
+			newStartCmd(),
+			newRestartCmd(),
+			newRenameCmd(),
+			newPauseCmd(),
+			newUnpauseCmd(),
 			newRemoveCmd(),
 			newLogsCmd(),
+			newStatsCmd(),
+			newTopCmd(),
+			newNetemCmd(),
+			newPortCmd(),
 			newExecCmd(),
+			newCpCmd(),
+			newMountCmd(),
 			newCommitCmd(),
+			newBuildCmd(),
+			newTagCmd(),
+			newBundleCmd(),
+			newUnbundleCmd(),
+			newBackupCmd(),
+			newRestoreBackupCmd(),
+			newPullCmd(),
+			newPushCmd(),
 			newImagesCmd(),
+			newRemoveImageCmd(),
+			newImageCmd(),
 			newNetworkCmd(),
+			newInfoCmd(),
+			newMetricsCmd(),
+			newWatchdogCmd(),
 		},
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) == 0 {
@@ -51,7 +134,19 @@ func main() {
 		},
 	}
 
-	if err := root.ParseAndRun(context.Background(), os.Args[1:]); err != nil {
+	root.Subcommands = append(root.Subcommands, newCompletionCmd(root))
+
+	if err := root.Parse(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+
+	if *rootDir != config.Root() {
+		if err := config.SetRoot(*rootDir); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if err := root.Run(context.Background()); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -62,43 +157,172 @@ func newRunCmd() *ffcli.Command {
 	interactive := runFlagSet.Bool("it", false, "Run container in interactive mode")
 	autoRemove := runFlagSet.Bool("rm", false, "Automatically remove the container when it exits")
 	detached := runFlagSet.Bool("d", false, "Run container in detached mode")
+	openStdin := runFlagSet.Bool("i", false, "Keep stdin of detached container open for attach")
+	name := runFlagSet.String("name", "", "Assign a name to the container")
+	pidFile := runFlagSet.String("pidfile", "", "Write PID of container init process to a file")
+	notify := runFlagSet.Bool("notify", false, "Notify systemd through NOTIFY_SOCKET once container is started, or ready with -wait-ready")
+	dryRun := runFlagSet.Bool("dry-run", false, "Print what would be done without doing it")
+	waitReady := runFlagSet.String("wait-ready", "", "With -d, stream output until a line matches this regex")
+	waitTimeout := runFlagSet.Duration("wait-timeout", 0, "Fail if container is not ready in time (e.g., 30s)")
 
 	cpuLimit := runFlagSet.Float64("c", 0, "CPU limit (e.g., 0.5 for 50% of one core)")
 	memoryLimit := runFlagSet.String("m", "", "Memory limit (e.g., 100m)")
+	profile := runFlagSet.String("profile", "", "Apply resource limits of a profile from config file, -c and -m override them")
+
+	var priority container.Priority
+	runFlagSet.IntVar(&priority.Nice, "nice", 0, "Scheduling niceness from -20 (highest) to 19 (lowest)")
+	runFlagSet.IntVar(&priority.RTPriority, "cpu-rt", 0, "Run with SCHED_RR real-time priority from 1 to 99")
+	evictionPriority := runFlagSet.Int("priority", 0, "Priority under host memory pressure, containers with lower ones are evicted first by watchdog")
+
+	nw := runFlagSet.String("network", "", "Connect a container to a network ('bridge' for default network)")
+
+	var volumesFlag volume.Flag
+	runFlagSet.Var(&volumesFlag, "v", "Bind mount a volume (e.g., /host:/container)")
+
+	var storageOpts overlay.MountOptions
+	runFlagSet.Var(&storageOpts, "storage-opt", "Set overlay mount option (metacopy=on|off, index=on|off, redirect_dir=..., userxattr, volatile)")
 
-	nw := runFlagSet.String("network", "", "Connect a container to a network")
+	volumesFrom := runFlagSet.String("volumes-from", "", "Mount all volumes of the given container")
 
-	var volumes volume.Volumes
-	runFlagSet.Var(&volumes, "v", "Bind mount a volume (e.g., /host:/container)")
+	var labels container.Labels
+	runFlagSet.Var(&labels, "l", "Set a label on the container (KEY=VALUE)")
+	runFlagSet.Func("label-file", "Read labels from a file of KEY=VALUE lines", labels.ReadFile)
 
-	var envs container.Envs
-	runFlagSet.Var(&envs, "e", "Set environment variables")
+	var requires []string
+	runFlagSet.Func("requires", "Refuse to start unless the given container is running", func(value string) error {
+		requires = append(requires, value)
+		return nil
+	})
+
+	var envsFlag container.EnvFlag
+	runFlagSet.Var(&envsFlag, "e", "Set environment variables (KEY=VALUE, KEY to forward from host, KEY= to unset)")
+
+	var dns container.DNS
+	runFlagSet.Func("dns", "Set custom DNS servers", dns.AddServer)
+	runFlagSet.Func("dns-search", "Set custom DNS search domains", dns.AddSearch)
+	runFlagSet.Func("dns-opt", "Set DNS resolver options (e.g., ndots:2)", dns.AddOption)
+
+	var securityOpts container.SecurityOpts
+	runFlagSet.Var(&securityOpts, "security-opt", "Relax default hardening (proc=unmasked, sys=rw, net=admin)")
+	runFlagSet.BoolVar(&securityOpts.NetAdmin, "net-admin", false, "Allow changing network sysctls for routers, VPNs and network debugging (same as -security-opt net=admin)")
 
 	var ports network.PortMappings
 	runFlagSet.Var(&ports, "p", "Publish a container's port(s) to the host")
 
+	var exposed network.ExposedPorts
+	runFlagSet.Var(&exposed, "expose", "Expose a container port without publishing it to the host")
+
 	return &ffcli.Command{
 		Name:       "run",
 		ShortHelp:  "Create and run a new container",
-		ShortUsage: "tinydock run (-it [-rm] | -d) [-c CPU] [-m MEMORY] [-network NETWORK [-p HOST_PORT:CONTAINER_PORT]...] [-v SRC:DST]... [-e KEY=VALUE]... IMAGE COMMAND [ARG...]",
+		ShortUsage: "tinydock run [-dry-run] (-it [-rm] | -d [-i] [-wait-ready REGEX [-wait-timeout DURATION]]) [-name NAME] [-pidfile FILE] [-notify] [-profile NAME] [-c CPU] [-m MEMORY] [-nice N] [-cpu-rt PRIORITY] [-priority N] [-network NETWORK [-p HOST_PORT:CONTAINER_PORT]... [-expose PORT]...] [-v SRC:DST]... [-volumes-from CONTAINER] [-requires CONTAINER]... [-l KEY=VALUE]... [-label-file FILE]... [-storage-opt OPT]... [-e KEY[=VALUE]]... [-dns IP]... [-dns-search DOMAIN]... [-dns-opt OPT]... [-security-opt OPT]... [-net-admin] IMAGE COMMAND [ARG...]",
 		FlagSet:    runFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
 			if len(args) < 2 {
 				return fmt.Errorf("'tinydock run' requires at least 2 arguments")
 			}
 
+			if err := errors.Join(volumesFlag.Err(), envsFlag.Err()); err != nil {
+				return fmt.Errorf("invalid flags:\n%w", err)
+			}
+			volumes, envs := volumesFlag.Volumes, envsFlag.Envs
+
 			if *interactive && *detached {
 				return fmt.Errorf("detached container cannot be interactive")
 			}
+			if *openStdin && !*detached {
+				return fmt.Errorf("keeping stdin open only works for detached containers, use -it otherwise")
+			}
 			if !*interactive && *autoRemove {
 				return fmt.Errorf("autoremove only works for interactive containers")
 			}
 
+			ready := container.Readiness{Timeout: *waitTimeout, Notify: *notify}
+			if *waitReady != "" {
+				if !*detached {
+					return fmt.Errorf("waiting for readiness only works for detached containers")
+				}
+
+				pattern, err := regexp.Compile(*waitReady)
+				if err != nil {
+					return fmt.Errorf("invalid readiness pattern: %w", err)
+				}
+				ready.Pattern = pattern
+			} else if *waitTimeout != 0 {
+				return fmt.Errorf("wait timeout requires a readiness pattern")
+			}
+
 			if *nw == "" && len(ports) > 0 {
 				return fmt.Errorf("port publishing requires a network to be specified")
 			}
+			if *nw == "" && len(exposed) > 0 {
+				return fmt.Errorf("exposing ports requires a network to be specified")
+			}
+
+			if *profile != "" {
+				cfg, err := config.Load()
+				if err != nil {
+					return err
+				}
+				p, err := cfg.Profile(*profile)
+				if err != nil {
+					return err
+				}
+
+				set := map[string]bool{}
+				runFlagSet.Visit(func(f *flag.Flag) { set[f.Name] = true })
+				if !set["c"] {
+					*cpuLimit = p.CPU
+				}
+				if !set["m"] {
+					*memoryLimit = p.Memory
+				}
+			}
+
+			if *volumesFrom != "" {
+				inherited, err := container.VolumesFrom(*volumesFrom)
+				if err != nil {
+					return err
+				}
+				for _, v := range inherited {
+					if err := volumes.Add(v); err != nil {
+						return fmt.Errorf("failed to inherit volumes of %s: %w", *volumesFrom, err)
+					}
+				}
+			}
 
-			return container.Init(args[0], args[1:], *interactive, *autoRemove, *detached, *nw, ports, volumes, envs, *cpuLimit, *memoryLimit)
+			opts := container.Options{
+				Interactive:      *interactive,
+				AutoRemove:       *autoRemove,
+				Detached:         *detached,
+				OpenStdin:        *openStdin,
+				Network:          *nw,
+				Ports:            ports,
+				Exposed:          exposed,
+				Volumes:          volumes,
+				StorageOpts:      storageOpts,
+				Envs:             envs,
+				DNS:              dns,
+				Security:         securityOpts,
+				Priority:         priority,
+				Ready:            ready,
+				Requires:         requires,
+				Labels:           labels,
+				Name:             *name,
+				PIDFile:          *pidFile,
+				EvictionPriority: *evictionPriority,
+				CPULimit:         *cpuLimit,
+				MemoryLimit:      *memoryLimit,
+			}
+
+			if *dryRun {
+				return container.Plan(args[0], args[1:], opts)
+			}
+
+			// Init tears down a container failing before it is recorded, one
+			// failing later, e.g. to start its command, is kept with its error
+			_, err := container.Init(args[0], args[1:], opts)
+			return err
 		},
 	}
 }
@@ -107,10 +331,14 @@ func newListCmd() *ffcli.Command {
 	listFlagSet := flag.NewFlagSet("ls", flag.ExitOnError)
 
 	showAll := listFlagSet.Bool("a", false, "Show all containers (default shows running)")
+	withStats := listFlagSet.Bool("stats", false, "Show CPU and memory usage of running containers")
+
+	var filters container.LabelFilters
+	listFlagSet.Var(&filters, "filter", "Only show containers with a label (label=KEY or label=KEY=VALUE)")
 
 	return &ffcli.Command{
 		Name:       "ls",
-		ShortUsage: "tinydock ls [-a]",
+		ShortUsage: "tinydock ls [-a] [-stats] [-filter label=KEY[=VALUE]]...",
 		ShortHelp:  "List containers",
 		FlagSet:    listFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
@@ -118,7 +346,7 @@ func newListCmd() *ffcli.Command {
 				return fmt.Errorf("'tinydock ls' accepts no arguments")
 			}
 
-			return container.List(*showAll)
+			return container.List(*showAll, *withStats, filters)
 		},
 	}
 }
@@ -130,7 +358,7 @@ func newStopCmd() *ffcli.Command {
 
 	return &ffcli.Command{
 		Name:       "stop",
-		ShortUsage: "tinydock stop [-s SIGNAL] CONTAINER [CONTAINER...]",
+		ShortUsage: "tinydock stop [-s SIGNAL] CONTAINER|PATTERN [CONTAINER|PATTERN...]",
 		ShortHelp:  "Stop one or more containers",
 		FlagSet:    stopFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
@@ -138,12 +366,162 @@ func newStopCmd() *ffcli.Command {
 				return fmt.Errorf("'tinydock stop' requires at least 1 argument")
 			}
 
+			for _, ref := range args {
+				ids, err := container.Resolve(ref)
+				if err != nil {
+					log.Printf("Error stopping container %s: %v", ref, err)
+					continue
+				}
+
+				for _, id := range ids {
+					if err := container.Stop(id, *sig); err != nil {
+						log.Printf("Error stopping container %s: %v", id, err)
+						continue
+					}
+					fmt.Println(id)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func newKillCmd() *ffcli.Command {
+	killFlagSet := flag.NewFlagSet("kill", flag.ExitOnError)
+
+	sig := killFlagSet.String("s", "", "Signal to send to the container (default SIGKILL)")
+
+	return &ffcli.Command{
+		Name:       "kill",
+		ShortUsage: "tinydock kill [-s SIGNAL] CONTAINER|PATTERN [CONTAINER|PATTERN...]",
+		ShortHelp:  "Send a signal to one or more containers without waiting for them to exit",
+		FlagSet:    killFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock kill' requires at least 1 argument")
+			}
+
+			for _, ref := range args {
+				ids, err := container.Resolve(ref)
+				if err != nil {
+					log.Printf("Error killing container %s: %v", ref, err)
+					continue
+				}
+
+				for _, id := range ids {
+					if err := container.Kill(id, *sig); err != nil {
+						log.Printf("Error killing container %s: %v", id, err)
+						continue
+					}
+					fmt.Println(id)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func newWaitCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "wait",
+		ShortUsage: "tinydock wait CONTAINER [CONTAINER...]",
+		ShortHelp:  "Block until one or more containers exit, then print their exit codes",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock wait' requires at least 1 argument")
+			}
+
 			for _, id := range args {
-				if err := container.Stop(id, *sig); err != nil {
-					log.Printf("Error stopping container %s: %v", id, err)
+				code, err := container.Wait(id)
+				if err != nil {
+					log.Printf("Error waiting for container %s: %v", id, err)
+					continue
+				}
+				fmt.Println(code)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newAttachCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "attach",
+		ShortUsage: "tinydock attach CONTAINER",
+		ShortHelp:  "Attach to the input and output of a running detached container, Ctrl-C detaches",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock attach' requires exactly 1 argument")
+			}
+
+			return container.Attach(args[0])
+		},
+	}
+}
+
+func newStartCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "start",
+		ShortUsage: "tinydock start CONTAINER|PATTERN [CONTAINER|PATTERN...]",
+		ShortHelp:  "Start one or more stopped containers in detached mode",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock start' requires at least 1 argument")
+			}
+
+			for _, ref := range args {
+				ids, err := container.Resolve(ref)
+				if err != nil {
+					log.Printf("Error starting container %s: %v", ref, err)
+					continue
+				}
+
+				for _, id := range ids {
+					if err := container.Start(id); err != nil {
+						log.Printf("Error starting container %s: %v", id, err)
+						continue
+					}
+					fmt.Println(id)
+				}
+			}
+
+			return nil
+		},
+	}
+}
+
+func newRestartCmd() *ffcli.Command {
+	restartFlagSet := flag.NewFlagSet("restart", flag.ExitOnError)
+
+	timeout := restartFlagSet.Duration("t", container.DefaultStopTimeout, "Time to wait for the container to stop before killing it")
+
+	return &ffcli.Command{
+		Name:       "restart",
+		ShortUsage: "tinydock restart [-t TIMEOUT] CONTAINER|PATTERN [CONTAINER|PATTERN...]",
+		ShortHelp:  "Restart one or more containers in detached mode",
+		FlagSet:    restartFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock restart' requires at least 1 argument")
+			}
+
+			for _, ref := range args {
+				ids, err := container.Resolve(ref)
+				if err != nil {
+					log.Printf("Error restarting container %s: %v", ref, err)
 					continue
 				}
-				fmt.Println(id)
+
+				for _, id := range ids {
+					if err := container.Restart(id, *timeout); err != nil {
+						log.Printf("Error restarting container %s: %v", id, err)
+						continue
+					}
+					fmt.Println(id)
+				}
 			}
 
 			return nil
@@ -151,6 +529,87 @@ func newStopCmd() *ffcli.Command {
 	}
 }
 
+func newRenameCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "rename",
+		ShortUsage: "tinydock rename CONTAINER NEW_NAME",
+		ShortHelp:  "Rename a container",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock rename' requires exactly 2 arguments")
+			}
+
+			return container.Rename(args[0], args[1])
+		},
+	}
+}
+
+func newPauseCmd() *ffcli.Command {
+	pauseFlagSet := flag.NewFlagSet("pause", flag.ExitOnError)
+
+	all := pauseFlagSet.Bool("all", false, "Pause all running containers, e.g. for host maintenance")
+
+	return &ffcli.Command{
+		Name:       "pause",
+		ShortUsage: "tinydock pause (-all | CONTAINER|PATTERN [CONTAINER|PATTERN...])",
+		ShortHelp:  "Freeze all processes of one or more containers",
+		FlagSet:    pauseFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			return forEachContainer("pause", "pausing", args, *all, container.Running, container.Pause)
+		},
+	}
+}
+
+func newUnpauseCmd() *ffcli.Command {
+	unpauseFlagSet := flag.NewFlagSet("unpause", flag.ExitOnError)
+
+	all := unpauseFlagSet.Bool("all", false, "Unpause all paused containers")
+
+	return &ffcli.Command{
+		Name:       "unpause",
+		ShortUsage: "tinydock unpause (-all | CONTAINER|PATTERN [CONTAINER|PATTERN...])",
+		ShortHelp:  "Resume processes of one or more paused containers",
+		FlagSet:    unpauseFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			return forEachContainer("unpause", "unpausing", args, *all, container.Paused, container.Unpause)
+		},
+	}
+}
+
+// forEachContainer applies fn to containers given by args, or with -all to all
+// containers of given status, printing IDs of those it succeeded on.
+func forEachContainer(name, action string, args []string, all bool, status container.Status, fn func(string) error) error {
+	if all == (len(args) > 0) {
+		return fmt.Errorf("'tinydock %s' requires either -all or at least 1 argument", name)
+	}
+
+	var ids []string
+	if all {
+		var err error
+		if ids, err = container.IDsWithStatus(status); err != nil {
+			return err
+		}
+	}
+	for _, ref := range args {
+		resolved, err := container.Resolve(ref)
+		if err != nil {
+			log.Printf("Error %s container %s: %v", action, ref, err)
+			continue
+		}
+		ids = append(ids, resolved...)
+	}
+
+	for _, id := range ids {
+		if err := fn(id); err != nil {
+			log.Printf("Error %s container %s: %v", action, id, err)
+			continue
+		}
+		fmt.Println(id)
+	}
+
+	return nil
+}
+
 func newRemoveCmd() *ffcli.Command {
 	removeFlagSet := flag.NewFlagSet("rm", flag.ExitOnError)
 
@@ -158,7 +617,7 @@ func newRemoveCmd() *ffcli.Command {
 
 	return &ffcli.Command{
 		Name:       "rm",
-		ShortUsage: "tinydock rm [-f] CONTAINER [CONTAINER...]",
+		ShortUsage: "tinydock rm [-f] CONTAINER|PATTERN [CONTAINER|PATTERN...]",
 		ShortHelp:  "Remove one or more containers",
 		FlagSet:    removeFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
@@ -166,12 +625,20 @@ func newRemoveCmd() *ffcli.Command {
 				return fmt.Errorf("'tinydock rm' requires at least 1 argument")
 			}
 
-			for _, id := range args {
-				if err := container.Remove(id, *force); err != nil {
-					log.Printf("Error removing container %s: %v", id, err)
+			for _, ref := range args {
+				ids, err := container.Resolve(ref)
+				if err != nil {
+					log.Printf("Error removing container %s: %v", ref, err)
 					continue
 				}
-				fmt.Println(id)
+
+				for _, id := range ids {
+					if err := container.Remove(id, *force); err != nil {
+						log.Printf("Error removing container %s: %v", id, err)
+						continue
+					}
+					fmt.Println(id)
+				}
 			}
 
 			return nil
@@ -199,113 +666,852 @@ func newLogsCmd() *ffcli.Command {
 	}
 }
 
-func newExecCmd() *ffcli.Command {
+func newStatsCmd() *ffcli.Command {
+	statsFlagSet := flag.NewFlagSet("stats", flag.ExitOnError)
+
+	sortBy := statsFlagSet.String("sort", container.SortByCPU, "Sort containers by 'cpu' or 'mem' usage")
+	format := statsFlagSet.String("format", container.FormatTable, "Output 'table' stream or a single 'json' reading")
+	output := statsFlagSet.String("output", "", "Append readings to a CSV file every second instead of displaying them")
+	noStream := statsFlagSet.Bool("no-stream", false, "Print a single reading instead of a live stream")
+
 	return &ffcli.Command{
-		Name:       "exec",
-		ShortUsage: "tinydock exec CONTAINER COMMAND [ARG...]",
-		ShortHelp:  "Execute a command in a running container",
+		Name:       "stats",
+		ShortUsage: "tinydock stats [-sort cpu|mem] [-format table|json] [-no-stream] [-output FILE] [CONTAINER...]",
+		ShortHelp:  "Display a live stream of container resource usage",
+		FlagSet:    statsFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) < 2 {
-				return fmt.Errorf("'tinydock exec' requires at least 2 arguments")
-			}
-
-			return container.Exec(args[0], args[1:])
+			return container.Stats(args, *sortBy, *format, *output, *noStream)
 		},
 	}
 }
 
-func newCommitCmd() *ffcli.Command {
+func newNetemCmd() *ffcli.Command {
+	netemFlagSet := flag.NewFlagSet("netem", flag.ExitOnError)
+
+	delay := netemFlagSet.Duration("delay", 0, "Delay added to packets (e.g., 100ms)")
+	jitter := netemFlagSet.Duration("jitter", 0, "Random variation of delay (e.g., 10ms)")
+	loss := netemFlagSet.String("loss", "", "Percentage of packets dropped (e.g., 1%)")
+
 	return &ffcli.Command{
-		Name:       "commit",
-		ShortUsage: "tinydock commit CONTAINER NAME",
-		ShortHelp:  "Create a new image from a container's changes",
+		Name:       "netem",
+		ShortUsage: "tinydock netem [-delay DURATION] [-jitter DURATION] [-loss PERCENT] CONTAINER",
+		ShortHelp:  "Emulate network delay and packet loss for a container",
+		LongHelp: "Emulate network conditions with tc netem on host side of container's veth,\n" +
+			"affecting traffic sent to container. Conditions applied before are replaced.",
+		FlagSet: netemFlagSet,
+		Subcommands: []*ffcli.Command{
+			newNetemClearCmd(),
+		},
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) != 2 {
-				return fmt.Errorf("'tinydock commit' requires exactly 2 arguments")
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock netem' requires exactly 1 argument")
 			}
 
-			if err := container.Commit(args[0], args[1]); err != nil {
-				return err
+			imp := network.Impairment{Delay: *delay, Jitter: *jitter}
+			if *loss != "" {
+				var err error
+				if imp.Loss, err = network.ParseLoss(*loss); err != nil {
+					return err
+				}
 			}
-			fmt.Println(args[1])
 
-			return nil
+			return container.Netem(args[0], imp)
 		},
 	}
 }
 
-func newImagesCmd() *ffcli.Command {
+func newNetemClearCmd() *ffcli.Command {
 	return &ffcli.Command{
-		Name:       "images",
-		ShortUsage: "tinydock images",
-		ShortHelp:  "List images",
+		Name:       "clear",
+		ShortUsage: "tinydock netem clear CONTAINER",
+		ShortHelp:  "Remove emulated network conditions of a container",
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) != 0 {
-				return fmt.Errorf("'tinydock images' accepts no arguments")
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock netem clear' requires exactly 1 argument")
 			}
 
-			return container.ListImages()
+			return container.ClearNetem(args[0])
 		},
 	}
 }
 
-func newNetworkCmd() *ffcli.Command {
+func newVerifyCmd() *ffcli.Command {
 	return &ffcli.Command{
-		Name:       "network",
-		ShortUsage: "tinydock network COMMAND",
-		ShortHelp:  "Manage networks",
-		Subcommands: []*ffcli.Command{
-			newNetworkCreateCmd(),
-			newNetworkRemoveCmd(),
-			newNetworkLsCmd(),
+		Name:       "verify",
+		ShortUsage: "tinydock verify CONTAINER",
+		ShortHelp:  "Compare recorded state of a running container with live kernel state and report drift",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock verify' requires exactly 1 argument")
+			}
+
+			return container.Verify(args[0])
 		},
-		Exec: func(context.Context, []string) error {
-			return flag.ErrHelp
+	}
+}
+
+func newInspectCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "inspect",
+		ShortUsage: "tinydock inspect CONTAINER",
+		ShortHelp:  "Display detailed information of a container as JSON",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock inspect' requires exactly 1 argument")
+			}
+
+			return container.Inspect(args[0])
 		},
 	}
 }
 
-func newNetworkCreateCmd() *ffcli.Command {
-	networkCreateFlagSet := flag.NewFlagSet("network create", flag.ExitOnError)
+func newTopCmd() *ffcli.Command {
+	topFlagSet := flag.NewFlagSet("top", flag.ExitOnError)
 
-	driver := networkCreateFlagSet.String("driver", "", "Driver to manage the Network")
-	subnet := networkCreateFlagSet.String("subnet", "", "Subnet in CIDR format")
+	columns := topFlagSet.String("o", container.DefaultTopColumns, "Comma separated columns to display")
+	sortKeys := topFlagSet.String("sort", "", "Comma separated sort keys, prefix with '-' for descending order")
 
 	return &ffcli.Command{
-		Name:       "create",
-		ShortUsage: "tinydock network create [-driver DRIVER] [-subnet SUBNET] NETWORK",
-		ShortHelp:  "Create a network",
-		FlagSet:    networkCreateFlagSet,
+		Name:       "top",
+		ShortUsage: "tinydock top CONTAINER [-o COLUMNS] [-sort [+|-]KEY[,...]]",
+		ShortHelp:  "Display the running processes of a container",
+		LongHelp:   "Available columns: pid, ppid, nspid, user, uid, stat, etime, time, rss, comm, args.",
+		FlagSet:    topFlagSet,
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) != 1 {
-				return fmt.Errorf("'tinydock network create' requires exactly 1 argument")
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock top' requires exactly 1 argument")
 			}
 
-			if err := network.Create(args[0], *driver, *subnet); err != nil {
+			// Allow flags after container as in ps-style invocations
+			if err := topFlagSet.Parse(args[1:]); err != nil {
 				return err
 			}
-			fmt.Println(args[0])
+			if topFlagSet.NArg() != 0 {
+				return fmt.Errorf("'tinydock top' requires exactly 1 argument")
+			}
 
-			return nil
+			return container.Top(args[0], *columns, *sortKeys)
 		},
 	}
 }
 
-func newNetworkRemoveCmd() *ffcli.Command {
+func newPortCmd() *ffcli.Command {
 	return &ffcli.Command{
-		Name:       "rm",
-		ShortUsage: "tinydock network rm NETWORK [NETWORK...]",
-		ShortHelp:  "Remove one or more networks",
+		Name:       "port",
+		ShortUsage: "tinydock port CONTAINER",
+		ShortHelp:  "List published and exposed ports of a container",
 		Exec: func(ctx context.Context, args []string) error {
-			if len(args) < 1 {
-				return fmt.Errorf("'tinydock network rm' requires at least 1 argument")
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock port' requires exactly 1 argument")
 			}
 
-			for _, name := range args {
-				if err := network.Remove(name); err != nil {
-					log.Printf("Error removing network: %v", err)
-					continue
-				}
+			return container.Port(args[0])
+		},
+	}
+}
+
+func newMountCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "mount",
+		ShortUsage: "tinydock mount CONTAINER SRC:DST",
+		ShortHelp:  "Mount a volume into a running container",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock mount' requires exactly 2 arguments")
+			}
+
+			var volumes volume.Volumes
+			if err := volumes.Set(args[1]); err != nil {
+				return err
+			}
+
+			return container.Mount(args[0], volumes[0])
+		},
+	}
+}
+
+func newCpCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "cp",
+		ShortUsage: "tinydock cp CONTAINER:SRC DST | SRC CONTAINER:DST",
+		ShortHelp:  "Copy files between a container and the host, preserving permissions and symlinks",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock cp' requires exactly 2 arguments")
+			}
+
+			return container.Copy(args[0], args[1])
+		},
+	}
+}
+
+func newExecCmd() *ffcli.Command {
+	execFlagSet := flag.NewFlagSet("exec", flag.ExitOnError)
+
+	nsList := execFlagSet.String("ns", "", "Comma separated namespaces to join: ipc, uts, net, pid, mnt (default all)")
+	privileged := execFlagSet.Bool("privileged", false, "Lift /proc and /sys hardening for this session only")
+
+	return &ffcli.Command{
+		Name:       "exec",
+		ShortUsage: "tinydock exec [-ns LIST] [-privileged] CONTAINER COMMAND [ARG...]",
+		ShortHelp:  "Execute a command in a running container",
+		FlagSet:    execFlagSet,
+		Subcommands: []*ffcli.Command{
+			newExecLsCmd(),
+			newExecKillCmd(),
+		},
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 2 {
+				return fmt.Errorf("'tinydock exec' requires at least 2 arguments")
+			}
+
+			return container.Exec(args[0], args[1:], *nsList, *privileged)
+		},
+	}
+}
+
+func newExecLsCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "ls",
+		ShortUsage: "tinydock exec ls CONTAINER",
+		ShortHelp:  "List active exec sessions of a container",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock exec ls' requires exactly 1 argument")
+			}
+
+			return container.ListSessions(args[0])
+		},
+	}
+}
+
+func newExecKillCmd() *ffcli.Command {
+	execKillFlagSet := flag.NewFlagSet("exec kill", flag.ExitOnError)
+
+	sig := execKillFlagSet.String("s", "", "Signal to send to the session (default SIGKILL)")
+
+	return &ffcli.Command{
+		Name:       "kill",
+		ShortUsage: "tinydock exec kill [-s SIGNAL] CONTAINER PID",
+		ShortHelp:  "Terminate an exec session and its child processes",
+		FlagSet:    execKillFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock exec kill' requires exactly 2 arguments")
+			}
+
+			pid, err := strconv.Atoi(args[1])
+			if err != nil {
+				return fmt.Errorf("invalid session PID: %s", args[1])
+			}
+
+			return container.KillSession(args[0], pid, *sig)
+		},
+	}
+}
+
+func newCommitCmd() *ffcli.Command {
+	commitFlagSet := flag.NewFlagSet("commit", flag.ExitOnError)
+
+	incremental := commitFlagSet.Bool("incremental", false, "Store only container's changes as a layer on top of its image")
+	pause := commitFlagSet.Bool("pause", true, "Pause running container while its filesystem is captured")
+	signKey := commitFlagSet.String("sign-key", "", "Sign provenance of image with a PEM encoded ed25519 private key")
+
+	return &ffcli.Command{
+		Name:       "commit",
+		ShortUsage: "tinydock commit [-incremental] [-pause=false] [-sign-key FILE] CONTAINER NAME[:TAG]",
+		ShortHelp:  "Create a new image from a container's changes",
+		FlagSet:    commitFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock commit' requires exactly 2 arguments")
+			}
+
+			var key ed25519.PrivateKey
+			if *signKey != "" {
+				var err error
+				if key, err = overlay.LoadSigningKey(*signKey); err != nil {
+					return err
+				}
+			}
+
+			if err := container.Commit(args[0], args[1], "", *incremental, *pause, key); err != nil {
+				return err
+			}
+			fmt.Println(args[1])
+
+			return nil
+		},
+	}
+}
+
+func newBuildCmd() *ffcli.Command {
+	buildFlagSet := flag.NewFlagSet("build", flag.ExitOnError)
+
+	file := buildFlagSet.String("f", "", "Path of build file (default CONTEXT/"+build.DefaultFile+")")
+	tag := buildFlagSet.String("t", "", "Name and optional tag of built image (NAME[:TAG])")
+	nw := buildFlagSet.String("network", "", "Connect RUN steps to a network")
+	signKey := buildFlagSet.String("sign-key", "", "Sign provenance of image with a PEM encoded ed25519 private key")
+
+	return &ffcli.Command{
+		Name:       "build",
+		ShortUsage: "tinydock build -t NAME[:TAG] [-f FILE] [-network NETWORK] [-sign-key FILE] CONTEXT",
+		ShortHelp:  "Build an image from a build file",
+		LongHelp: "Build an image from a build file supporting FROM, RUN, COPY, ENV and CMD.\n" +
+			"Each RUN and COPY step runs in a throwaway container and is committed as a layer.",
+		FlagSet: buildFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock build' requires exactly 1 argument")
+			}
+			if *tag == "" {
+				return fmt.Errorf("'tinydock build' requires an image name (-t)")
+			}
+
+			var key ed25519.PrivateKey
+			if *signKey != "" {
+				var err error
+				if key, err = overlay.LoadSigningKey(*signKey); err != nil {
+					return err
+				}
+			}
+
+			return build.Build(args[0], *file, *tag, *nw, key)
+		},
+	}
+}
+
+func newTagCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "tag",
+		ShortUsage: "tinydock tag SOURCE[:TAG] TARGET[:TAG]",
+		ShortHelp:  "Create a tag TARGET that refers to SOURCE image",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock tag' requires exactly 2 arguments")
+			}
+
+			return overlay.Tag(args[0], args[1])
+		},
+	}
+}
+
+func newBundleCmd() *ffcli.Command {
+	bundleFlagSet := flag.NewFlagSet("bundle", flag.ExitOnError)
+
+	output := bundleFlagSet.String("o", "", "Write bundle to this file")
+
+	return &ffcli.Command{
+		Name:       "bundle",
+		ShortUsage: "tinydock bundle -o FILE CONTAINER",
+		ShortHelp:  "Save a container's state into a bundle archive",
+		FlagSet:    bundleFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock bundle' requires exactly 1 argument")
+			}
+
+			if *output == "" {
+				return fmt.Errorf("output file must be specified with -o")
+			}
+
+			return container.Bundle(args[0], *output)
+		},
+	}
+}
+
+func newUnbundleCmd() *ffcli.Command {
+	unbundleFlagSet := flag.NewFlagSet("unbundle", flag.ExitOnError)
+
+	input := unbundleFlagSet.String("i", "", "Read bundle from this file")
+
+	return &ffcli.Command{
+		Name:       "unbundle",
+		ShortUsage: "tinydock unbundle -i FILE",
+		ShortHelp:  "Re-create a container from a bundle archive",
+		FlagSet:    unbundleFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock unbundle' accepts no arguments")
+			}
+
+			if *input == "" {
+				return fmt.Errorf("input file must be specified with -i")
+			}
+
+			id, err := container.Unbundle(*input)
+			if err != nil {
+				return err
+			}
+			fmt.Println(id)
+
+			return nil
+		},
+	}
+}
+
+func newBackupCmd() *ffcli.Command {
+	backupFlagSet := flag.NewFlagSet("backup", flag.ExitOnError)
+
+	output := backupFlagSet.String("o", "", "Write backup to this file, compressed by suffix (e.g., backup.tar.zst)")
+
+	return &ffcli.Command{
+		Name:       "backup",
+		ShortUsage: "tinydock backup -o FILE CONTAINER",
+		ShortHelp:  "Save a consistent backup of a container and its volumes",
+		FlagSet:    backupFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock backup' requires exactly 1 argument")
+			}
+
+			if *output == "" {
+				return fmt.Errorf("output file must be specified with -o")
+			}
+
+			return container.Backup(args[0], *output)
+		},
+	}
+}
+
+func newRestoreBackupCmd() *ffcli.Command {
+	restoreFlagSet := flag.NewFlagSet("restore-backup", flag.ExitOnError)
+
+	input := restoreFlagSet.String("i", "", "Read backup from this file")
+	volumeRoot := restoreFlagSet.String("volume-root", "", "Restore volumes under this directory instead of their original paths")
+
+	return &ffcli.Command{
+		Name:       "restore-backup",
+		ShortUsage: "tinydock restore-backup -i FILE [-volume-root DIR]",
+		ShortHelp:  "Re-create a container and its volumes from a backup",
+		FlagSet:    restoreFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock restore-backup' accepts no arguments")
+			}
+
+			if *input == "" {
+				return fmt.Errorf("input file must be specified with -i")
+			}
+
+			id, err := container.RestoreBackup(*input, *volumeRoot)
+			if err != nil {
+				return err
+			}
+			fmt.Println(id)
+
+			return nil
+		},
+	}
+}
+
+func newPullCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "pull",
+		ShortUsage: "tinydock pull REFERENCE [NAME]",
+		ShortHelp:  "Download an image from a registry",
+		LongHelp: "Download an image (e.g., alpine:3.20, ghcr.io/owner/app@sha256:...) from Docker Hub\n" +
+			"or any registry v2 endpoint. It is stored as NAME, by default last component\n" +
+			"of its repository and its tag (e.g., alpine:3.20).",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("'tinydock pull' requires 1 or 2 arguments")
+			}
+
+			name := ""
+			if len(args) == 2 {
+				name = args[1]
+			}
+
+			return registry.Pull(args[0], name)
+		},
+	}
+}
+
+func newPushCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "push",
+		ShortUsage: "tinydock push REFERENCE [NAME]",
+		ShortHelp:  "Upload an image to a registry",
+		LongHelp: "Upload image NAME, by default last component of repository in REFERENCE\n" +
+			"and its tag (e.g., localhost:5000/app:v1 pushes image app:v1), to a registry\n" +
+			"v2 endpoint.\n" +
+			"Only registries accepting anonymous pushes are supported.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 1 || len(args) > 2 {
+				return fmt.Errorf("'tinydock push' requires 1 or 2 arguments")
+			}
+
+			name := ""
+			if len(args) == 2 {
+				name = args[1]
+			}
+
+			return registry.Push(args[0], name)
+		},
+	}
+}
+
+func newImagesCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "images",
+		ShortUsage: "tinydock images",
+		ShortHelp:  "List images",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock images' accepts no arguments")
+			}
+
+			return container.ListImages()
+		},
+	}
+}
+
+func newRemoveImageCmd() *ffcli.Command {
+	removeImageFlagSet := flag.NewFlagSet("rmi", flag.ExitOnError)
+
+	force := removeImageFlagSet.Bool("f", false, "Force the removal of an image used by containers")
+
+	return &ffcli.Command{
+		Name:       "rmi",
+		ShortUsage: "tinydock rmi [-f] IMAGE [IMAGE...]",
+		ShortHelp:  "Remove one or more images",
+		FlagSet:    removeImageFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("'tinydock rmi' requires at least 1 argument")
+			}
+
+			for _, image := range args {
+				if err := overlay.DeleteImage(image, *force); err != nil {
+					log.Printf("Error removing image %s: %v", image, err)
+					continue
+				}
+				fmt.Println(image)
+			}
+
+			return nil
+		},
+	}
+}
+
+func newImageCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "image",
+		ShortUsage: "tinydock image COMMAND",
+		ShortHelp:  "Manage images",
+		Subcommands: []*ffcli.Command{
+			newImageCacheCmd(),
+			newImageVerifyCmd(),
+			newImageInspectCmd(),
+			newImageHistoryCmd(),
+			newImageSaveCmd(),
+			newImageLoadCmd(),
+			newImagePruneCmd(),
+			newImageDiffCmd(),
+			newImageUnpackCmd(),
+		},
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newImageInspectCmd() *ffcli.Command {
+	imageInspectFlagSet := flag.NewFlagSet("image inspect", flag.ExitOnError)
+
+	verifyKey := imageInspectFlagSet.String("verify-key", "", "Check provenance of image is signed by a PEM encoded ed25519 public key")
+
+	return &ffcli.Command{
+		Name:       "inspect",
+		ShortUsage: "tinydock image inspect [-verify-key FILE] IMAGE",
+		ShortHelp:  "Display detailed information of an image as JSON",
+		FlagSet:    imageInspectFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock image inspect' requires exactly 1 argument")
+			}
+
+			var key ed25519.PublicKey
+			if *verifyKey != "" {
+				var err error
+				if key, err = overlay.LoadVerifyKey(*verifyKey); err != nil {
+					return err
+				}
+			}
+
+			return overlay.InspectImage(args[0], key)
+		},
+	}
+}
+
+func newImageHistoryCmd() *ffcli.Command {
+	imageHistoryFlagSet := flag.NewFlagSet("image history", flag.ExitOnError)
+
+	noTrunc := imageHistoryFlagSet.Bool("no-trunc", false, "Do not truncate commands")
+
+	return &ffcli.Command{
+		Name:       "history",
+		ShortUsage: "tinydock image history [-no-trunc] IMAGE",
+		ShortHelp:  "Show layers of an image and how they were created",
+		FlagSet:    imageHistoryFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock image history' requires exactly 1 argument")
+			}
+
+			return overlay.ImageHistory(args[0], *noTrunc)
+		},
+	}
+}
+
+func newImageUnpackCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "unpack",
+		ShortUsage: "tinydock image unpack IMAGE DIR",
+		ShortHelp:  "Copy the filesystem of an image, with all layers applied, into a host directory",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock image unpack' requires exactly 2 arguments")
+			}
+
+			return overlay.UnpackImage(args[0], args[1])
+		},
+	}
+}
+
+func newImageSaveCmd() *ffcli.Command {
+	imageSaveFlagSet := flag.NewFlagSet("image save", flag.ExitOnError)
+
+	output := imageSaveFlagSet.String("o", "", "Write archive to file")
+
+	return &ffcli.Command{
+		Name:       "save",
+		ShortUsage: "tinydock image save -o FILE IMAGE",
+		ShortHelp:  "Save an image and its parents to a tar archive",
+		FlagSet:    imageSaveFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock image save' requires exactly 1 argument")
+			}
+			if *output == "" {
+				return fmt.Errorf("output file must be specified with -o")
+			}
+
+			return overlay.SaveArchive(args[0], *output)
+		},
+	}
+}
+
+func newImageLoadCmd() *ffcli.Command {
+	imageLoadFlagSet := flag.NewFlagSet("image load", flag.ExitOnError)
+
+	input := imageLoadFlagSet.String("i", "", "Read archive from file")
+	name := imageLoadFlagSet.String("t", "", "Store image of an OCI image layout archive as NAME[:TAG]")
+
+	return &ffcli.Command{
+		Name:       "load",
+		ShortUsage: "tinydock image load -i FILE [-t NAME[:TAG]]",
+		ShortHelp:  "Load an image from a tar archive",
+		LongHelp: "Load an image from an archive written by 'tinydock image save', or from an OCI\n" +
+			"image layout archive (e.g., written by docker save), resolving multi-platform\n" +
+			"images to current architecture.",
+		FlagSet: imageLoadFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock image load' accepts no arguments")
+			}
+			if *input == "" {
+				return fmt.Errorf("input file must be specified with -i")
+			}
+
+			ref, err := registry.Load(*input, *name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Loaded image: %s\n", ref)
+
+			return nil
+		},
+	}
+}
+
+func newImagePruneCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "prune",
+		ShortUsage: "tinydock image prune",
+		ShortHelp:  "Remove images not used by any container",
+		LongHelp: "Remove images not used by any container, keeping parents of used ones, along\n" +
+			"with blobs and extracted layers no remaining image refers to.",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock image prune' accepts no arguments")
+			}
+
+			removed, reclaimed, err := overlay.PruneImages()
+			for _, ref := range removed {
+				fmt.Printf("Deleted: %s\n", ref)
+			}
+			fmt.Printf("Total reclaimed space: %.2f MB\n", float64(reclaimed)/1024/1024)
+
+			return err
+		},
+	}
+}
+
+func newImageDiffCmd() *ffcli.Command {
+	imageDiffFlagSet := flag.NewFlagSet("image diff", flag.ExitOnError)
+
+	output := imageDiffFlagSet.String("o", "", "Write layer tarball to file")
+
+	return &ffcli.Command{
+		Name:       "diff",
+		ShortUsage: "tinydock image diff -o FILE IMAGE PARENT",
+		ShortHelp:  "Write changes from PARENT to IMAGE as a layer tarball",
+		LongHelp: "Write a gzipped tarball holding only files added or changed in IMAGE relative\n" +
+			"to PARENT, and overlay whiteouts for removed ones, e.g. to ship an update to\n" +
+			"machines that already have PARENT.",
+		FlagSet: imageDiffFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("'tinydock image diff' requires exactly 2 arguments")
+			}
+			if *output == "" {
+				return fmt.Errorf("output file must be specified with -o")
+			}
+
+			return overlay.DiffImages(args[0], args[1], *output)
+		},
+	}
+}
+
+func newImageVerifyCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "verify",
+		ShortUsage: "tinydock image verify [IMAGE...]",
+		ShortHelp:  "Check extracted images against their tarballs and re-extract inconsistent ones",
+		Exec: func(ctx context.Context, args []string) error {
+			return overlay.VerifyImages(args)
+		},
+	}
+}
+
+func newImageCacheCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "cache",
+		ShortUsage: "tinydock image cache COMMAND",
+		ShortHelp:  "Manage extracted image cache",
+		LongHelp: "Images are extracted on first use and kept for later runs. Set imageCacheLimit\n" +
+			"(e.g., \"10g\") in config.json under root directory to evict least recently\n" +
+			"used ones.",
+		Subcommands: []*ffcli.Command{
+			newImageCacheLsCmd(),
+			newImageCacheClearCmd(),
+		},
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newImageCacheLsCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "ls",
+		ShortUsage: "tinydock image cache ls",
+		ShortHelp:  "List extracted images",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock image cache ls' accepts no arguments")
+			}
+
+			return overlay.ListCache()
+		},
+	}
+}
+
+func newImageCacheClearCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "clear",
+		ShortUsage: "tinydock image cache clear",
+		ShortHelp:  "Remove extracted images not used by any container",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock image cache clear' accepts no arguments")
+			}
+
+			evicted, err := overlay.ClearCache()
+			for _, name := range evicted {
+				fmt.Println(name)
+			}
+
+			return err
+		},
+	}
+}
+
+func newNetworkCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "network",
+		ShortUsage: "tinydock network COMMAND",
+		ShortHelp:  "Manage networks",
+		Subcommands: []*ffcli.Command{
+			newNetworkCreateCmd(),
+			newNetworkRemoveCmd(),
+			newNetworkLsCmd(),
+			newNetworkIPAMCmd(),
+		},
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newNetworkCreateCmd() *ffcli.Command {
+	networkCreateFlagSet := flag.NewFlagSet("network create", flag.ExitOnError)
+
+	driver := networkCreateFlagSet.String("driver", "", "Driver to manage the Network")
+	subnet := networkCreateFlagSet.String("subnet", "", "Subnet in CIDR format")
+	internal := networkCreateFlagSet.Bool("internal", false, "Restrict external access to the network")
+	adopt := networkCreateFlagSet.Bool("adopt", false, "Reuse bridge and subnet left behind by an earlier run")
+
+	var opts network.Options
+	networkCreateFlagSet.Var(&opts, "o", "Set driver specific options (e.g., icc=false, bridge=br0, arp_probe=true)")
+
+	return &ffcli.Command{
+		Name:       "create",
+		ShortUsage: "tinydock network create [-driver DRIVER] [-subnet SUBNET] [-internal] [-adopt] [-o KEY=VALUE]... NETWORK",
+		ShortHelp:  "Create a network",
+		FlagSet:    networkCreateFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock network create' requires exactly 1 argument")
+			}
+
+			if err := network.Create(args[0], *driver, *subnet, *internal, *adopt, opts); err != nil {
+				return err
+			}
+			fmt.Println(args[0])
+
+			return nil
+		},
+	}
+}
+
+func newNetworkRemoveCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "rm",
+		ShortUsage: "tinydock network rm NETWORK [NETWORK...]",
+		ShortHelp:  "Remove one or more networks",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) < 1 {
+				return fmt.Errorf("'tinydock network rm' requires at least 1 argument")
+			}
+
+			for _, name := range args {
+				if err := network.Remove(name); err != nil {
+					log.Printf("Error removing network: %v", err)
+					continue
+				}
 				fmt.Println(name)
 			}
 
@@ -328,3 +1534,227 @@ func newNetworkLsCmd() *ffcli.Command {
 		},
 	}
 }
+
+func newNetworkIPAMCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "ipam",
+		ShortUsage: "tinydock network ipam COMMAND",
+		ShortHelp:  "Inspect IP address management",
+		Subcommands: []*ffcli.Command{
+			newNetworkIPAMLsCmd(),
+		},
+		Exec: func(context.Context, []string) error {
+			return flag.ErrHelp
+		},
+	}
+}
+
+func newNetworkIPAMLsCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "ls",
+		ShortUsage: "tinydock network ipam ls",
+		ShortHelp:  "List address usage of network prefixes",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock network ipam ls' accepts no arguments")
+			}
+
+			return network.ListIPAM()
+		},
+	}
+}
+
+// completionKinds names candidates completed for arguments of commands, and for
+// values of flags.
+var completionKinds = map[string]string{
+	"tinydock run":               completion.Images,
+	"tinydock run -network":      completion.Networks,
+	"tinydock run -volumes-from": completion.Containers,
+	"tinydock run -requires":     completion.Containers,
+	"tinydock inspect":           completion.Containers,
+	"tinydock verify":            completion.Containers,
+	"tinydock stop":              completion.Containers,
+	"tinydock kill":              completion.Containers,
+	"tinydock wait":              completion.Containers,
+	"tinydock attach":            completion.Containers,
+	"tinydock start":             completion.Containers,
+	"tinydock restart":           completion.Containers,
+	"tinydock rename":            completion.Containers,
+	"tinydock pause":             completion.Containers,
+	"tinydock unpause":           completion.Containers,
+	"tinydock rm":                completion.Containers,
+	"tinydock logs":              completion.Containers,
+	"tinydock stats":             completion.Containers,
+	"tinydock top":               completion.Containers,
+	"tinydock netem":             completion.Containers,
+	"tinydock netem clear":       completion.Containers,
+	"tinydock port":              completion.Containers,
+	"tinydock mount":             completion.Containers,
+	"tinydock exec":              completion.Containers,
+	"tinydock cp":                completion.Containers,
+	"tinydock exec ls":           completion.Containers,
+	"tinydock exec kill":         completion.Containers,
+	"tinydock commit":            completion.Containers,
+	"tinydock bundle":            completion.Containers,
+	"tinydock backup":            completion.Containers,
+	"tinydock build -network":    completion.Networks,
+	"tinydock tag":               completion.Images,
+	"tinydock rmi":               completion.Images,
+	"tinydock image inspect":     completion.Images,
+	"tinydock image history":     completion.Images,
+	"tinydock image save":        completion.Images,
+	"tinydock image unpack":      completion.Images,
+	"tinydock image diff":        completion.Images,
+	"tinydock image verify":      completion.Images,
+	"tinydock network rm":        completion.Networks,
+}
+
+func newCompletionCmd(root *ffcli.Command) *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "completion",
+		ShortUsage: "tinydock completion bash|zsh|fish",
+		ShortHelp:  "Generate shell completion script",
+		LongHelp: "Print a completion script for the given shell, e.g.:\n\n" +
+			"  source <(tinydock completion bash)\n" +
+			"  tinydock completion fish > ~/.config/fish/completions/tinydock.fish",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("'tinydock completion' requires exactly 1 argument")
+			}
+
+			return completion.Write(os.Stdout, args[0], root, completionKinds)
+		},
+	}
+}
+
+// listCandidates prints containers, images or networks for completion scripts.
+func listCandidates(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("'tinydock %s' requires exactly 1 argument", completion.HelperCommand)
+	}
+
+	var candidates []string
+	switch args[0] {
+	case completion.Containers:
+		ids, err := container.IDs()
+		if err != nil {
+			return err
+		}
+		names, err := container.Names()
+		if err != nil {
+			return err
+		}
+		candidates = append(ids, names...)
+	case completion.Images:
+		images, err := overlay.Images()
+		if err != nil {
+			return err
+		}
+		for _, img := range images {
+			candidates = append(candidates, img.Name+":"+img.Tag)
+		}
+	case completion.Networks:
+		names, err := network.Names()
+		if err != nil {
+			return err
+		}
+		candidates = names
+	default:
+		return fmt.Errorf("unknown completion kind %q", args[0])
+	}
+
+	for _, c := range candidates {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+func newWatchdogCmd() *ffcli.Command {
+	watchdogFlagSet := flag.NewFlagSet("watchdog", flag.ExitOnError)
+
+	threshold := watchdogFlagSet.Float64("threshold", 40, "Percentage of time all tasks stalled on memory to evict containers at")
+	action := watchdogFlagSet.String("action", container.EvictPause, "Evict containers by 'pause' or 'kill'")
+	interval := watchdogFlagSet.Duration("interval", time.Second, "How often to check host memory pressure")
+
+	return &ffcli.Command{
+		Name:       "watchdog",
+		ShortUsage: "tinydock watchdog [-threshold PERCENT] [-action pause|kill] [-interval DURATION]",
+		ShortHelp:  "Evict lowest priority containers under host memory pressure",
+		FlagSet:    watchdogFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock watchdog' accepts no arguments")
+			}
+
+			return container.Watchdog(*threshold, *action, *interval)
+		},
+	}
+}
+
+func newMetricsCmd() *ffcli.Command {
+	metricsFlagSet := flag.NewFlagSet("metrics", flag.ExitOnError)
+
+	since := metricsFlagSet.Duration("since", 0, "Only summarize operations within this long (e.g., 24h)")
+
+	return &ffcli.Command{
+		Name:       "metrics",
+		ShortUsage: "tinydock metrics [-since DURATION]",
+		ShortHelp:  "Summarize latency of container start, mount and network setup",
+		FlagSet:    metricsFlagSet,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock metrics' accepts no arguments")
+			}
+
+			var from time.Time
+			if *since > 0 {
+				from = time.Now().Add(-*since)
+			}
+
+			return metrics.Print(from)
+		},
+	}
+}
+
+func newInfoCmd() *ffcli.Command {
+	return &ffcli.Command{
+		Name:       "info",
+		ShortUsage: "tinydock info",
+		ShortHelp:  "Display system information and verify host features",
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) != 0 {
+				return fmt.Errorf("'tinydock info' accepts no arguments")
+			}
+
+			fmt.Printf("Root directory: %s\n\n", config.Root())
+			fmt.Println("Host features:")
+
+			// Driver is only known from a valid config, checks of default apply otherwise
+			cfg, err := config.Load()
+			required, optional := preflight.Host(err == nil && cfg.CgroupDriver == cgroups.DriverSystemd)
+
+			failed := false
+			for _, r := range preflight.Run(required...) {
+				if r.Err != nil {
+					failed = true
+					fmt.Printf("  [FAIL] %s: %v\n         hint: %s\n", r.Name, r.Err, r.Hint)
+					continue
+				}
+				fmt.Printf("  [ OK ] %s\n", r.Name)
+			}
+			for _, r := range preflight.Run(optional...) {
+				if r.Err != nil {
+					fmt.Printf("  [WARN] %s: %v\n         hint: %s\n", r.Name, r.Err, r.Hint)
+					continue
+				}
+				fmt.Printf("  [ OK ] %s\n", r.Name)
+			}
+
+			if failed {
+				return fmt.Errorf("some host features are missing")
+			}
+
+			return nil
+		},
+	}
+}
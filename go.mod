@@ -8,4 +8,4 @@ require (
 	github.com/vishvananda/netns v0.0.4
 )
 
-require golang.org/x/sys v0.24.0 // indirect
+require golang.org/x/sys v0.24.0
@@ -0,0 +1,198 @@
+// Package build creates images from a Dockerfile-like build file.
+//
+// Supported instructions are FROM, RUN, COPY, ENV and CMD. Each RUN and COPY
+// step is executed in a throwaway container and committed incrementally, so the
+// built image is a stack of layers on top of its FROM image.
+package build
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/container"
+	"github.com/lutaod/tinydock/internal/inroot"
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/untar"
+)
+
+// DefaultFile is name of build file looked up in build context.
+const DefaultFile = "Dockerfile"
+
+// Build builds an image from build file and tags it as target.
+//
+// Sources of COPY are resolved relative to contextDir, and build file defaults
+// to DefaultFile in it. RUN steps are connected to given network, if any.
+// Intermediate layers are kept as images named "build-<ID>:<N>", as the built
+// image is stacked on them. Provenance of built image lists build steps, and is
+// signed with signKey unless nil.
+func Build(contextDir, file, target, nw string, signKey ed25519.PrivateKey) error {
+	started := time.Now()
+
+	if err := overlay.ValidateRef(target); err != nil {
+		return err
+	}
+
+	if file == "" {
+		file = filepath.Join(contextDir, DefaultFile)
+	}
+
+	steps, err := parseFile(file)
+	if err != nil {
+		return err
+	}
+
+	from := steps[0].args[0]
+	image := from
+	meta, err := overlay.ImageMetadata(image)
+	if err != nil {
+		return err
+	}
+
+	var cfg overlay.ImageConfig
+	if meta != nil {
+		cfg = meta.Config
+	}
+
+	buildID := fmt.Sprintf("%06x", rand.Intn(1<<24))
+	layers := 0
+
+	for i, s := range steps {
+		fmt.Printf("Step %d/%d: %s\n", i+1, len(steps), s)
+
+		switch s.inst {
+		case instEnv:
+			for _, kv := range s.args {
+				cfg.Env = setEnv(cfg.Env, kv)
+			}
+
+		case instCmd:
+			cfg.Cmd = s.args
+
+		case instRun, instCopy:
+			layers++
+			next := fmt.Sprintf("build-%s:%d", buildID, layers)
+			if err := runStep(s, image, next, cfg.Env, contextDir, nw); err != nil {
+				return fmt.Errorf("step %d (line %d) failed: %w", i+1, s.line, err)
+			}
+			image = next
+		}
+	}
+
+	if err := overlay.Tag(image, target); err != nil {
+		return err
+	}
+
+	if err := overlay.SetImageConfig(target, cfg); err != nil {
+		return err
+	}
+
+	params := overlay.Parameters{Image: from, BuildFile: file}
+	for _, s := range steps {
+		params.Steps = append(params.Steps, s.String())
+	}
+	if err := overlay.AttestImage(target, params, started, signKey); err != nil {
+		return fmt.Errorf("failed to record provenance: %w", err)
+	}
+
+	fmt.Printf("Built %s\n", target)
+	return nil
+}
+
+// runStep executes a RUN or COPY step in a container created from image, and
+// commits its changes as image next.
+func runStep(s step, image, next string, env []string, contextDir, nw string) error {
+	args := s.args
+	if s.inst == instCopy {
+		// Files are copied from host, container only provides a mounted filesystem
+		args = []string{"true"}
+	}
+
+	id, err := container.Init(image, args, container.Options{Network: nw, Envs: container.Envs(env)})
+	if id != "" {
+		defer func() {
+			if err := container.Remove(id, true); err != nil {
+				log.Printf("Failed to remove build container %s: %v", id, err)
+			}
+		}()
+
+		if s.inst == instRun {
+			if err := container.Logs(id, false); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.inst == instCopy {
+		if err := copyFiles(contextDir, s.args[0], overlay.MergedDir(id), s.args[1]); err != nil {
+			return err
+		}
+	}
+
+	return container.Commit(id, next, s.String(), true, true, nil)
+}
+
+// copyFiles copies src under contextDir to dst in container filesystem rooted at
+// rootfs. Directories are copied by content, and dst ending with '/' is treated
+// as a directory to copy into.
+func copyFiles(contextDir, src, rootfs, dst string) error {
+	rel := filepath.Clean(src)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("COPY source %q is outside build context", src)
+	}
+	srcPath := filepath.Join(contextDir, rel)
+
+	fi, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("COPY source not found: %w", err)
+	}
+
+	// Resolve destination as if rootfs were "/", so neither ".." nor symlinks
+	// of image can lead it outside, and copy entry by entry so none below it
+	// is written through either
+	target := filepath.Clean("/" + dst)
+
+	var dir, name string
+	switch {
+	case fi.IsDir():
+		// Contents of a symlinked directory are copied, as walk does not follow it
+		if srcPath, err = filepath.EvalSymlinks(srcPath); err != nil {
+			return fmt.Errorf("failed to resolve COPY source: %w", err)
+		}
+		dir, name = target, "."
+	case strings.HasSuffix(dst, "/"):
+		dir, name = target, filepath.Base(srcPath)
+	default:
+		dir, name = filepath.Dir(target), filepath.Base(target)
+	}
+
+	dstDir, _, err := inroot.MkdirAll(rootfs, dir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create COPY destination: %w", err)
+	}
+
+	return untar.Copy(srcPath, dstDir, name)
+}
+
+// setEnv returns env with variable of given KEY=VALUE pair set, replacing any
+// earlier definition.
+func setEnv(env []string, kv string) []string {
+	key, _, _ := strings.Cut(kv, "=")
+
+	result := make([]string, 0, len(env)+1)
+	for _, e := range env {
+		if k, _, _ := strings.Cut(e, "="); k != key {
+			result = append(result, e)
+		}
+	}
+
+	return append(result, kv)
+}
@@ -0,0 +1,101 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFiles(t *testing.T) {
+	tests := []struct {
+		name      string
+		src       string
+		dst       string
+		want      []string
+		wantError bool
+	}{
+		{
+			name: "directory into directory",
+			src:  "dir/",
+			dst:  "/app/",
+			want: []string{"app/conf/app.conf", "app/main.sh"},
+		},
+		{
+			name: "directory through nested relative symlink",
+			src:  "dir",
+			dst:  "/app/up",
+			want: []string{"conf/app.conf", "main.sh"},
+		},
+		{
+			name:      "file into directory through dangling symlink",
+			src:       "dir/main.sh",
+			dst:       "/app/conf/",
+			wantError: true,
+		},
+		{
+			name: "file onto nested symlink",
+			src:  "dir/main.sh",
+			dst:  "/app/conf",
+			want: []string{"app/conf"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contextDir, rootfs, outside := t.TempDir(), t.TempDir(), t.TempDir()
+
+			for path, data := range map[string]string{"dir/main.sh": "run", "dir/conf/app.conf": "conf"} {
+				path = filepath.Join(contextDir, path)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+				}
+				if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", path, err)
+				}
+			}
+
+			// Symlinks of image point out of rootfs when followed on host
+			hostFile := filepath.Join(outside, "main.sh")
+			if err := os.WriteFile(hostFile, []byte("host"), 0644); err != nil {
+				t.Fatalf("Failed to write %s: %v", hostFile, err)
+			}
+			if err := os.MkdirAll(filepath.Join(rootfs, "app"), 0755); err != nil {
+				t.Fatalf("Failed to create app: %v", err)
+			}
+			links := map[string]string{
+				"app/conf":    outside,
+				"app/main.sh": hostFile,
+				"app/up":      "../../../..",
+			}
+			for name, target := range links {
+				if err := os.Symlink(target, filepath.Join(rootfs, name)); err != nil {
+					t.Fatalf("Failed to create symlink %s: %v", name, err)
+				}
+			}
+
+			err := copyFiles(contextDir, tt.src, rootfs, tt.dst)
+			if entries, err := os.ReadDir(outside); err != nil || len(entries) != 1 {
+				t.Errorf("copyFiles(%q, %q) wrote outside rootfs: %v", tt.src, tt.dst, entries)
+			}
+			if data, err := os.ReadFile(hostFile); err != nil || string(data) != "host" {
+				t.Errorf("copyFiles(%q, %q) wrote through symlink to %s", tt.src, tt.dst, hostFile)
+			}
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("copyFiles(%q, %q) expected error", tt.src, tt.dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("copyFiles(%q, %q) unexpected error: %v", tt.src, tt.dst, err)
+			}
+
+			for _, path := range tt.want {
+				fi, err := os.Lstat(filepath.Join(rootfs, path))
+				if err != nil || !fi.Mode().IsRegular() {
+					t.Errorf("copyFiles(%q, %q) did not create file %s", tt.src, tt.dst, path)
+				}
+			}
+		})
+	}
+}
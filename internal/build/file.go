@@ -0,0 +1,147 @@
+package build
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Instructions understood in a build file.
+const (
+	instFrom = "FROM"
+	instRun  = "RUN"
+	instCopy = "COPY"
+	instEnv  = "ENV"
+	instCmd  = "CMD"
+)
+
+// step is a single instruction of a build file.
+type step struct {
+	line int
+	inst string
+	args []string
+}
+
+func (s step) String() string {
+	return s.inst + " " + strings.Join(s.args, " ")
+}
+
+// parseFile reads build file at given path.
+//
+// Each line holds an instruction followed by its arguments. Lines ending with a
+// backslash continue on next line, and lines starting with '#' are comments.
+// FROM must come first and only once.
+func parseFile(path string) ([]step, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open build file: %w", err)
+	}
+	defer f.Close()
+
+	var steps []step
+	var pending string
+	start := 0
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if pending == "" {
+			start = n
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+		}
+
+		if cont, ok := strings.CutSuffix(line, "\\"); ok {
+			pending += strings.TrimSpace(cont) + " "
+			continue
+		}
+		line, pending = pending+line, ""
+
+		s, err := parseStep(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", start, err)
+		}
+		s.line = start
+
+		if (s.inst == instFrom) != (len(steps) == 0) {
+			return nil, fmt.Errorf("line %d: FROM must be the first instruction and appear once", start)
+		}
+		steps = append(steps, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read build file: %w", err)
+	}
+	if pending != "" {
+		return nil, fmt.Errorf("line %d: unterminated line continuation", start)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("build file has no FROM instruction")
+	}
+
+	return steps, nil
+}
+
+// parseStep parses a single instruction line.
+func parseStep(line string) (step, error) {
+	inst, rest, _ := strings.Cut(line, " ")
+	inst = strings.ToUpper(inst)
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return step{}, fmt.Errorf("%s requires arguments", inst)
+	}
+
+	switch inst {
+	case instFrom:
+		if len(strings.Fields(rest)) != 1 {
+			return step{}, fmt.Errorf("FROM requires exactly 1 argument")
+		}
+		return step{inst: inst, args: []string{rest}}, nil
+
+	case instRun, instCmd:
+		args, err := parseCommand(rest)
+		if err != nil {
+			return step{}, fmt.Errorf("%s: %w", inst, err)
+		}
+		return step{inst: inst, args: args}, nil
+
+	case instCopy:
+		fields := strings.Fields(rest)
+		if len(fields) != 2 {
+			return step{}, fmt.Errorf("COPY requires exactly 2 arguments: SRC DST")
+		}
+		return step{inst: inst, args: fields}, nil
+
+	case instEnv:
+		fields := strings.Fields(rest)
+		for _, kv := range fields {
+			if key, _, ok := strings.Cut(kv, "="); !ok || key == "" {
+				return step{}, fmt.Errorf("ENV expects KEY=VALUE pairs, got %q", kv)
+			}
+		}
+		return step{inst: inst, args: fields}, nil
+
+	default:
+		return step{}, fmt.Errorf("unknown instruction %q", inst)
+	}
+}
+
+// parseCommand parses a command in exec form, e.g. ["echo", "hi"], or in shell
+// form, which is run with "sh -c".
+func parseCommand(s string) ([]string, error) {
+	if !strings.HasPrefix(s, "[") {
+		return []string{"sh", "-c", s}, nil
+	}
+
+	var args []string
+	if err := json.Unmarshal([]byte(s), &args); err != nil {
+		return nil, fmt.Errorf("invalid exec form %s: %w", s, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	return args, nil
+}
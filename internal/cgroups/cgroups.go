@@ -1,12 +1,18 @@
 package cgroups
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/config"
 )
 
 const (
@@ -14,10 +20,42 @@ const (
 	cgroupSlice  = "system.slice"
 	cgroupPrefix = "tinydock-"
 	cgroupSuffix = ".scope"
+
+	// Remove retries rmdir with exponential backoff, waiting about 2.5s in total
+	removeRetries      = 8
+	removeInitialDelay = 10 * time.Millisecond
+)
+
+// controllers are cgroup controllers containers rely on.
+var controllers = []string{"cpu", "memory", "io", "pids"}
+
+// Supported cgroup drivers, selected by cgroupDriver in config file.
+const (
+	// DriverCgroupfs manages container cgroups by writing to cgroupfs directly.
+	DriverCgroupfs = "cgroupfs"
+
+	// DriverSystemd has systemd create a transient scope for each container.
+	DriverSystemd = "systemd"
 )
 
 // Configure initializes cgroups for a container with the given id, pid, and resource limits.
+//
+// Either driver places container in the same cgroup, so it can be inspected the
+// same way regardless of which one created it.
 func Configure(id string, pid int, cpuLimit float64, memoryLimit string) error {
+	driver, err := loadDriver()
+	if err != nil {
+		return err
+	}
+
+	if err := validateCPULimit(cpuLimit); err != nil {
+		return err
+	}
+
+	if driver == DriverSystemd {
+		return startScope(id, pid, cpuLimit, memoryLimit)
+	}
+
 	if err := create(id); err != nil {
 		return err
 	}
@@ -45,6 +83,10 @@ func Configure(id string, pid int, cpuLimit float64, memoryLimit string) error {
 func create(containerID string) error {
 	cgroupPath := filepath.Join(cgroupRoot, cgroupSlice, cgroupPrefix+containerID+cgroupSuffix)
 
+	if err := enableControllers(); err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(cgroupPath, 0755); err != nil && !os.IsExist(err) {
 		return fmt.Errorf("failed to create cgroup for container %s: %w", containerID, err)
 	}
@@ -52,6 +94,57 @@ func create(containerID string) error {
 	return nil
 }
 
+// enableControllers delegates required controllers from cgroup root down to the
+// slice containers are created in, so limits can be written to their cgroups.
+//
+// Controllers already enabled in a level's cgroup.subtree_control are left alone.
+func enableControllers() error {
+	for _, dir := range []string{cgroupRoot, filepath.Join(cgroupRoot, cgroupSlice)} {
+		if err := enableSubtreeControllers(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enableSubtreeControllers enables missing controllers for children of cgroup at dir.
+func enableSubtreeControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to read controllers of %s: %w", dir, err)
+	}
+	available := strings.Fields(string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("failed to read subtree controllers of %s: %w", dir, err)
+	}
+	enabled := strings.Fields(string(data))
+
+	var missing []string
+	for _, c := range controllers {
+		if contains(enabled, c) {
+			continue
+		}
+		if !contains(available, c) {
+			return fmt.Errorf("%s controller is not available in %s, enable it in parent cgroup or boot options", c, dir)
+		}
+		missing = append(missing, "+"+c)
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(dir, "cgroup.subtree_control")
+	if err := os.WriteFile(path, []byte(strings.Join(missing, " ")), 0644); err != nil {
+		return fmt.Errorf("failed to enable %s in %s: %w", strings.Join(missing, " "), path, err)
+	}
+
+	return nil
+}
+
 // addProcess adds container process to cgroup.
 func addProcess(containerID string, pid int) error {
 	procsPath := filepath.Join(
@@ -68,20 +161,144 @@ func addProcess(containerID string, pid int) error {
 	return nil
 }
 
+// Processes returns PIDs of all processes in container's cgroup.
+func Processes(containerID string) ([]int, error) {
+	data, err := os.ReadFile(filepath.Join(Path(containerID), "cgroup.procs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read processes for container %s: %w", containerID, err)
+	}
+
+	var pids []int
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q in cgroup.procs: %w", field, err)
+		}
+		pids = append(pids, pid)
+	}
+
+	return pids, nil
+}
+
 // Remove deletes cgroup directory after container process ends.
+//
+// Processes left in the cgroup or in nested ones are killed first. Containers
+// that never ran a process (e.g., restored from a bundle) have no cgroup, which
+// is not treated as an error.
 func Remove(containerID string) error {
-	cgroupPath := filepath.Join(cgroupSlice, cgroupPrefix+containerID+cgroupSuffix)
+	driver, err := loadDriver()
+	if err != nil {
+		return err
+	}
+
+	// Stopping scope kills its processes and has systemd remove cgroup itself
+	if driver == DriverSystemd {
+		if err := stopScope(containerID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(Path(containerID)); os.IsNotExist(err) {
+		return nil
+	}
 
-	cmd := exec.Command("cgdelete", "-g", fmt.Sprintf("cpu,memory:%s", cgroupPath))
-	if err := cmd.Run(); err != nil {
+	if err := removeTree(Path(containerID)); err != nil {
 		return fmt.Errorf("failed to remove cgroup for container %s: %w", containerID, err)
 	}
 
 	return nil
 }
 
-// setCPULimit sets CPU limit for container.
-func setCPULimit(containerID string, limit float64) error {
+// removeTree removes cgroup at dir along with nested cgroups, deepest first.
+func removeTree(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// Only nested cgroups show up as directories, interface files can't be removed
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := removeTree(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := killAll(dir); err != nil {
+		return err
+	}
+
+	// rmdir fails with EBUSY until killed processes have actually exited
+	delay := removeInitialDelay
+	for attempt := 0; ; attempt++ {
+		err := syscall.Rmdir(dir)
+		if err == nil || errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+		if !errors.Is(err, syscall.EBUSY) || attempt == removeRetries {
+			return fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// killAll sends SIGKILL to every process in cgroup at dir.
+//
+// cgroup.kill is used when kernel supports it (5.14+) as it cannot miss processes
+// forked concurrently, otherwise processes listed in cgroup.procs are killed.
+func killAll(dir string) error {
+	err := os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+	if err == nil {
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to kill processes in %s: %w", dir, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("failed to read processes in %s: %w", dir, err)
+	}
+
+	for _, field := range strings.Fields(string(data)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to kill process %d: %w", pid, err)
+		}
+	}
+
+	return nil
+}
+
+// loadDriver returns configured cgroup driver, defaulting to cgroupfs.
+func loadDriver() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+
+	switch cfg.CgroupDriver {
+	case "", DriverCgroupfs:
+		return DriverCgroupfs, nil
+	case DriverSystemd:
+		return DriverSystemd, nil
+	default:
+		return "", fmt.Errorf("unsupported cgroup driver: %s", cfg.CgroupDriver)
+	}
+}
+
+// validateCPULimit checks CPU limit does not exceed available cores.
+func validateCPULimit(limit float64) error {
 	availableCores := runtime.NumCPU()
 	if limit > float64(availableCores) {
 		return fmt.Errorf(
@@ -91,6 +308,11 @@ func setCPULimit(containerID string, limit float64) error {
 		)
 	}
 
+	return nil
+}
+
+// setCPULimit sets CPU limit for container.
+func setCPULimit(containerID string, limit float64) error {
 	cpuLimitPath := filepath.Join(
 		cgroupRoot,
 		cgroupSlice,
@@ -98,18 +320,20 @@ func setCPULimit(containerID string, limit float64) error {
 		"cpu.max",
 	)
 
-	// Convert limit to standard format
-	period := 100000
-	quota := int(limit * float64(period))
-	formattedLimit := fmt.Sprintf("%d %d", quota, period)
-
-	if err := os.WriteFile(cpuLimitPath, []byte(formattedLimit), 0644); err != nil {
+	if err := os.WriteFile(cpuLimitPath, []byte(cpuMax(limit)), 0644); err != nil {
 		return fmt.Errorf("failed to set CPU limit for container %s: %w", containerID, err)
 	}
 
 	return nil
 }
 
+// cpuMax converts CPU limit to "$MAX $PERIOD" format of cpu.max.
+func cpuMax(limit float64) string {
+	period := 100000
+	quota := int(limit * float64(period))
+	return fmt.Sprintf("%d %d", quota, period)
+}
+
 // setMemoryLimit sets memory limit for container.
 func setMemoryLimit(containerID, limit string) error {
 	memoryLimitPath := filepath.Join(
@@ -123,5 +347,45 @@ func setMemoryLimit(containerID, limit string) error {
 		return fmt.Errorf("failed to set memory limit for container %s: %w", containerID, err)
 	}
 
+	return setSwapLimit(containerID, limit)
+}
+
+// setSwapLimit allows container to swap out as much as its memory limit, so that
+// memory plus swap usage is bounded by twice the limit.
+//
+// Without swap accounting (e.g., swapaccount=0 or no CONFIG_MEMCG_SWAP), swap
+// usage of container cannot be limited, which is reported as a warning.
+func setSwapLimit(containerID, limit string) error {
+	swapLimitPath := filepath.Join(Path(containerID), "memory.swap.max")
+
+	if !hasSwapAccounting(containerID) {
+		warnNoSwapAccounting(containerID)
+		return nil
+	}
+
+	if err := os.WriteFile(swapLimitPath, []byte(limit), 0644); err != nil {
+		return fmt.Errorf("failed to set swap limit for container %s: %w", containerID, err)
+	}
+
 	return nil
 }
+
+// warnNoSwapAccounting warns that swap usage of container is not limited.
+func warnNoSwapAccounting(containerID string) {
+	log.Printf("Warning: host lacks swap accounting, container %s may use unlimited swap beyond its memory limit", containerID)
+}
+
+// hasSwapAccounting reports whether kernel accounts swap usage of container's cgroup.
+func hasSwapAccounting(containerID string) bool {
+	_, err := os.Stat(filepath.Join(Path(containerID), "memory.swap.max"))
+	return err == nil
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// Drift compares cgroup of container with given id against its init process
+// and limits it was given, returning a description of each difference.
+//
+// Memory limits are compared as kernel stores them, rounded down to page size.
+func Drift(containerID string, pid int, cpuLimit float64, memoryLimit string) ([]string, error) {
+	if _, err := os.Stat(Path(containerID)); os.IsNotExist(err) {
+		return []string{"cgroup is missing"}, nil
+	}
+
+	var drift []string
+
+	pids, err := Processes(containerID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(pids, pid) {
+		drift = append(drift, fmt.Sprintf("init process %d is not in cgroup", pid))
+	}
+
+	cpu := "max 100000"
+	if cpuLimit != 0 {
+		cpu = cpuMax(cpuLimit)
+	}
+	if d, err := driftOf(containerID, "cpu.max", cpu); err != nil {
+		return nil, err
+	} else if d != "" {
+		drift = append(drift, d)
+	}
+
+	memory := "max"
+	if memoryLimit != "" && memoryLimit != "max" {
+		limit, err := config.ParseSize(memoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		pageSize := int64(os.Getpagesize())
+		memory = strconv.FormatInt(limit/pageSize*pageSize, 10)
+	}
+	files := []string{"memory.max"}
+	if hasSwapAccounting(containerID) {
+		files = append(files, "memory.swap.max")
+	}
+	for _, file := range files {
+		if d, err := driftOf(containerID, file, memory); err != nil {
+			return nil, err
+		} else if d != "" {
+			drift = append(drift, d)
+		}
+	}
+
+	return drift, nil
+}
+
+// driftOf describes how value of a cgroup file differs from expected one, or
+// returns an empty string if it does not.
+func driftOf(containerID, file, expected string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(Path(containerID), file))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s for container %s: %w", file, containerID, err)
+	}
+
+	if actual := strings.TrimSpace(string(data)); actual != expected {
+		return fmt.Sprintf("%s is %q, expected %q", file, actual, expected), nil
+	}
+
+	return "", nil
+}
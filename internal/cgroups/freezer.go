@@ -0,0 +1,78 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Freeze waits this long for processes to stop before giving up
+	freezeTimeout  = 5 * time.Second
+	freezeInterval = 10 * time.Millisecond
+)
+
+// Freeze stops all processes of container, returning once cgroup reports them
+// frozen. Processes stay frozen until Thaw.
+func Freeze(containerID string) error {
+	if err := writeFreeze(containerID, "1"); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		frozen, err := Frozen(containerID)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if err := writeFreeze(containerID, "0"); err != nil {
+				return err
+			}
+			return fmt.Errorf("timed out freezing container %s", containerID)
+		}
+
+		time.Sleep(freezeInterval)
+	}
+}
+
+// Thaw resumes processes of container stopped by Freeze.
+func Thaw(containerID string) error {
+	return writeFreeze(containerID, "0")
+}
+
+// Frozen reports whether all processes of container are frozen.
+func Frozen(containerID string) (bool, error) {
+	f, err := os.Open(filepath.Join(Path(containerID), "cgroup.events"))
+	if err != nil {
+		return false, fmt.Errorf("failed to read cgroup events for container %s: %w", containerID, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "frozen "); ok {
+			return value == "1", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("failed to read cgroup events for container %s: %w", containerID, err)
+	}
+
+	return false, fmt.Errorf("cgroup of container %s does not support freezing", containerID)
+}
+
+// writeFreeze writes value to cgroup.freeze of container.
+func writeFreeze(containerID, value string) error {
+	if err := os.WriteFile(filepath.Join(Path(containerID), "cgroup.freeze"), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set freeze state of container %s: %w", containerID, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plan describes steps Configure would take for a container with given id and
+// resource limits, without changing anything.
+func Plan(id string, cpuLimit float64, memoryLimit string) ([]string, error) {
+	driver, err := loadDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCPULimit(cpuLimit); err != nil {
+		return nil, err
+	}
+
+	if driver == DriverSystemd {
+		props, err := scopeProperties(id, "<pid>", cpuLimit, memoryLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		steps := []string{fmt.Sprintf("call systemd StartTransientUnit %s with properties:", scopeName(id))}
+		for _, p := range props {
+			steps = append(steps, fmt.Sprintf("  %s=%s", p[0], strings.Join(p[2:], " ")))
+		}
+		return append(steps, fmt.Sprintf("wait for systemd to create %s", Path(id))), nil
+	}
+
+	var steps []string
+	for _, dir := range []string{cgroupRoot, filepath.Join(cgroupRoot, cgroupSlice)} {
+		steps = append(steps, fmt.Sprintf("ensure +%s enabled in %s",
+			strings.Join(controllers, " +"), filepath.Join(dir, "cgroup.subtree_control")))
+	}
+
+	dir := Path(id)
+	steps = append(steps,
+		fmt.Sprintf("mkdir %s", dir),
+		fmt.Sprintf("write <pid> to %s", filepath.Join(dir, "cgroup.procs")),
+	)
+
+	if memoryLimit != "" {
+		steps = append(steps, fmt.Sprintf("write %s to %s", memoryLimit, filepath.Join(dir, "memory.max")))
+
+		// Container cgroup does not exist yet, parent has same swap files if accounted
+		if _, err := os.Stat(filepath.Join(cgroupRoot, cgroupSlice, "memory.swap.max")); err == nil {
+			steps = append(steps, fmt.Sprintf("write %s to %s", memoryLimit, filepath.Join(dir, "memory.swap.max")))
+		} else {
+			steps = append(steps, "warn that swap is not limited as host lacks swap accounting")
+		}
+	}
+
+	if cpuLimit != 0 {
+		steps = append(steps, fmt.Sprintf("write %q to %s", cpuMax(cpuLimit), filepath.Join(dir, "cpu.max")))
+	}
+
+	return steps, nil
+}
@@ -0,0 +1,231 @@
+package cgroups
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Stats represents a snapshot of resource usage of a container cgroup.
+type Stats struct {
+	// CPUUsage is total CPU time consumed in microseconds.
+	CPUUsage uint64
+
+	// MemoryUsage is current memory usage in bytes.
+	MemoryUsage uint64
+
+	// MemoryLimit is memory limit in bytes, or 0 if unlimited.
+	MemoryLimit uint64
+
+	// SwapUsage is current swap usage in bytes, left zero without swap accounting.
+	SwapUsage uint64
+
+	// PIDs is number of processes in cgroup.
+	PIDs uint64
+
+	// IORead and IOWrite are total bytes read from and written to block devices,
+	// left zero if io controller is not enabled.
+	IORead  uint64
+	IOWrite uint64
+
+	// CPUPressure, MemoryPressure and IOPressure are stall information from PSI,
+	// left zero if kernel does not expose pressure files.
+	CPUPressure    Pressure
+	MemoryPressure Pressure
+	IOPressure     Pressure
+}
+
+// Pressure holds 10 second averages of pressure stall information as percentages.
+//
+// Some is share of time at least one task was stalled on the resource, and Full
+// is share of time all non-idle tasks were stalled simultaneously.
+type Pressure struct {
+	Some float64
+	Full float64
+}
+
+// ReadStats samples resource usage of container with given id from its cgroup.
+func ReadStats(containerID string) (*Stats, error) {
+	dir := Path(containerID)
+
+	cpuStat, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CPU stats for container %s: %w", containerID, err)
+	}
+
+	memoryUsage, err := readUint(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory usage for container %s: %w", containerID, err)
+	}
+
+	memoryLimit, err := readUint(filepath.Join(dir, "memory.max"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory limit for container %s: %w", containerID, err)
+	}
+
+	swapUsage, err := readUint(filepath.Join(dir, "memory.swap.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read swap usage for container %s: %w", containerID, err)
+	}
+
+	pids, err := readUint(filepath.Join(dir, "pids.current"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read process count for container %s: %w", containerID, err)
+	}
+
+	ioRead, ioWrite, err := readIOStat(filepath.Join(dir, "io.stat"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read IO stats for container %s: %w", containerID, err)
+	}
+
+	stats := &Stats{
+		CPUUsage:    cpuStat["usage_usec"],
+		MemoryUsage: memoryUsage,
+		MemoryLimit: memoryLimit,
+		SwapUsage:   swapUsage,
+		PIDs:        pids,
+		IORead:      ioRead,
+		IOWrite:     ioWrite,
+	}
+
+	for file, p := range map[string]*Pressure{
+		"cpu.pressure":    &stats.CPUPressure,
+		"memory.pressure": &stats.MemoryPressure,
+		"io.pressure":     &stats.IOPressure,
+	} {
+		if err := readPressure(filepath.Join(dir, file), p); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read %s for container %s: %w", file, containerID, err)
+		}
+	}
+
+	return stats, nil
+}
+
+// Path returns cgroup directory of container with given id.
+func Path(containerID string) string {
+	return filepath.Join(cgroupRoot, cgroupSlice, cgroupPrefix+containerID+cgroupSuffix)
+}
+
+// readUint reads a single value cgroup file, treating "max" as 0.
+func readUint(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(value, 10, 64)
+}
+
+// readKeyValues reads a flat keyed cgroup file such as cpu.stat.
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		values[fields[0]] = v
+	}
+
+	return values, scanner.Err()
+}
+
+// readIOStat sums bytes read and written over all devices listed in io.stat,
+// e.g.:
+//
+//	8:0 rbytes=90112 wbytes=4096 rios=5 wios=1 dbytes=0 dios=0
+func readIOStat(path string) (read, write uint64, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		for _, field := range strings.Fields(line) {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				continue
+			}
+
+			switch key {
+			case "rbytes":
+				read += n
+			case "wbytes":
+				write += n
+			}
+		}
+	}
+
+	return read, write, nil
+}
+
+// HostMemoryPressure reads memory pressure of whole host.
+func HostMemoryPressure() (Pressure, error) {
+	var p Pressure
+	if err := readPressure("/proc/pressure/memory", &p); err != nil {
+		return p, fmt.Errorf("failed to read host memory pressure: %w", err)
+	}
+
+	return p, nil
+}
+
+// readPressure parses avg10 values of a PSI file such as memory.pressure, e.g.:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func readPressure(path string, p *Pressure) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		avg, ok := strings.CutPrefix(fields[1], "avg10=")
+		if !ok {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(avg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid pressure value %q: %w", avg, err)
+		}
+
+		switch fields[0] {
+		case "some":
+			p.Some = v
+		case "full":
+			p.Full = v
+		}
+	}
+
+	return nil
+}
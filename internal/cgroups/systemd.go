@@ -0,0 +1,122 @@
+package cgroups
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+const (
+	systemdDest      = "org.freedesktop.systemd1"
+	systemdPath      = "/org/freedesktop/systemd1"
+	systemdInterface = "org.freedesktop.systemd1.Manager"
+
+	// scopeTimeout bounds wait for systemd to create scope cgroup
+	scopeTimeout = time.Second
+)
+
+// startScope asks systemd to create a transient scope for container through
+// D-Bus StartTransientUnit, moving pid into it and applying resource limits as
+// unit properties.
+//
+// Scope is named after container and placed in the same slice as with cgroupfs
+// driver, so it shows up in 'systemctl status tinydock-<id>.scope'.
+func startScope(containerID string, pid int, cpuLimit float64, memoryLimit string) error {
+	props, err := scopeProperties(containerID, strconv.Itoa(pid), cpuLimit, memoryLimit)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"StartTransientUnit", "ssa(sv)a(sa(sv))", scopeName(containerID), "fail", strconv.Itoa(len(props))}
+	for _, p := range props {
+		args = append(args, p...)
+	}
+	// No auxiliary units
+	args = append(args, "0")
+
+	if err := callSystemd(args...); err != nil {
+		return fmt.Errorf("failed to start scope for container %s: %w", containerID, err)
+	}
+
+	// Unit job runs asynchronously, wait for cgroup so it can be read right away
+	deadline := time.Now().Add(scopeTimeout)
+	for {
+		if _, err := os.Stat(Path(containerID)); err == nil {
+			if memoryLimit != "" && !hasSwapAccounting(containerID) {
+				warnNoSwapAccounting(containerID)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for scope of container %s", containerID)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// scopeProperties returns D-Bus properties of container's scope as busctl
+// name, signature and value arguments.
+func scopeProperties(containerID, pid string, cpuLimit float64, memoryLimit string) ([][]string, error) {
+	props := [][]string{
+		{"Description", "s", "tinydock container " + containerID},
+		{"Slice", "s", cgroupSlice},
+		{"Delegate", "b", "true"},
+		{"PIDs", "au", "1", pid},
+		{"CPUAccounting", "b", "true"},
+		{"MemoryAccounting", "b", "true"},
+		{"IOAccounting", "b", "true"},
+		{"TasksAccounting", "b", "true"},
+	}
+
+	if cpuLimit != 0 {
+		quota := uint64(cpuLimit * float64(time.Second/time.Microsecond))
+		props = append(props, []string{"CPUQuotaPerSecUSec", "t", strconv.FormatUint(quota, 10)})
+	}
+
+	if memoryLimit != "" && memoryLimit != "max" {
+		limit, err := config.ParseSize(memoryLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		props = append(props,
+			[]string{"MemoryMax", "t", strconv.FormatInt(limit, 10)},
+			[]string{"MemorySwapMax", "t", strconv.FormatInt(limit, 10)},
+		)
+	}
+
+	return props, nil
+}
+
+// stopScope asks systemd to stop container's scope, which kills its remaining
+// processes. Scopes that are already gone are ignored.
+func stopScope(containerID string) error {
+	err := callSystemd("StopUnit", "ss", scopeName(containerID), "fail")
+	if err != nil && !strings.Contains(err.Error(), "not loaded") {
+		return fmt.Errorf("failed to stop scope for container %s: %w", containerID, err)
+	}
+
+	return nil
+}
+
+// callSystemd invokes a method of systemd manager with busctl.
+func callSystemd(args ...string) error {
+	cmd := exec.Command("busctl", append([]string{"call", systemdDest, systemdPath, systemdInterface}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if len(out) == 0 {
+			return err
+		}
+		return fmt.Errorf("%s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// scopeName returns systemd unit name of container's scope.
+func scopeName(containerID string) string {
+	return cgroupPrefix + containerID + cgroupSuffix
+}
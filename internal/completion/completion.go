@@ -0,0 +1,257 @@
+// Package completion generates shell completion scripts from the command tree.
+//
+// Subcommands and flags are completed statically. Containers, images and
+// networks are listed at completion time by running the hidden HelperCommand.
+package completion
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// HelperCommand is hidden command printing candidates of a kind, one per line.
+const HelperCommand = "__complete"
+
+// Kinds of candidates listed by HelperCommand.
+const (
+	Containers = "containers"
+	Images     = "images"
+	Networks   = "networks"
+)
+
+// Shells lists shells completion scripts can be written for.
+var Shells = []string{"bash", "zsh", "fish"}
+
+// command describes a command of the tree for completion.
+type command struct {
+	path        string
+	help        string
+	subcommands []*command
+	boolFlags   []*flag.Flag
+	valueFlags  []*flag.Flag
+	args        string
+	flagArgs    map[string]string
+}
+
+// Write writes completion script for shell, covering all commands of root.
+//
+// kinds maps command paths (e.g. "tinydock stop") to kind of their arguments,
+// and command paths followed by a flag (e.g. "tinydock run -network") to kind
+// of its value. Values of other flags are completed as files.
+func Write(w io.Writer, shell string, root *ffcli.Command, kinds map[string]string) error {
+	tree := walk(root, "", kinds)
+
+	switch shell {
+	case "bash":
+		writeBash(w, tree)
+	case "zsh":
+		// zsh runs bash completion functions through its compatibility layer
+		fmt.Fprintln(w, "autoload -U +X bashcompinit && bashcompinit")
+		writeBash(w, tree)
+	case "fish":
+		writeFish(w, tree)
+	default:
+		return fmt.Errorf("unsupported shell %q: expect one of %s", shell, strings.Join(Shells, ", "))
+	}
+
+	return nil
+}
+
+// walk describes c and its subcommands, c being named under parent path prefix.
+func walk(c *ffcli.Command, prefix string, kinds map[string]string) *command {
+	path := c.Name
+	if prefix != "" {
+		path = prefix + " " + c.Name
+	}
+
+	cmd := &command{
+		path:     path,
+		help:     c.ShortHelp,
+		args:     kinds[path],
+		flagArgs: make(map[string]string),
+	}
+
+	if c.FlagSet != nil {
+		c.FlagSet.VisitAll(func(f *flag.Flag) {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				cmd.boolFlags = append(cmd.boolFlags, f)
+				return
+			}
+			cmd.valueFlags = append(cmd.valueFlags, f)
+			if kind := kinds[path+" -"+f.Name]; kind != "" {
+				cmd.flagArgs[f.Name] = kind
+			}
+		})
+	}
+
+	for _, sub := range c.Subcommands {
+		cmd.subcommands = append(cmd.subcommands, walk(sub, path, kinds))
+	}
+
+	return cmd
+}
+
+// all returns c and all commands below it.
+func (c *command) all() []*command {
+	cmds := []*command{c}
+	for _, sub := range c.subcommands {
+		cmds = append(cmds, sub.all()...)
+	}
+	return cmds
+}
+
+// name returns last word of command path.
+func (c *command) name() string {
+	return c.path[strings.LastIndex(c.path, " ")+1:]
+}
+
+func flagNames(flags []*flag.Flag) string {
+	names := make([]string, len(flags))
+	for i, f := range flags {
+		names[i] = "-" + f.Name
+	}
+	return strings.Join(names, " ")
+}
+
+func writeBash(w io.Writer, root *command) {
+	fn := "_" + root.name()
+	cmds := root.all()
+
+	var paths []string
+	for _, c := range cmds[1:] {
+		paths = append(paths, fmt.Sprintf("%q", c.path))
+	}
+
+	fmt.Fprintf(w, `%s() {
+    local cur prev words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n : cur prev words cword
+    else
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+        cur="${words[cword]}"
+        prev="${words[cword-1]}"
+    fi
+
+    local path=%q word i
+    for ((i = 1; i < cword; i++)); do
+        word="${words[i]}"
+        case "$path $word" in
+            %s) path="$path $word" ;;
+        esac
+    done
+
+    local subcommands="" flags="" valueflags="" args=""
+    case "$path" in
+`, fn, root.path, strings.Join(paths, "|"))
+
+	for _, c := range cmds {
+		var subs []string
+		for _, sub := range c.subcommands {
+			subs = append(subs, sub.name())
+		}
+		fmt.Fprintf(w, "        %q) subcommands=%q flags=%q valueflags=%q args=%q ;;\n",
+			c.path, strings.Join(subs, " "), flagNames(c.boolFlags), flagNames(c.valueFlags), c.args)
+	}
+
+	fmt.Fprintf(w, `    esac
+
+    if [[ " $valueflags " == *" $prev "* ]]; then
+        case "$path $prev" in
+`)
+	for _, c := range cmds {
+		names := make([]string, 0, len(c.flagArgs))
+		for name := range c.flagArgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "            %q) COMPREPLY=($(compgen -W \"$(\"${words[0]}\" %s %s 2>/dev/null)\" -- \"$cur\")) ;;\n",
+				c.path+" -"+name, HelperCommand, c.flagArgs[name])
+		}
+	}
+	fmt.Fprintf(w, `            *) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        esac
+        return
+    fi
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags $valueflags" -- "$cur"))
+        return
+    fi
+
+    local candidates="$subcommands"
+    if [[ -n "$args" ]]; then
+        candidates="$candidates $("${words[0]}" %s "$args" 2>/dev/null)"
+    fi
+    COMPREPLY=($(compgen -W "$candidates" -- "$cur"))
+
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+
+complete -F %s %s
+`, HelperCommand, fn, root.name())
+}
+
+// fishQuote quotes s as a single-quoted fish string.
+func fishQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
+
+func writeFish(w io.Writer, root *command) {
+	name := root.name()
+	pathFn := "__" + name + "_path"
+	cmds := root.all()
+
+	var paths []string
+	for _, c := range cmds[1:] {
+		paths = append(paths, fishQuote(c.path))
+	}
+
+	fmt.Fprintf(w, `set -g %s_commands %s
+
+function %s
+    set -l path %s
+    for word in (commandline -opc)[2..-1]
+        if contains -- "$path $word" $%s_commands
+            set path "$path $word"
+        end
+    end
+    echo $path
+end
+
+complete -c %s -e
+complete -c %s -f
+`, pathFn, strings.Join(paths, " "), pathFn, fishQuote(root.path), pathFn, name, name)
+
+	for _, c := range cmds {
+		cond := fishQuote(fmt.Sprintf("test (%s) = %s", pathFn, fishQuote(c.path)))
+
+		for _, sub := range c.subcommands {
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s -d %s\n", name, cond, sub.name(), fishQuote(sub.help))
+		}
+		for _, f := range c.boolFlags {
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s -d %s\n", name, cond, f.Name, fishQuote(f.Usage))
+		}
+		for _, f := range c.valueFlags {
+			values := "-F"
+			if kind := c.flagArgs[f.Name]; kind != "" {
+				values = "-a " + fishQuote(fmt.Sprintf("(%s %s %s 2>/dev/null)", name, HelperCommand, kind))
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s -o %s -r %s -d %s\n", name, cond, f.Name, values, fishQuote(f.Usage))
+		}
+		if c.args != "" {
+			fmt.Fprintf(w, "complete -c %s -n %s -a %s\n", name, cond,
+				fishQuote(fmt.Sprintf("(%s %s %s 2>/dev/null)", name, HelperCommand, c.args)))
+		}
+	}
+}
@@ -1,6 +1,199 @@
 package config
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultRoot is root directory for all tinydock resources unless another one
+// is selected with SetRoot.
+const DefaultRoot = "/var/lib/tinydock"
+
+// RootEnv names environment variable selecting root directory, as global -root
+// flag does.
+const RootEnv = "TINYDOCK_ROOT"
+
+// root is root directory for all tinydock resources.
+var root = DefaultRoot
+
+// Root returns root directory for all tinydock resources. Packages derive paths
+// of their resources from it whenever they use them, and nothing is created
+// under it until then.
+func Root() string {
+	return root
+}
+
+// SetRoot points every package at another root directory, e.g. to run several
+// instances on one host or tests in isolation. Resources already opened, such
+// as locks, stay under previous one.
+//
+// NOTE: Cgroups, bridges and iptables rules are host-wide, so instances sharing
+// a host must not use the same network names.
+func SetRoot(dir string) error {
+	if dir == "" {
+		return fmt.Errorf("root directory must not be empty")
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+	root = abs
+
+	return nil
+}
+
+// File returns path of optional configuration file, defaults apply if it is
+// missing.
+func File() string {
+	return filepath.Join(root, "config.json")
+}
+
+// Config holds user settings read from File.
+type Config struct {
+	// ImageCacheLimit caps total size of extracted images, 0 for no limit.
+	ImageCacheLimit Size `json:"imageCacheLimit"`
+
+	// CgroupDriver selects how container cgroups are managed, either "cgroupfs"
+	// (default) or "systemd".
+	CgroupDriver string `json:"cgroupDriver"`
+
+	// Admission decides what happens when a container with resource limits
+	// would oversubscribe host, see Admission* constants.
+	Admission string `json:"admission"`
+
+	// OvercommitRatio scales host CPUs and memory that container limits may
+	// add up to before host is considered oversubscribed, 1 if unset.
+	OvercommitRatio float64 `json:"overcommitRatio"`
+
+	// Compression selects compressor of image tarballs written to store, either
+	// "gzip" (default) or "zstd".
+	Compression string `json:"compression"`
+
+	// Profiles are named resource limits selectable with run -profile.
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// Profile is a named set of resource limits, in the format of run -c and -m.
+type Profile struct {
+	CPU    float64 `json:"cpu"`
+	Memory string  `json:"memory"`
+}
+
+// Profile returns resource profile with given name.
+func (c *Config) Profile(name string) (Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("resource profile %q not found in %s", name, File())
+	}
+	return p, nil
+}
+
+// Admission policies.
 const (
-	// Root directory for all tinydock resources
-	Root = "/var/lib/tinydock"
+	// AdmissionOff starts containers regardless of host capacity.
+	AdmissionOff = ""
+
+	// AdmissionWarn starts containers but warns when host is oversubscribed.
+	AdmissionWarn = "warn"
+
+	// AdmissionRefuse refuses to start containers that would oversubscribe host.
+	AdmissionRefuse = "refuse"
 )
+
+// Image tarball compressors.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// Load reads configuration from File.
+func Load() (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(File())
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", File(), err)
+	}
+
+	switch cfg.Admission {
+	case AdmissionOff, AdmissionWarn, AdmissionRefuse:
+	default:
+		return nil, fmt.Errorf("invalid admission policy %q: expect %s or %s", cfg.Admission, AdmissionWarn, AdmissionRefuse)
+	}
+
+	switch cfg.Compression {
+	case "", CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf("invalid compression %q: expect %s or %s", cfg.Compression, CompressionGzip, CompressionZstd)
+	}
+
+	for name, p := range cfg.Profiles {
+		if p.CPU < 0 {
+			return nil, fmt.Errorf("invalid CPU limit %v in profile %q", p.CPU, name)
+		}
+		if p.Memory != "" && p.Memory != "max" {
+			if _, err := ParseSize(p.Memory); err != nil {
+				return nil, fmt.Errorf("invalid memory limit in profile %q: %w", name, err)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+// Size is a byte count that can be written in JSON either as a number or as a
+// string with an optional binary unit suffix (e.g., "512m", "10g").
+type Size int64
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Size) UnmarshalJSON(data []byte) error {
+	var n int64
+	if err := json.Unmarshal(data, &n); err == nil {
+		*s = Size(n)
+		return nil
+	}
+
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("invalid size %s", data)
+	}
+
+	n, err := ParseSize(str)
+	if err != nil {
+		return err
+	}
+	*s = Size(n)
+
+	return nil
+}
+
+// ParseSize parses a byte count with an optional k, m, g or t suffix.
+func ParseSize(str string) (int64, error) {
+	s := strings.ToLower(strings.TrimSpace(str))
+	s = strings.TrimSuffix(s, "b")
+
+	multiplier := int64(1)
+	if i := strings.IndexAny(s, "kmgt"); i >= 0 && i == len(s)-1 {
+		multiplier = 1 << (10 * (strings.IndexByte("kmgt", s[i]) + 1))
+		s = s[:i]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", str)
+	}
+
+	return n * multiplier, nil
+}
@@ -0,0 +1,143 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// checkAdmission verifies host can accommodate a container with given limits on
+// top of limits of running containers, as configured by admission policy.
+//
+// Host is considered oversubscribed when summed limits exceed its CPUs or total
+// memory times configured overcommit ratio, or when memory limit exceeds memory
+// currently available. Containers without limits reserve nothing.
+func checkAdmission(cpuLimit float64, memoryLimit string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	if cfg.Admission == config.AdmissionOff || (cpuLimit == 0 && memoryLimit == "") {
+		return nil
+	}
+
+	ratio := cfg.OvercommitRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+
+	memory, err := parseMemoryLimit(memoryLimit)
+	if err != nil {
+		return err
+	}
+
+	infos, err := loadAllInfo()
+	if err != nil {
+		return err
+	}
+
+	var reservedCPU float64
+	var reservedMemory int64
+	for _, info := range infos {
+		if !info.Status.active() {
+			continue
+		}
+		reservedCPU += info.CPULimit
+
+		// Limits were validated when container was created
+		m, _ := parseMemoryLimit(info.MemoryLimit)
+		reservedMemory += m
+	}
+
+	var errs []error
+
+	if cpuLimit > 0 {
+		capacity := float64(runtime.NumCPU()) * ratio
+		if reservedCPU+cpuLimit > capacity {
+			errs = append(errs, fmt.Errorf("CPU reservations would reach %.2f of %.2f allowed", reservedCPU+cpuLimit, capacity))
+		}
+	}
+
+	if memory > 0 {
+		total, available, err := readMemInfo()
+		if err != nil {
+			return err
+		}
+
+		capacity := int64(float64(total) * ratio)
+		if reservedMemory+memory > capacity {
+			errs = append(errs, fmt.Errorf("memory reservations would reach %s of %s allowed",
+				formatBytes(uint64(reservedMemory+memory)), formatBytes(uint64(capacity))))
+		}
+		if memory > available {
+			errs = append(errs, fmt.Errorf("memory limit %s exceeds %s currently available",
+				formatBytes(uint64(memory)), formatBytes(uint64(available))))
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	err = fmt.Errorf("host would be oversubscribed:\n%w", errors.Join(errs...))
+	if cfg.Admission == config.AdmissionWarn {
+		log.Printf("Warning: %v", err)
+		return nil
+	}
+
+	return err
+}
+
+// parseMemoryLimit converts memory limit given to -m into bytes, 0 if unlimited.
+func parseMemoryLimit(limit string) (int64, error) {
+	if limit == "" || limit == "max" {
+		return 0, nil
+	}
+
+	n, err := config.ParseSize(limit)
+	if err != nil {
+		return 0, fmt.Errorf("invalid memory limit: %w", err)
+	}
+
+	return n, nil
+}
+
+// readMemInfo returns total and available host memory in bytes.
+func readMemInfo() (total, available int64, err error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read meminfo: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g., "MemTotal:       16318412 kB"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb * 1024
+		case "MemAvailable:":
+			available = kb * 1024
+		}
+	}
+
+	return total, available, scanner.Err()
+}
@@ -0,0 +1,282 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Streams of container output sent to attached clients, each chunk framed by
+// its stream and length.
+const (
+	streamStdout byte = 1
+	streamStderr byte = 2
+)
+
+// attachWriteTimeout is how long an attached client may block container output
+// before it is dropped.
+const attachWriteTimeout = time.Second
+
+// attachSocketPath returns path of socket shim of container serves attach on.
+func attachSocketPath(id string) string {
+	return filepath.Join(containerDir(), id, "attach.sock")
+}
+
+// stdio holds standard streams of a detached container for its shim. Output is
+// copied to log and any attached clients. Input of clients is copied to
+// container if its stdin is kept open, which it stays while no client is
+// attached, so container does not see EOF.
+type stdio struct {
+	output   io.Writer
+	listener net.Listener // nil if clients cannot attach
+
+	// Ends of pipes given to container, closed by shim once it is started
+	stdin, stdout, stderr *os.File
+
+	stdinWriter  *os.File // nil unless stdin is kept open
+	stdoutReader *os.File
+	stderrReader *os.File
+
+	mu      sync.Mutex
+	clients map[net.Conn]bool
+	copying sync.WaitGroup
+}
+
+// openStdio creates pipes for standard streams of container with given id and
+// socket for clients to attach on. Output is copied to output as well. Without
+// openStdin, container reads stdin from /dev/null.
+//
+// Attach is optional, so container is run anyway if socket cannot be created,
+// e.g. as its path is too long under a deep root directory.
+func openStdio(id string, output io.Writer, openStdin bool) (*stdio, error) {
+	s := &stdio{output: output, clients: map[net.Conn]bool{}}
+
+	var err error
+	if openStdin {
+		s.stdin, s.stdinWriter, err = os.Pipe()
+	} else {
+		s.stdin, err = os.Open(os.DevNull)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin: %w", err)
+	}
+	if s.stdoutReader, s.stdout, err = os.Pipe(); err != nil {
+		s.closePipes()
+		return nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	if s.stderrReader, s.stderr, err = os.Pipe(); err != nil {
+		s.closePipes()
+		return nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	// Socket is left behind by shim killed along with its container
+	path := attachSocketPath(id)
+	os.Remove(path)
+	if s.listener, err = net.Listen("unix", path); err != nil {
+		log.Printf("Failed to listen for attach, container cannot be attached to: %v", err)
+		s.listener = nil
+	}
+
+	return s, nil
+}
+
+// connect makes cmd use pipes as its standard streams.
+func (s *stdio) connect(cmd *exec.Cmd) {
+	cmd.Stdin = s.stdin
+	cmd.Stdout = s.stdout
+	cmd.Stderr = s.stderr
+}
+
+// serve closes ends of pipes passed on to started container, then copies its
+// output and accepts clients until closed.
+func (s *stdio) serve() {
+	s.stdin.Close()
+	s.stdout.Close()
+	s.stderr.Close()
+
+	s.copying.Add(2)
+	go s.copyOutput(streamStdout, s.stdoutReader)
+	go s.copyOutput(streamStderr, s.stderrReader)
+
+	if s.listener == nil {
+		return
+	}
+
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+
+			s.mu.Lock()
+			if s.clients == nil {
+				s.mu.Unlock()
+				conn.Close()
+				return
+			}
+			s.clients[conn] = true
+			s.mu.Unlock()
+
+			// Input of client ends with it, stdin of container stays open
+			if s.stdinWriter != nil {
+				go io.Copy(s.stdinWriter, conn)
+			} else {
+				go io.Copy(io.Discard, conn)
+			}
+		}
+	}()
+}
+
+// copyOutput copies a stream of container output to log and clients until
+// every process of container holding it exits.
+func (s *stdio) copyOutput(stream byte, r io.Reader) {
+	defer s.copying.Done()
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.broadcast(stream, buf[:n])
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// broadcast writes a chunk of output to log and to each client, dropping those
+// failing to keep up.
+func (s *stdio) broadcast(stream byte, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.output.Write(data); err != nil {
+		log.Printf("Failed to write container log: %v", err)
+	}
+
+	frame := make([]byte, 5, 5+len(data))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	for conn := range s.clients {
+		conn.SetWriteDeadline(time.Now().Add(attachWriteTimeout))
+		if _, err := conn.Write(frame); err != nil {
+			conn.Close()
+			delete(s.clients, conn)
+		}
+	}
+}
+
+// close stops accepting clients and, once all output is copied, disconnects
+// those attached.
+func (s *stdio) close() {
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	s.copying.Wait()
+
+	s.mu.Lock()
+	for conn := range s.clients {
+		conn.Close()
+	}
+	s.clients = nil
+	s.mu.Unlock()
+
+	s.closePipes()
+}
+
+// closePipes closes ends of pipes kept by shim.
+func (s *stdio) closePipes() {
+	for _, f := range []*os.File{s.stdin, s.stdout, s.stderr, s.stdinWriter, s.stdoutReader, s.stderrReader} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// Attach connects standard streams of terminal to those of a running detached
+// container, until container exits or user detaches with Ctrl-C. Container keeps
+// running once detached, and its stdin stays open after EOF of terminal. Input
+// of terminal is only passed on if container was run with stdin kept open.
+func Attach(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if !info.Status.active() || syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id) {
+		return fmt.Errorf("container is not running")
+	}
+	if info.ShimPID == 0 {
+		return fmt.Errorf("container was not started detached, its streams are not held by a shim")
+	}
+
+	conn, err := net.Dial("unix", attachSocketPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer conn.Close()
+
+	if info.OpenStdin {
+		go func() {
+			io.Copy(conn, os.Stdin)
+			conn.(*net.UnixConn).CloseWrite()
+		}()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- readOutput(conn)
+	}()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case err := <-done:
+		return err
+	case <-sigs:
+		return nil
+	}
+}
+
+// readOutput writes output of container received from its shim to streams of
+// terminal it was framed for, until shim disconnects.
+func readOutput(r io.Reader) error {
+	var header [5]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read container output: %w", err)
+		}
+
+		w := os.Stdout
+		if header[0] == streamStderr {
+			w = os.Stderr
+		}
+
+		if _, err := io.CopyN(w, r, int64(binary.BigEndian.Uint32(header[1:]))); err != nil {
+			return fmt.Errorf("failed to read container output: %w", err)
+		}
+	}
+}
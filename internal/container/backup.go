@@ -0,0 +1,362 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+const (
+	backupVersion    = 1
+	backupManifest   = "backup.json"
+	backupUpperDir   = "upper"
+	backupVolumesDir = "volumes"
+)
+
+// backup describes a container captured in a backup archive, along with its
+// writable layer and contents of its volumes, stored by index under
+// backupVolumesDir.
+type backup struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Container *Info     `json:"container"`
+}
+
+// Backup archives settings, writable layer and volume contents of a container
+// into a single tar file at output, compressed as its suffix suggests, e.g.
+// ".tar.zst" or ".tar.gz".
+//
+// A running container is frozen until its files are captured, so they are
+// consistent with each other. Volumes shared with host or other containers may
+// still be written by them meanwhile.
+func Backup(id, output string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	upperDir := overlay.UpperDir(id)
+	if _, err := os.Stat(upperDir); err != nil {
+		return fmt.Errorf("container filesystem not found: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tinydock-backup-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	var staged []string
+	defer func() {
+		for _, target := range staged {
+			if err := syscall.Unmount(target, syscall.MNT_DETACH); err != nil {
+				// Removing directory would reach into volume still mounted
+				log.Printf("Failed to unmount %s, leaving %s in place: %v", target, tmpDir, err)
+				return
+			}
+		}
+		os.RemoveAll(tmpDir)
+	}()
+
+	// Volumes are bind mounted under their index, so sources with same name
+	// do not clash in archive
+	volumesDir := filepath.Join(tmpDir, backupVolumesDir)
+	if err := os.Mkdir(volumesDir, 0755); err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	for i, v := range info.Volumes {
+		target := filepath.Join(volumesDir, strconv.Itoa(i))
+		if err := stageVolume(v.Source, target); err != nil {
+			return err
+		}
+		staged = append(staged, target)
+	}
+
+	if info.Status == Running && syscall.Kill(info.PID, 0) == nil && verifyProcess(info.PID, id) {
+		if err := cgroups.Freeze(id); err != nil {
+			return fmt.Errorf("failed to freeze container: %w", err)
+		}
+		defer func() {
+			if err := cgroups.Thaw(id); err != nil {
+				log.Printf("Failed to resume container %s: %v", id, err)
+			}
+		}()
+	}
+
+	data, err := json.MarshalIndent(backup{
+		Version:   backupVersion,
+		CreatedAt: time.Now(),
+		Container: info,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, backupManifest), data, 0600); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	// Backup holds environment of container, which may carry secrets, so it is
+	// readable by its owner only. tar keeps mode of an existing file.
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	f.Close()
+	if err := os.Chmod(output, 0600); err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	// Keep overlay xattrs so opaque directories survive the round trip, and
+	// numeric owners as users of container are not those of host
+	cmd := exec.Command("tar", "caf", output,
+		"--xattrs", "--xattrs-include=trusted.overlay.*", "--numeric-owner",
+		"-C", tmpDir, backupManifest, backupVolumesDir,
+		"-C", filepath.Dir(upperDir), backupUpperDir,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to create backup: %s", out)
+	}
+
+	return nil
+}
+
+// stageVolume bind mounts volume source read-only at target, created as a file
+// or directory to match it.
+func stageVolume(source, target string) error {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("volume source not found: %w", err)
+	}
+
+	if fi.IsDir() {
+		err = os.Mkdir(target, 0755)
+	} else {
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create mount point for volume %s: %w", source, err)
+	}
+
+	if err := syscall.Mount(source, target, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to mount volume %s: %w", source, err)
+	}
+
+	flags := syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY
+	if err := syscall.Mount(source, target, "", uintptr(flags), ""); err != nil {
+		syscall.Unmount(target, syscall.MNT_DETACH)
+		return fmt.Errorf("failed to remount volume %s read-only: %w", source, err)
+	}
+
+	return nil
+}
+
+// RestoreBackup re-creates a container from a backup archive, along with its
+// volumes, and returns its ID.
+//
+// The container is restored in exited state on top of its original image, which
+// must be available locally, and keeps its settings, so start runs it as before.
+// Volume contents are restored to their original sources, under volumeRoot if
+// given, which must not exist yet or be empty. Its name is kept if still free.
+func RestoreBackup(input, volumeRoot string) (string, error) {
+	if err := os.MkdirAll(containerDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create containers directory: %w", err)
+	}
+
+	// Extract next to final location so writable layer can be moved with rename
+	tmpDir, err := os.MkdirTemp(containerDir(), ".restore-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command("tar", "xf", input,
+		"--xattrs", "--xattrs-include=trusted.overlay.*", "--numeric-owner",
+		"-C", tmpDir,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract backup: %s", out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, backupManifest))
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+
+	var b backup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return "", fmt.Errorf("failed to unmarshal backup manifest: %w", err)
+	}
+	if b.Version != backupVersion {
+		return "", fmt.Errorf("unsupported backup version: %d", b.Version)
+	}
+	info := b.Container
+
+	if digest, err := overlay.ImageDigest(info.Image); err != nil {
+		return "", err
+	} else if digest != info.ImageDigest {
+		log.Printf("Image '%s' has changed since backup, container may not work as before", info.Image)
+	}
+
+	// Check all volumes first, so none is restored if one cannot be
+	for i := range info.Volumes {
+		v := &info.Volumes[i]
+		source, err := restoreSource(volumeRoot, v.Source)
+		if err != nil {
+			return "", err
+		}
+		v.Source = source
+		if err := checkRestoreTarget(v.Source); err != nil {
+			return "", err
+		}
+	}
+
+	// Undo a partial restore, so a failed one can be retried as is
+	id := generateID()
+	restored, mounted, saved := 0, false, false
+	defer func() {
+		if saved {
+			return
+		}
+		if mounted {
+			// Nothing under a mount that failed to go away is removed
+			if err := overlay.Cleanup(id, info.Volumes); err != nil {
+				log.Printf("Failed to clean up restored container %s: %v", id, err)
+				return
+			}
+		} else {
+			os.RemoveAll(filepath.Dir(overlay.UpperDir(id)))
+		}
+		os.RemoveAll(filepath.Join(containerDir(), id))
+		for i, v := range info.Volumes[:restored] {
+			if err := os.Rename(v.Source, filepath.Join(tmpDir, backupVolumesDir, strconv.Itoa(i))); err != nil {
+				log.Printf("Restored volume left at %s: %v", v.Source, err)
+			}
+		}
+	}()
+
+	for i, v := range info.Volumes {
+		if err := restoreVolume(filepath.Join(tmpDir, backupVolumesDir, strconv.Itoa(i)), v.Source); err != nil {
+			return "", err
+		}
+		restored++
+	}
+
+	if err := createContainerDir(id); err != nil {
+		return "", err
+	}
+
+	upperDir := overlay.UpperDir(id)
+	if err := os.MkdirAll(filepath.Dir(upperDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+	if err := os.Rename(filepath.Join(tmpDir, backupUpperDir), upperDir); err != nil {
+		return "", fmt.Errorf("failed to restore container filesystem: %w", err)
+	}
+
+	// Setup reuses existing upper directory
+	if _, err := overlay.Setup(info.Image, id, info.Volumes, info.StorageOpts); err != nil {
+		return "", err
+	}
+	mounted = true
+
+	info.ID = id
+	info.PID, info.ShimPID = 0, 0
+	info.Status = Exited
+	info.Error = ""
+
+	// Network settings are kept to connect on start, address is given anew
+	if info.Endpoint != nil {
+		info.Endpoint.IPNet, info.Endpoint.HostInterface, info.Endpoint.Veth = nil, "", ""
+	}
+
+	if info.Name != "" {
+		if err := reserveName(info.Name, id); err != nil {
+			log.Printf("Restoring container unnamed: %v", err)
+			info.Name = ""
+		}
+	}
+
+	if err := saveInfo(info); err != nil {
+		if info.Name != "" {
+			releaseName(info.Name, id)
+		}
+		return "", err
+	}
+	saved = true
+
+	return id, nil
+}
+
+// restoreSource returns where a volume with source recorded in a backup is
+// restored to, under volumeRoot if given. As backup may come from anywhere,
+// source must be absolute and clean, and cannot lead out of volumeRoot.
+func restoreSource(volumeRoot, source string) (string, error) {
+	if !filepath.IsAbs(source) || filepath.Clean(source) != source || source == "/" {
+		return "", fmt.Errorf("invalid volume source %q in backup, must be a clean absolute path other than /", source)
+	}
+	if volumeRoot == "" {
+		return source, nil
+	}
+
+	path := filepath.Join(volumeRoot, source)
+	if rel, err := filepath.Rel(volumeRoot, path); err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("volume source %q in backup is outside volume root %s", source, volumeRoot)
+	}
+	return path, nil
+}
+
+// checkRestoreTarget fails unless path is free to restore a volume to: it does
+// not exist or is an empty directory.
+func checkRestoreTarget(path string) error {
+	entries, err := os.ReadDir(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err == nil && len(entries) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("volume source %s already exists, restore volumes elsewhere with a volume root", path)
+}
+
+// restoreVolume moves contents of a volume extracted at src to dst, copying
+// them if dst is on another filesystem.
+func restoreVolume(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create parent of volume %s: %w", dst, err)
+	}
+
+	// Empty directory left in place is replaced
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to restore volume %s: %w", dst, err)
+	}
+
+	err := os.Rename(src, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		if out, err := exec.Command("cp", "-a", src, dst).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to restore volume %s: %s", dst, out)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore volume %s: %w", dst, err)
+	}
+
+	return nil
+}
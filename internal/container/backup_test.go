@@ -0,0 +1,71 @@
+package container
+
+import "testing"
+
+func TestRestoreSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		volumeRoot string
+		source     string
+		want       string
+		wantError  bool
+	}{
+		{
+			name:   "original source",
+			source: "/srv/data",
+			want:   "/srv/data",
+		},
+		{
+			name:       "under volume root",
+			volumeRoot: "/restore",
+			source:     "/srv/data",
+			want:       "/restore/srv/data",
+		},
+		{
+			name:       "relative source",
+			volumeRoot: "/restore",
+			source:     "../../etc",
+			wantError:  true,
+		},
+		{
+			name:      "relative source without volume root",
+			source:    "srv/data",
+			wantError: true,
+		},
+		{
+			name:       "unclean source",
+			volumeRoot: "/restore",
+			source:     "/srv/../../etc",
+			wantError:  true,
+		},
+		{
+			name:       "root source",
+			volumeRoot: "/restore",
+			source:     "/",
+			wantError:  true,
+		},
+		{
+			name:      "empty source",
+			source:    "",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := restoreSource(tt.volumeRoot, tt.source)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("restoreSource(%q, %q) = %s, expected error", tt.volumeRoot, tt.source, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restoreSource(%q, %q) unexpected error: %v", tt.volumeRoot, tt.source, err)
+			}
+			if got != tt.want {
+				t.Errorf("restoreSource(%q, %q) = %s, want %s", tt.volumeRoot, tt.source, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/volume"
+)
+
+const (
+	bundleVersion  = 1
+	bundleManifest = "bundle.json"
+	bundleUpperDir = "upper"
+)
+
+// bundle describes a container captured in a bundle archive.
+//
+// Volume contents are not captured, only where they were mounted from and to.
+type bundle struct {
+	Version     int                  `json:"version"`
+	SourceID    string               `json:"sourceId"`
+	Image       string               `json:"image"`
+	ImageDigest string               `json:"imageDigest"`
+	Command     []string             `json:"command"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Volumes     volume.Volumes       `json:"volumes"`
+	StorageOpts overlay.MountOptions `json:"storageOpts,omitempty"`
+	Endpoint    *network.Endpoint    `json:"endpoint"`
+}
+
+// Bundle archives a container's metadata, writable layer, volume manifest, and
+// network settings into a single tar file at output.
+func Bundle(id, output string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	upperDir := overlay.UpperDir(id)
+	if _, err := os.Stat(upperDir); err != nil {
+		return fmt.Errorf("container filesystem not found: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tinydock-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	b := &bundle{
+		Version:     bundleVersion,
+		SourceID:    info.ID,
+		Image:       info.Image,
+		ImageDigest: info.ImageDigest,
+		Command:     info.Command,
+		CreatedAt:   info.CreatedAt,
+		Volumes:     info.Volumes,
+		StorageOpts: info.StorageOpts,
+		Endpoint:    info.Endpoint,
+	}
+
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal bundle manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(tmpDir, bundleManifest), data, 0644); err != nil {
+		return fmt.Errorf("failed to write bundle manifest: %w", err)
+	}
+
+	// Keep overlay xattrs so opaque directories survive the round trip
+	cmd := exec.Command("tar", "cf", output,
+		"--xattrs", "--xattrs-include=trusted.overlay.*",
+		"-C", tmpDir, bundleManifest,
+		"-C", filepath.Dir(upperDir), bundleUpperDir,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to create bundle: %s", out)
+	}
+
+	return nil
+}
+
+// Unbundle re-creates a container from a bundle archive and returns its ID.
+//
+// The container is restored in exited state on top of its original image, which
+// must be available locally. Its network endpoint is not re-created, as there is
+// no running process to connect; recorded settings remain in the bundle.
+func Unbundle(input string) (string, error) {
+	if err := os.MkdirAll(containerDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create containers directory: %w", err)
+	}
+
+	// Extract next to final location so writable layer can be moved with rename
+	tmpDir, err := os.MkdirTemp(containerDir(), ".unbundle-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	cmd := exec.Command("tar", "xf", input,
+		"--xattrs", "--xattrs-include=trusted.overlay.*",
+		"-C", tmpDir,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("failed to extract bundle: %s", out)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tmpDir, bundleManifest))
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle manifest: %w", err)
+	}
+
+	var b bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return "", fmt.Errorf("failed to unmarshal bundle manifest: %w", err)
+	}
+	if b.Version != bundleVersion {
+		return "", fmt.Errorf("unsupported bundle version: %d", b.Version)
+	}
+
+	id := generateID()
+	if err := createContainerDir(id); err != nil {
+		return "", err
+	}
+
+	upperDir := overlay.UpperDir(id)
+	if err := os.MkdirAll(filepath.Dir(upperDir), 0755); err != nil {
+		return "", fmt.Errorf("failed to create overlay directory: %w", err)
+	}
+	if err := os.Rename(filepath.Join(tmpDir, bundleUpperDir), upperDir); err != nil {
+		return "", fmt.Errorf("failed to restore container filesystem: %w", err)
+	}
+
+	// Setup reuses existing upper directory
+	if _, err := overlay.Setup(b.Image, id, b.Volumes, b.StorageOpts); err != nil {
+		return "", err
+	}
+
+	info := &Info{
+		ID:          id,
+		Status:      Exited,
+		Image:       b.Image,
+		ImageDigest: b.ImageDigest,
+		Command:     b.Command,
+		CreatedAt:   b.CreatedAt,
+		Volumes:     b.Volumes,
+		StorageOpts: b.StorageOpts,
+	}
+	if err := saveInfo(info); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
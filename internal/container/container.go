@@ -2,101 +2,329 @@ package container
 
 import (
 	"bufio"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/metrics"
 	"github.com/lutaod/tinydock/internal/network"
 	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/preflight"
 	"github.com/lutaod/tinydock/internal/volume"
 )
 
+// Options configures a container created by Init.
+type Options struct {
+	Interactive      bool
+	AutoRemove       bool
+	Detached         bool
+	OpenStdin        bool
+	Network          string
+	Ports            network.PortMappings
+	Exposed          network.ExposedPorts
+	Volumes          volume.Volumes
+	StorageOpts      overlay.MountOptions
+	Envs             Envs
+	DNS              DNS
+	Security         SecurityOpts
+	Priority         Priority
+	Ready            Readiness
+	Requires         []string
+	Labels           Labels
+	Name             string
+	PIDFile          string
+	EvictionPriority int
+	CPULimit         float64
+	MemoryLimit      string
+}
+
 // Init spawns a container process that initially acts as the init process (PID 1)
 // before being replaced by user command.
-func Init(
-	image string,
-	args []string,
-	interactive bool,
-	autoRemove bool,
-	detached bool,
-	nw string,
-	ports network.PortMappings,
-	volumes volume.Volumes,
-	envs Envs,
-	cpuLimit float64,
-	memoryLimit string,
-) error {
+//
+// ID of container is returned, also along with an error once container has been
+// recorded, e.g. if its command failed to start, so caller can clean it up. A
+// container failing before that is torn down by Init itself.
+func Init(image string, args []string, opts Options) (containerID string, err error) {
+	started := time.Now()
+
+	if err := preflight.Verify(preflight.ForRun(opts.Network != "")...); err != nil {
+		return "", err
+	}
+
+	if err := opts.Priority.validate(); err != nil {
+		return "", err
+	}
+
+	if err := checkAdmission(opts.CPULimit, opts.MemoryLimit); err != nil {
+		return "", err
+	}
+
+	requires, err := checkRequires(opts.Requires)
+	if err != nil {
+		return "", err
+	}
+	opts.Requires = requires
+
 	// Create unnamed pipe for passing user command
 	reader, writer, err := os.Pipe()
 	if err != nil {
-		return fmt.Errorf("failed to create pipe: %w", err)
+		return "", fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	if opts.Name != "" {
+		if err := checkName(opts.Name); err != nil {
+			return "", err
+		}
+	}
+
+	if opts.PIDFile != "" {
+		if opts.PIDFile, err = filepath.Abs(opts.PIDFile); err != nil {
+			return "", fmt.Errorf("failed to resolve pid file path: %w", err)
+		}
 	}
 
 	id := generateID()
 	if err := createContainerDir(id); err != nil {
-		return err
+		return "", err
 	}
 
-	cmd, err := prepareCmd(id, envs, interactive, detached, reader)
+	// Nothing of a container never recorded is left behind, as rm cannot find it
+	var (
+		cmd      *exec.Cmd
+		pid      int
+		mounted  bool
+		endpoint *network.Endpoint
+	)
+	saved := false
+	defer func() {
+		if !saved {
+			abandon(id, cmd, pid, opts.Volumes, mounted, endpoint)
+			containerID = ""
+		}
+	}()
+
+	if opts.Name != "" {
+		if err := reserveName(opts.Name, id); err != nil {
+			return id, err
+		}
+		defer func() {
+			if !saved {
+				releaseName(opts.Name, id)
+			}
+		}()
+	}
+
+	// Create pipe for init to report errors through before running user command
+	errReader, errWriter, err := os.Pipe()
 	if err != nil {
-		return err
+		return id, fmt.Errorf("failed to create pipe: %w", err)
 	}
+	defer errReader.Close()
 
-	mergedDir, err := overlay.Setup(image, id, volumes)
+	cmd, err = prepareCmd(id, opts.Envs, opts.Interactive, opts.Detached, opts.Security, opts.Priority, reader, errWriter)
 	if err != nil {
-		return err
+		errWriter.Close()
+		return id, err
 	}
+
+	// Detached container outlives run, so a shim is left to record its exit
+	var s *shim
+	if opts.Detached {
+		if s, err = attachShim(cmd, id, opts.OpenStdin); err != nil {
+			errWriter.Close()
+			return id, err
+		}
+		defer s.release()
+	}
+
+	mountStarted := time.Now()
+	mergedDir, err := overlay.Setup(image, id, opts.Volumes, opts.StorageOpts)
+	if err != nil {
+		return id, err
+	}
+	mounted = true
+	metrics.Record(metrics.OpMount, id, mountStarted)
 	cmd.Dir = mergedDir
 
+	digest, err := overlay.ImageDigest(image)
+	if err != nil {
+		return id, err
+	}
+
+	hostname := hostnameOf(cmd.Env)
+	if err := writeEtcFiles(id, hostname, opts.DNS); err != nil {
+		return id, err
+	}
+
 	if err := cmd.Start(); err != nil {
 		reader.Close()
-		return fmt.Errorf("failed to initialize container: %w", err)
+		errWriter.Close()
+		return id, fmt.Errorf("failed to initialize container: %w", err)
 	}
 	reader.Close()
+	errWriter.Close()
+
+	pid = cmd.Process.Pid
+	if s != nil {
+		if pid, err = s.containerPID(); err != nil {
+			return id, err
+		}
+	}
 
 	if err := writeArgsToPipe(writer, args); err != nil {
-		return err
+		return id, err
+	}
+
+	info := &Info{
+		ID:          id,
+		Name:        opts.Name,
+		PID:         pid,
+		PIDFile:     opts.PIDFile,
+		Status:      Running,
+		Image:       image,
+		ImageDigest: digest,
+		Command:     args,
+		Env:         cmd.Env,
+		OpenStdin:   opts.OpenStdin,
+		CreatedAt:   time.Now(),
+		Volumes:     opts.Volumes,
+		StorageOpts: opts.StorageOpts,
+		CPULimit:    opts.CPULimit,
+		MemoryLimit: opts.MemoryLimit,
+		Requires:    opts.Requires,
+		Security:    opts.Security,
+		Priority:    opts.Priority,
+		Eviction:    opts.EvictionPriority,
+		Labels:      opts.Labels,
+	}
+	if s != nil {
+		info.ShimPID = cmd.Process.Pid
+	}
+
+	if err := cgroups.Configure(id, info.PID, opts.CPULimit, opts.MemoryLimit); err != nil {
+		return id, initFailed(err, errReader)
+	}
+
+	connectStarted := time.Now()
+	endpoint, err = network.Setup(info.PID, opts.Network, opts.Ports)
+	if err != nil {
+		return id, initFailed(err, errReader)
 	}
+	if endpoint != nil {
+		metrics.Record(metrics.OpConnect, id, connectStarted)
+		endpoint.ExposedPorts = opts.Exposed
 
-	info := &info{
-		ID:        id,
-		PID:       cmd.Process.Pid,
-		Status:    running,
-		Image:     image,
-		Command:   args,
-		CreatedAt: time.Now(),
-		Volumes:   volumes,
+		if err := writeHosts(id, hostname, endpoint); err != nil {
+			return id, err
+		}
 	}
+	info.Endpoint = endpoint
 
-	if err := cgroups.Configure(id, info.PID, cpuLimit, memoryLimit); err != nil {
-		return err
+	if err := saveInfo(info); err != nil {
+		return id, err
+	}
+	saved = true
+	if s != nil {
+		s.release()
 	}
 
-	endpoint, err := network.Setup(info.PID, nw, ports)
-	if err != nil {
-		return err
+	if opts.PIDFile != "" {
+		if err := writePIDFile(opts.PIDFile, info.PID); err != nil {
+			return id, err
+		}
 	}
-	info.Endpoint = endpoint
 
-	if err := saveInfo(info); err != nil {
-		return err
+	if msg := readInitError(errReader, 0); msg != "" {
+		info.Error = msg
+		if err := handleLifecycle(cmd, info, false, opts.AutoRemove, Readiness{}); err != nil {
+			log.Print(err)
+		}
+		return id, fmt.Errorf("container %s failed to start: %s", id, msg)
 	}
+	metrics.Record(metrics.OpStart, id, started)
 
-	if err := handleLifecycle(cmd, info, detached, autoRemove); err != nil {
-		return err
+	if err := handleLifecycle(cmd, info, opts.Detached, opts.AutoRemove, opts.Ready); err != nil {
+		return id, err
 	}
 
-	return nil
+	return id, nil
+}
+
+// initFailed returns error of setting up a container, or rather error init
+// process already exited with, which likely caused it.
+func initFailed(err error, errReader *os.File) error {
+	if msg := readInitError(errReader, initErrorTimeout); msg != "" {
+		return fmt.Errorf("container init failed: %s", msg)
+	}
+	return err
+}
+
+// abandon tears down container with given id that failed before its info was
+// saved: its processes are killed, and its endpoint, cgroup, overlay and
+// directory removed. Failures are only logged, as container is failing already.
+func abandon(id string, cmd *exec.Cmd, pid int, volumes volume.Volumes, mounted bool, endpoint *network.Endpoint) {
+	if pid > 0 {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+	if cmd != nil && cmd.Process != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+
+	if endpoint != nil {
+		if err := network.Disconnect(endpoint); err != nil {
+			log.Printf("Failed to disconnect container %s: %v", id, err)
+		}
+	}
+
+	if err := cgroups.Remove(id); err != nil {
+		log.Printf("Failed to remove cgroup of container %s: %v", id, err)
+	}
+
+	// Nothing under a mount that failed to go away is removed
+	if mounted {
+		if err := overlay.Cleanup(id, volumes); err != nil {
+			log.Printf("Failed to clean up overlay of container %s: %v", id, err)
+			return
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(containerDir(), id)); err != nil {
+		log.Printf("Failed to remove container directory %s: %v", id, err)
+	}
 }
 
 // Run takes over after container creation and executes user command inside container.
-func Run() error {
+//
+// args are options passed by parent process after "init" argument. Errors are
+// also reported to parent, so they are recorded even if output of container
+// goes nowhere it is watched.
+func Run(args []string) (err error) {
+	// Parent reads EOF once user command is executed
+	syscall.CloseOnExec(initErrorFd)
+	defer func() {
+		if err != nil {
+			reportInitError(err)
+		}
+	}()
+
+	opts, priority, etc, err := parseInitArgs(args)
+	if err != nil {
+		return err
+	}
+
 	// Complete namespace isolation
 	if hostname := os.Getenv("HOSTNAME"); hostname != "" {
 		if err := syscall.Sethostname([]byte(hostname)); err != nil {
@@ -110,7 +338,7 @@ func Run() error {
 		return err
 	}
 
-	if err := setupMounts(); err != nil {
+	if err := setupMounts(opts, etc); err != nil {
 		return err
 	}
 
@@ -124,6 +352,14 @@ func Run() error {
 		return fmt.Errorf("command not found: %w", err)
 	}
 
+	// Scheduling attributes are per thread, keep this one until exec
+	if priority != (Priority{}) {
+		runtime.LockOSThread()
+		if err := priority.apply(); err != nil {
+			return err
+		}
+	}
+
 	// Execute user command in place of current process
 	if err := syscall.Exec(path, argv, os.Environ()); err != nil {
 		return err
@@ -133,8 +369,11 @@ func Run() error {
 }
 
 // List prints all containers, or only running ones if showAll is false.
-func List(showAll bool) error {
-	return listInfo(showAll)
+//
+// With withStats, CPU and memory usage of running containers is sampled once
+// from their cgroups, CPU usage being averaged over container lifetime.
+func List(showAll, withStats bool, filters LabelFilters) error {
+	return listInfo(showAll, withStats, filters)
 }
 
 // Stop sends a signal to specified container and waits for it to terminate.
@@ -142,17 +381,22 @@ func List(showAll bool) error {
 // Interactive containers may not properly handle SIGTERM/SIGINT signals when
 // running in foreground, instead, users should exit them directly.
 func Stop(id, sig string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
 	info, err := loadInfo(id)
 	if err != nil {
 		return fmt.Errorf("error loading container %s: %w", id, err)
 	}
 
-	if info.Status == exited {
+	if info.Status == Exited {
 		return fmt.Errorf("container is not running")
 	}
 
 	if err := syscall.Kill(info.PID, 0); err != nil || !verifyProcess(info.PID, id) {
-		info.Status = exited
+		info.Status = Exited
 		if err := saveInfo(info); err != nil {
 			return fmt.Errorf("failed to update container status: %w", err)
 		}
@@ -168,43 +412,114 @@ func Stop(id, sig string) error {
 		}
 	}
 
+	// Frozen processes only act on SIGKILL
+	if info.Status == Paused && signal != syscall.SIGKILL {
+		return fmt.Errorf("container is paused: unpause it first or stop it with SIGKILL")
+	}
+
 	if err := syscall.Kill(info.PID, signal); err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
 
 	// Wait for up to a second for container to stop
-	for i := 0; i < 10; i++ {
-		if err := syscall.Kill(info.PID, 0); err != nil {
-			info.Status = exited
-			if err := saveInfo(info); err != nil {
-				return fmt.Errorf("failed to update container status: %w", err)
-			}
+	if !waitExit(info.PID, time.Second) {
+		return fmt.Errorf("container did not stop")
+	}
 
-			return nil
+	// Cgroup is reused once container is started again
+	if info.Status == Paused {
+		if err := cgroups.Thaw(id); err != nil {
+			log.Print(err)
 		}
-		time.Sleep(100 * time.Millisecond)
 	}
 
-	return fmt.Errorf("container did not stop")
+	// Keep exit code recorded by shim
+	info = waitShim(info)
+	info.Status = Exited
+	if err := saveInfo(info); err != nil {
+		return fmt.Errorf("failed to update container status: %w", err)
+	}
+	removePIDFile(info)
+
+	return nil
+}
+
+// Kill sends a signal to specified container, SIGKILL unless given, without
+// waiting for it to terminate.
+func Kill(id, sig string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if !info.Status.active() || syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id) {
+		return fmt.Errorf("container is not running")
+	}
+
+	signal := syscall.SIGKILL
+	if sig != "" {
+		signal, err = parseSignal(sig)
+		if err != nil {
+			return fmt.Errorf("failed to parse signal: %w", err)
+		}
+	}
+
+	// Signals other than SIGKILL stay pending until container is thawed
+	if info.Status == Paused && signal != syscall.SIGKILL {
+		log.Printf("Container %s is paused, signal %s is delivered once it is unpaused", id, sig)
+	}
+
+	if err := syscall.Kill(info.PID, signal); err != nil {
+		return fmt.Errorf("failed to signal container: %w", err)
+	}
+
+	return nil
+}
+
+// waitExit waits up to timeout for process of given PID to exit, and reports
+// whether it did.
+func waitExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
 // Remove deletes container resources.
 func Remove(id string, force bool) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
 	info, err := loadInfo(id)
 	if err != nil {
 		return err
 	}
 
-	if info.Status == running {
+	if info.Status.active() {
 		if force {
 			if err := Stop(id, "SIGKILL"); err != nil {
 				return err
 			}
 		} else {
-			return fmt.Errorf("container is running: stop it before removing")
+			return fmt.Errorf("container is %s: stop it before removing", info.Status)
 		}
 	}
 
+	removePIDFile(info)
+
 	if err := cgroups.Remove(id); err != nil {
 		return err
 	}
@@ -213,7 +528,8 @@ func Remove(id string, force bool) error {
 		return err
 	}
 
-	if info.Endpoint != nil {
+	// Endpoint of a container that failed to restart has no address left
+	if info.Endpoint != nil && info.Endpoint.IPNet != nil {
 		if err := network.Disconnect(info.Endpoint); err != nil {
 			return err
 		}
@@ -228,12 +544,17 @@ func Remove(id string, force bool) error {
 
 // Logs displays container logs.
 func Logs(id string, follow bool) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
 	info, err := loadInfo(id)
 	if err != nil {
 		return fmt.Errorf("error loading container %s: %w", id, err)
 	}
 
-	logPath := filepath.Join(containerDir, id, "container.log")
+	logPath := filepath.Join(containerDir(), id, "container.log")
 	if _, err := os.Stat(logPath); err != nil {
 		return fmt.Errorf("no logs for container")
 	}
@@ -271,7 +592,7 @@ func Logs(id string, follow bool) error {
 		}
 
 		if err == io.EOF {
-			if info.Status == exited {
+			if info.Status == Exited {
 				return nil
 			}
 			time.Sleep(100 * time.Millisecond)
@@ -285,7 +606,15 @@ func Logs(id string, follow bool) error {
 // A new process is forked to enter container namespaces before executing the
 // command due to Linux kernel restrictions on mount namespace transitions in
 // multi-threaded processes.
-func Exec(id string, command []string) error {
+//
+// Only given comma separated namespaces are joined if not empty (e.g. "net" to
+// run host tools against container network). Container environment is used
+// only when its mount namespace is joined, as host binaries may need host's.
+//
+// A privileged session sees /proc and /sys without the hardening container has,
+// in a private copy of its mount namespace. Container processes keep full root
+// capabilities, so sessions need none added to e.g. capture packets.
+func Exec(id string, command []string, nsList string, privileged bool) error {
 	if os.Getenv("TINYDOCK_PID") != "" {
 		// Second run: C constructor will have handled namespace entry as env
 		// vars are set
@@ -293,12 +622,25 @@ func Exec(id string, command []string) error {
 	}
 
 	// First run
+	joined, err := parseNamespaces(nsList)
+	if err != nil {
+		return err
+	}
+	if privileged && !slices.Contains(joined, "mnt") {
+		return fmt.Errorf("privileged exec requires joining mnt namespace")
+	}
+
+	id, err = resolveID(id)
+	if err != nil {
+		return err
+	}
+
 	info, err := loadInfo(id)
 	if err != nil {
 		return fmt.Errorf("error loading container %s: %w", id, err)
 	}
 
-	if info.Status != running {
+	if info.Status != Running {
 		return fmt.Errorf("container is not running")
 	}
 
@@ -308,62 +650,189 @@ func Exec(id string, command []string) error {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	envs, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", info.PID))
-	if err != nil {
-		return fmt.Errorf("failed to read environment variables: %w", err)
+	cmd.Env = os.Environ()
+	if slices.Contains(joined, "mnt") {
+		envs, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", info.PID))
+		if err != nil {
+			return fmt.Errorf("failed to read environment variables: %w", err)
+		}
+		cmd.Env = strings.Split(string(envs), "\x00")
 	}
 
-	cmd.Env = append(strings.Split(string(envs), "\x00"),
+	cmd.Env = append(cmd.Env,
 		// Set env vars for C constructor
 		fmt.Sprintf("TINYDOCK_PID=%d", info.PID),
 		fmt.Sprintf("TINYDOCK_CMD=%s", strings.Join(command, " ")),
+		fmt.Sprintf("TINYDOCK_NS=,%s,", strings.Join(joined, ",")),
 	)
+	if privileged {
+		hardened := append(slices.Clone(maskedPaths), readonlyPaths...)
+		cmd.Env = append(cmd.Env, "TINYDOCK_UNMASK="+strings.Join(hardened, ":"))
+	}
 
-	return cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start exec session: %w", err)
+	}
+
+	s := &session{
+		PID:        cmd.Process.Pid,
+		Command:    command,
+		User:       currentUser(),
+		StartedAt:  time.Now(),
+		Privileged: privileged,
+	}
+	if err := saveSession(id, s); err != nil {
+		log.Print(err)
+	}
+	defer func() {
+		if err := removeSession(id, s.PID); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	return cmd.Wait()
+}
+
+// Port prints published and exposed ports of a container.
+func Port(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Endpoint == nil {
+		return nil
+	}
+
+	for _, p := range info.Endpoint.PortMappings {
+		fmt.Printf("%d/tcp -> 0.0.0.0:%d\n", p.ContainerPort, p.HostPort)
+	}
+
+	published := make(map[uint16]bool)
+	for _, p := range info.Endpoint.PortMappings {
+		published[p.ContainerPort] = true
+	}
+	for _, p := range info.Endpoint.ExposedPorts {
+		if !published[p] {
+			fmt.Printf("%d/tcp\n", p)
+		}
+	}
+
+	return nil
+}
+
+// VolumesFrom returns volumes of given container to be mounted at the same paths.
+func VolumesFrom(id string) (volume.Volumes, error) {
+	id, err := resolveID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	return info.Volumes, nil
 }
 
 // Commit creates a new image from a container's filesystem.
-func Commit(id, name string) error {
-	_, err := loadInfo(id)
+//
+// An incremental image stores only container's changes on top of its image. A
+// running container is paused while captured if pause is set, so files are not
+// captured mid-write. createdBy is recorded in image history as command that
+// created the layer, defaulting to container command. Provenance of image is
+// recorded too, signed with signKey unless nil.
+func Commit(id, name, createdBy string, incremental, pause bool, signKey ed25519.PrivateKey) error {
+	started := time.Now()
+
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
 	if err != nil {
 		return fmt.Errorf("error loading container %s: %w", id, err)
 	}
 
-	if err := overlay.SaveImage(id, name); err != nil {
+	if pause && info.Status == Running {
+		thaw, err := freeze(id)
+		if err != nil {
+			return err
+		}
+		defer thaw()
+	}
+
+	if createdBy == "" {
+		createdBy = strings.Join(info.Command, " ")
+	}
+
+	if err := overlay.SaveImage(id, name, info.Image, createdBy, incremental); err != nil {
 		return fmt.Errorf("failed to commit container: %w", err)
 	}
 
+	params := overlay.Parameters{Image: info.Image, Container: id, Command: info.Command}
+	if err := overlay.AttestImage(name, params, started, signKey); err != nil {
+		return fmt.Errorf("failed to record provenance: %w", err)
+	}
+
 	return nil
 }
 
-// ListImages prints information about available images.
-func ListImages() error {
-	entries, err := os.ReadDir(overlay.RegistryDir)
+// freeze stops processes of container so its filesystem is not written while
+// being captured, and returns a function resuming them. Containers already
+// frozen, or whose process is gone, are left as they are.
+func freeze(id string) (func(), error) {
+	frozen, err := cgroups.Frozen(id)
+	if errors.Is(err, fs.ErrNotExist) || frozen {
+		return func() {}, nil
+	}
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("failed to read image registry: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("%-20s %-20s %s\n", "IMAGE", "CREATED", "SIZE")
+	if err := cgroups.Freeze(id); err != nil {
+		return nil, fmt.Errorf("failed to pause container for commit, use -pause=false to commit without: %w", err)
+	}
 
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".tar.gz") {
-			continue
+	return func() {
+		if err := cgroups.Thaw(id); err != nil {
+			log.Printf("Failed to resume container %s: %v", id, err)
 		}
+	}, nil
+}
 
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
+// ListImages prints information about available images.
+func ListImages() error {
+	images, err := overlay.Images()
+	if err != nil {
+		return err
+	}
 
-		name := strings.TrimSuffix(entry.Name(), ".tar.gz")
-		size := fmt.Sprintf("%.2f MB", float64(info.Size())/1024/1024)
-		created := info.ModTime().Format("2006-01-02 15:04:05")
+	stored, err := overlay.StoredSize()
+	if err != nil {
+		return err
+	}
 
-		fmt.Printf("%-20s %-20s %s\n", name, created, size)
+	fmt.Printf("%-20s %-15s %-14s %-20s %-12s %s\n", "IMAGE", "TAG", "IMAGE ID", "CREATED", "SIZE", "SHARED")
+
+	var total int64
+	for _, img := range images {
+		size := fmt.Sprintf("%.2f MB", float64(img.Size)/1024/1024)
+		shared := fmt.Sprintf("%.2f MB", float64(img.SharedSize)/1024/1024)
+		created := img.Created.Format("2006-01-02 15:04:05")
+		total += img.Size
+
+		fmt.Printf("%-20s %-15s %-14s %-20s %-12s %s\n", img.Name, img.Tag, img.ID, created, size, shared)
 	}
 
+	fmt.Printf("\nTotal: %.2f MB, stored: %.2f MB\n", float64(total)/1024/1024, float64(stored)/1024/1024)
+
 	return nil
 }
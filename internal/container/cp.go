@@ -0,0 +1,248 @@
+package container
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/inroot"
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/untar"
+)
+
+// Copy copies a file or directory between host and a container, with either src
+// or dst given as CONTAINER:PATH, preserving permissions, owners and symlinks.
+// A destination that is an existing directory is copied into.
+//
+// Files are copied through merged directory of a container whose overlay is
+// mounted, running or not. A stopped container whose overlay is not, e.g. after
+// host reboot, is read through a read-only view of its layers and written to
+// through its writable layer. A running container is frozen while files are
+// copied, so it cannot swap a path already resolved for a symlink.
+func Copy(src, dst string) error {
+	srcID, srcPath := splitCopyPath(src)
+	dstID, dstPath := splitCopyPath(dst)
+
+	switch {
+	case srcID != "" && dstID != "":
+		return fmt.Errorf("copying between containers is not supported")
+	case srcID != "":
+		return copyFromContainer(srcID, srcPath, dst)
+	case dstID != "":
+		return copyToContainer(src, dstID, dstPath)
+	default:
+		return fmt.Errorf("either source or destination must be a container path (CONTAINER:PATH)")
+	}
+}
+
+// splitCopyPath splits CONTAINER:PATH into container and path, returning no
+// container for a host path. A host path containing ':' can be given as an
+// absolute or relative one, e.g. "./a:b".
+func splitCopyPath(arg string) (string, string) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+
+	id, path, ok := strings.Cut(arg, ":")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return "", arg
+	}
+
+	return id, filepath.Clean("/" + path)
+}
+
+// copyFromContainer copies path in container with given id to dst on host.
+func copyFromContainer(id, path, dst string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	thaw, err := freezeRunning(id)
+	if err != nil {
+		return err
+	}
+	defer thaw()
+
+	view, release, err := viewContainer(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Only parent is resolved, so a symlink at path is copied as is
+	dir, err := inroot.Resolve(view, filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("%s not found in container: %w", path, err)
+	}
+	srcPath := filepath.Join(dir, filepath.Base(path))
+	if path == "/" {
+		srcPath = dir + "/."
+	}
+
+	if _, err := os.Lstat(srcPath); err != nil {
+		return fmt.Errorf("%s not found in container", path)
+	}
+
+	return copyTree(srcPath, dst)
+}
+
+// copyToContainer copies src on host to path in container with given id.
+func copyToContainer(src, id, path string) error {
+	if _, err := os.Lstat(src); err != nil {
+		return fmt.Errorf("source not found: %w", err)
+	}
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	thaw, err := freezeRunning(id)
+	if err != nil {
+		return err
+	}
+	defer thaw()
+
+	view, release, err := viewContainer(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Resolve destination as if view were "/", so neither ".." nor symlinks of
+	// container can lead it outside
+	target := path
+	if dir, err := inroot.Resolve(view, target); err == nil {
+		if st, err := os.Stat(dir); err == nil && st.IsDir() {
+			abs, err := filepath.Abs(src)
+			if err != nil {
+				return fmt.Errorf("failed to resolve source: %w", err)
+			}
+			target = filepath.Join(target, filepath.Base(abs))
+		}
+	}
+
+	parent, err := inroot.Resolve(view, filepath.Dir(target))
+	if err != nil {
+		return fmt.Errorf("destination directory %s not found in container: %w", filepath.Dir(target), err)
+	}
+	if st, err := os.Stat(parent); err != nil || !st.IsDir() {
+		return fmt.Errorf("destination %s in container is not a directory", filepath.Dir(target))
+	}
+
+	if view != overlay.MergedDir(id) {
+		if parent, err = upperDirOf(id, view, parent); err != nil {
+			return err
+		}
+	}
+
+	return untar.Copy(src, parent, filepath.Base(target))
+}
+
+// freezeRunning freezes container with given id if it is running, and returns
+// a function thawing it.
+func freezeRunning(id string) (func(), error) {
+	info, err := loadInfo(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status != Running || syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id) {
+		return func() {}, nil
+	}
+
+	if err := cgroups.Freeze(id); err != nil {
+		return nil, fmt.Errorf("failed to freeze container: %w", err)
+	}
+
+	return func() {
+		if err := cgroups.Thaw(id); err != nil {
+			log.Printf("Failed to resume container %s: %v", id, err)
+		}
+	}, nil
+}
+
+// viewContainer returns a directory showing filesystem of container with given
+// id, and a function releasing it. It is merged directory of overlay if mounted,
+// otherwise a read-only view of its layers mounted for the copy.
+func viewContainer(id string) (string, func(), error) {
+	if overlay.Mounted(id) {
+		return overlay.MergedDir(id), func() {}, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "tinydock-cp-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	unmount, err := overlay.MountReadOnly(id, tmpDir)
+	if err != nil {
+		os.Remove(tmpDir)
+		return "", nil, err
+	}
+
+	return tmpDir, func() {
+		if err := unmount(); err != nil {
+			log.Printf("Failed to unmount %s: %v", tmpDir, err)
+			return
+		}
+		os.Remove(tmpDir)
+	}, nil
+}
+
+// upperDirOf returns directory in writable layer of container with given id
+// corresponding to dir resolved in view, creating it along with any missing
+// parents with mode and owner they have in view.
+//
+// As dir is resolved, its path has no symlinks, so none of image is replaced by
+// a directory in writable layer.
+func upperDirOf(id, view, dir string) (string, error) {
+	root, err := inroot.Resolve(view, "/")
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve destination: %w", err)
+	}
+
+	upperDir, created, err := inroot.MkdirAll(overlay.UpperDir(id), rel, 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to create destination in writable layer: %w", err)
+	}
+	if created == "" {
+		return upperDir, nil
+	}
+
+	for p, v := upperDir, dir; ; p, v = filepath.Dir(p), filepath.Dir(v) {
+		st, err := os.Stat(v)
+		if err != nil {
+			return "", fmt.Errorf("failed to read destination attributes: %w", err)
+		}
+		if err := os.Chmod(p, st.Mode()); err != nil {
+			return "", fmt.Errorf("failed to set destination mode: %w", err)
+		}
+		sys := st.Sys().(*syscall.Stat_t)
+		if err := os.Lchown(p, int(sys.Uid), int(sys.Gid)); err != nil {
+			return "", fmt.Errorf("failed to set destination owner: %w", err)
+		}
+
+		if p == created {
+			return upperDir, nil
+		}
+	}
+}
+
+// copyTree copies src to dst as `cp -a` does.
+func copyTree(src, dst string) error {
+	if out, err := exec.Command("cp", "-a", src, dst).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to copy %s: %s", src, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
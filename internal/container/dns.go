@@ -0,0 +1,110 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fallbackNameservers are used when neither user nor host provides usable nameservers.
+var fallbackNameservers = []string{"8.8.8.8", "8.8.4.4"}
+
+// DNS holds resolver configuration of a container.
+type DNS struct {
+	Servers []string
+	Search  []string
+	Options []string
+}
+
+// AddServer validates and appends a nameserver address.
+func (d *DNS) AddServer(value string) error {
+	if net.ParseIP(value) == nil {
+		return fmt.Errorf("invalid nameserver address: %s", value)
+	}
+
+	d.Servers = append(d.Servers, value)
+	return nil
+}
+
+// AddSearch appends a search domain.
+func (d *DNS) AddSearch(value string) error {
+	if value == "" || strings.ContainsAny(value, " \t") {
+		return fmt.Errorf("invalid search domain: %q", value)
+	}
+
+	d.Search = append(d.Search, value)
+	return nil
+}
+
+// AddOption appends a resolver option (e.g., ndots:2).
+func (d *DNS) AddOption(value string) error {
+	if value == "" || strings.ContainsAny(value, " \t") {
+		return fmt.Errorf("invalid resolver option: %q", value)
+	}
+
+	d.Options = append(d.Options, value)
+	return nil
+}
+
+// isEmpty reports whether no resolver configuration is specified.
+func (d *DNS) isEmpty() bool {
+	return len(d.Servers) == 0 && len(d.Search) == 0 && len(d.Options) == 0
+}
+
+// writeResolvConf generates resolv.conf in given directory of generated /etc files.
+//
+// Nameservers default to host's non-loopback ones, since loopback resolvers
+// such as systemd-resolved stub are unreachable from container network namespace.
+func writeResolvConf(dir string, dns DNS) error {
+	servers := dns.Servers
+	if len(servers) == 0 {
+		servers = hostNameservers()
+	}
+	if len(servers) == 0 {
+		servers = fallbackNameservers
+	}
+
+	var b strings.Builder
+	for _, s := range servers {
+		fmt.Fprintf(&b, "nameserver %s\n", s)
+	}
+	if len(dns.Search) > 0 {
+		fmt.Fprintf(&b, "search %s\n", strings.Join(dns.Search, " "))
+	}
+	if len(dns.Options) > 0 {
+		fmt.Fprintf(&b, "options %s\n", strings.Join(dns.Options, " "))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "resolv.conf"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write resolv.conf: %w", err)
+	}
+
+	return nil
+}
+
+// hostNameservers returns non-loopback nameservers configured on host.
+func hostNameservers() []string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+
+		if ip := net.ParseIP(fields[1]); ip != nil && !ip.IsLoopback() {
+			servers = append(servers, fields[1])
+		}
+	}
+
+	return servers
+}
@@ -1,10 +1,23 @@
 package container
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
 	"strings"
 )
 
+// validEnvKey matches names of environment variables. Names shells reject, such
+// as "java.home", are still valid for other programs.
+var validEnvKey = regexp.MustCompile(`^[^\s=\x00]+$`)
+
 // Envs implements flag.Value for collecting environment variables.
+//
+// Each value takes one of the following forms:
+//   - KEY=VALUE sets variable to given value.
+//   - KEY forwards host variable of the same name, and is ignored if unset on host.
+//   - KEY= unsets variable, including defaults provided by tinydock.
 type Envs []string
 
 func (s *Envs) String() string {
@@ -12,6 +25,74 @@ func (s *Envs) String() string {
 }
 
 func (s *Envs) Set(value string) error {
+	key, _, _ := strings.Cut(value, "=")
+	if key == "" {
+		return fmt.Errorf("expect KEY=VALUE, KEY= or KEY, variable name is empty")
+	}
+	if !validEnvKey.MatchString(key) {
+		return fmt.Errorf("invalid variable name %q, must not contain whitespace", key)
+	}
+
+	if !strings.Contains(value, "=") {
+		hostValue, ok := os.LookupEnv(value)
+		if !ok {
+			return nil
+		}
+		value = value + "=" + hostValue
+	}
+
 	*s = append(*s, value)
 	return nil
 }
+
+// EnvFlag collects environment variables given with a repeated flag,
+// implementing flag.Value.
+//
+// Unlike Envs, it keeps going past invalid values, so all of them are reported
+// at once by Err along with their position among values of flag.
+type EnvFlag struct {
+	Envs Envs
+	errs []error
+	n    int
+}
+
+func (f *EnvFlag) String() string {
+	return f.Envs.String()
+}
+
+func (f *EnvFlag) Set(value string) error {
+	f.n++
+	if err := f.Envs.Set(value); err != nil {
+		f.errs = append(f.errs, fmt.Errorf("env #%d %q: %w", f.n, value, err))
+	}
+	return nil
+}
+
+// Err returns errors of all invalid values, or nil if there are none.
+func (f *EnvFlag) Err() error {
+	return errors.Join(f.errs...)
+}
+
+// apply returns base environment overridden by collected variables.
+func (s Envs) apply(base []string) []string {
+	env := append([]string{}, base...)
+
+	for _, kv := range s {
+		key, value, _ := strings.Cut(kv, "=")
+
+		// Drop any earlier definition of key
+		filtered := env[:0]
+		for _, e := range env {
+			if k, _, _ := strings.Cut(e, "="); k != key {
+				filtered = append(filtered, e)
+			}
+		}
+		env = filtered
+
+		if value != "" {
+			env = append(env, kv)
+		}
+	}
+
+	return env
+}
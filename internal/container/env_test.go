@@ -0,0 +1,125 @@
+package container
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvFlag(t *testing.T) {
+	t.Setenv("TINYDOCK_TEST_SET", "host")
+	t.Setenv("TINYDOCK_TEST_EMPTY", "")
+
+	tests := []struct {
+		name     string
+		values   []string
+		want     Envs
+		wantErrs []string
+	}{
+		{
+			name:   "key and value",
+			values: []string{"A=1", "B=x=y"},
+			want:   Envs{"A=1", "B=x=y"},
+		},
+		{
+			name:   "key forwarded from host",
+			values: []string{"TINYDOCK_TEST_SET", "TINYDOCK_TEST_EMPTY"},
+			want:   Envs{"TINYDOCK_TEST_SET=host", "TINYDOCK_TEST_EMPTY="},
+		},
+		{
+			name:   "key unset on host ignored",
+			values: []string{"TINYDOCK_TEST_UNSET"},
+			want:   nil,
+		},
+		{
+			name:   "key with empty value kept to unset",
+			values: []string{"TINYDOCK_TEST_SET="},
+			want:   Envs{"TINYDOCK_TEST_SET="},
+		},
+		{
+			name:   "duplicates kept in order",
+			values: []string{"A=1", "A=2"},
+			want:   Envs{"A=1", "A=2"},
+		},
+		{
+			name:     "every invalid value reported",
+			values:   []string{"=1", "A=1", "B C=2"},
+			want:     Envs{"A=1"},
+			wantErrs: []string{`env #1 "=1"`, `env #3 "B C=2"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f EnvFlag
+			for _, value := range tt.values {
+				if err := f.Set(value); err != nil {
+					t.Fatalf("Set(%q) returned error: %v", value, err)
+				}
+			}
+
+			if !slices.Equal(f.Envs, tt.want) {
+				t.Errorf("Envs = %q, want %q", f.Envs, tt.want)
+			}
+
+			err := f.Err()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Err() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Err() = nil, expected error")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantErrs) {
+				t.Fatalf("Err() = %q, want %d errors", err, len(tt.wantErrs))
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("Err() error %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEnvsApply(t *testing.T) {
+	base := []string{"PATH=/bin", "HOME=/root"}
+
+	tests := []struct {
+		name string
+		envs Envs
+		want []string
+	}{
+		{
+			name: "override",
+			envs: Envs{"HOME=/home"},
+			want: []string{"PATH=/bin", "HOME=/home"},
+		},
+		{
+			name: "unset",
+			envs: Envs{"PATH="},
+			want: []string{"HOME=/root"},
+		},
+		{
+			name: "last duplicate wins",
+			envs: Envs{"A=1", "A=2"},
+			want: []string{"PATH=/bin", "HOME=/root", "A=2"},
+		},
+		{
+			name: "set after unset",
+			envs: Envs{"HOME=", "HOME=/home"},
+			want: []string{"PATH=/bin", "HOME=/home"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.envs.apply(base); !slices.Equal(got, tt.want) {
+				t.Errorf("apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
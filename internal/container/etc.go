@@ -0,0 +1,128 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/inroot"
+	"github.com/lutaod/tinydock/internal/network"
+)
+
+// etcArg passes directory of generated /etc files to container init process.
+const etcArg = "etc="
+
+// etcFiles are files generated per container and bind mounted over those of
+// its image. They live outside the writable layer, so rewriting them in place
+// updates running containers.
+var etcFiles = []string{"hostname", "hosts", "resolv.conf"}
+
+// etcDir returns directory holding generated /etc files of given container.
+func etcDir(id string) string {
+	return filepath.Join(containerDir(), id, "etc")
+}
+
+// hostnameOf returns hostname container init sets from HOSTNAME variable of env.
+func hostnameOf(env []string) string {
+	for _, e := range env {
+		if value, ok := strings.CutPrefix(e, "HOSTNAME="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// writeEtcFiles generates hostname and hosts of container, and resolv.conf if
+// resolver configuration is specified, leaving image's own in place otherwise.
+func writeEtcFiles(id, hostname string, dns DNS) error {
+	dir := etcDir(id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create /etc files directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "hostname"), []byte(hostname+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write hostname: %w", err)
+	}
+
+	if err := writeHosts(id, hostname, nil); err != nil {
+		return err
+	}
+
+	if !dns.isEmpty() {
+		if err := writeResolvConf(dir, dns); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHosts generates hosts file of container, mapping hostname to address of
+// its network endpoint, if any.
+//
+// The file is rewritten in place, as replacing it would detach it from its
+// bind mount.
+func writeHosts(id, hostname string, ep *network.Endpoint) error {
+	var b strings.Builder
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	if ep != nil && ep.IPNet != nil {
+		fmt.Fprintf(&b, "%s\t%s\n", ep.IPNet.IP, hostname)
+	} else {
+		fmt.Fprintf(&b, "127.0.1.1\t%s\n", hostname)
+	}
+
+	if err := os.WriteFile(filepath.Join(etcDir(id), "hosts"), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write hosts: %w", err)
+	}
+
+	return nil
+}
+
+// mountEtcFiles bind mounts generated files found in dir over those of rootfs.
+//
+// Must be called inside container mount namespace before pivot_root, so mounts
+// vanish with container and never reach its writable layer.
+func mountEtcFiles(dir, rootfs string) error {
+	// /etc itself may be a symlink of image, it is followed within rootfs only
+	etc, _, err := inroot.MkdirAll(rootfs, "/etc", 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create /etc in container: %w", err)
+	}
+
+	for _, name := range etcFiles {
+		src := filepath.Join(dir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+
+		target := filepath.Join(etc, name)
+
+		// Replace symlinks, e.g. resolv.conf pointing outside rootfs, and create
+		// missing files to mount over
+		fi, err := os.Lstat(target)
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("failed to replace /etc/%s: %w", name, err)
+			}
+			err = os.ErrNotExist
+		}
+		if os.IsNotExist(err) {
+			if err := os.WriteFile(target, nil, 0644); err != nil {
+				return fmt.Errorf("failed to create /etc/%s: %w", name, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("failed to check /etc/%s: %w", name, err)
+		} else if fi.IsDir() {
+			return fmt.Errorf("/etc/%s in image is a directory", name)
+		}
+
+		if err := syscall.Mount(src, target, "", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("failed to mount /etc/%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
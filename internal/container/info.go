@@ -7,11 +7,15 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/lutaod/tinydock/internal/cgroups"
 	"github.com/lutaod/tinydock/internal/config"
 	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
 	"github.com/lutaod/tinydock/internal/volume"
 )
 
@@ -23,39 +27,81 @@ const (
 	truncatedPrintCmdLength = maxPrintCmdLength - 3 // Reserve space for "..."
 )
 
-var containerDir = filepath.Join(config.Root, "container")
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
 
-// status represents the runtime state of container.
-type status string
+// containerDir returns directory holding a directory per container.
+func containerDir() string {
+	return filepath.Join(config.Root(), "container")
+}
+
+// namesDir returns directory holding a symlink per container name pointing to
+// ID of its container.
+func namesDir() string {
+	return filepath.Join(containerDir(), ".names")
+}
+
+// Status represents the runtime state of container.
+type Status string
 
 const (
 	// NOTE: For detached containers, the actual process state cannot be monitored
 	// without daemon. Their status will remain "running" until explicitly stopped.
-	running status = "running"
-	exited  status = "exited"
+	Running Status = "running"
+	Paused  Status = "paused"
+	Exited  Status = "exited"
 )
 
-// info stores relevant information of a container.
-type info struct {
-	ID        string            `json:"id"`
-	PID       int               `json:"pid"`
-	Status    status            `json:"status"`
-	Image     string            `json:"image"`
-	Command   []string          `json:"command"`
-	CreatedAt time.Time         `json:"createdAt"`
-	Volumes   volume.Volumes    `json:"volumes"`
-	Endpoint  *network.Endpoint `json:"endpoint"`
-}
-
-// saveInfo persists container information to disk.
-func saveInfo(info *info) error {
-	infoPath := filepath.Join(containerDir, info.ID, infoFile)
+// active reports whether container of status has processes, running or not.
+func (s Status) active() bool {
+	return s == Running || s == Paused
+}
+
+// Info stores relevant information of a container.
+type Info struct {
+	ID          string               `json:"id"`
+	Name        string               `json:"name,omitempty"`
+	PID         int                  `json:"pid"`
+	ShimPID     int                  `json:"shimPid,omitempty"`
+	PIDFile     string               `json:"pidFile,omitempty"`
+	Status      Status               `json:"status"`
+	ExitCode    *int                 `json:"exitCode,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Image       string               `json:"image"`
+	ImageDigest string               `json:"imageDigest"`
+	Command     []string             `json:"command"`
+	Env         []string             `json:"env,omitempty"`
+	OpenStdin   bool                 `json:"openStdin,omitempty"`
+	CreatedAt   time.Time            `json:"createdAt"`
+	Volumes     volume.Volumes       `json:"volumes"`
+	StorageOpts overlay.MountOptions `json:"storageOpts,omitempty"`
+	CPULimit    float64              `json:"cpuLimit,omitempty"`
+	MemoryLimit string               `json:"memoryLimit,omitempty"`
+	Requires    []string             `json:"requires,omitempty"`
+	Security    SecurityOpts         `json:"securityOpts"`
+	Priority    Priority             `json:"priority"`
+	Eviction    int                  `json:"evictionPriority,omitempty"`
+	Labels      Labels               `json:"labels,omitempty"`
+	Endpoint    *network.Endpoint    `json:"endpoint"`
+}
+
+// saveInfo persists container information to disk, readable by root only as
+// environment of container may carry secrets forwarded from host.
+func saveInfo(info *Info) error {
+	infoPath := filepath.Join(containerDir(), info.ID, infoFile)
 	data, err := json.Marshal(info)
 	if err != nil {
 		return fmt.Errorf("failed to marshal container info: %w", err)
 	}
 
-	if err := os.WriteFile(infoPath, data, 0644); err != nil {
+	// Info is replaced rather than rewritten, so one saved readable by others
+	// before is not kept so
+	tmpPath := infoPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save container info: %w", err)
+	}
+	if err := os.Rename(tmpPath, infoPath); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("failed to save container info: %w", err)
 	}
 
@@ -63,14 +109,14 @@ func saveInfo(info *info) error {
 }
 
 // loadInfo retrieves container information of given ID from disk.
-func loadInfo(id string) (*info, error) {
-	infoPath := filepath.Join(containerDir, id, infoFile)
+func loadInfo(id string) (*Info, error) {
+	infoPath := filepath.Join(containerDir(), id, infoFile)
 	data, err := os.ReadFile(infoPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read container info: %w", err)
 	}
 
-	var info info
+	var info Info
 	if err := json.Unmarshal(data, &info); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal container info: %w", err)
 	}
@@ -78,41 +124,304 @@ func loadInfo(id string) (*info, error) {
 	return &info, nil
 }
 
-// listInfo fetches container information matching the filter condition and prints them.
-func listInfo(showAll bool) error {
-	entries, err := os.ReadDir(containerDir)
-	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to read containers directory: %w", err)
+// Resolve expands a container reference into matching container IDs.
+//
+// A reference is either a full ID, a name, a unique ID prefix, or a glob pattern
+// (e.g., "ab*") matching IDs or names of any number of containers.
+func Resolve(ref string) ([]string, error) {
+	if !strings.ContainsAny(ref, "*?[") {
+		id, err := resolveID(ref)
+		if err != nil {
+			return nil, err
+		}
+		return []string{id}, nil
+	}
+
+	if _, err := filepath.Match(ref, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", ref, err)
+	}
+
+	infos, err := loadAllInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []string
+	for _, info := range infos {
+		okID, _ := filepath.Match(ref, info.ID)
+		okName, _ := filepath.Match(ref, info.Name)
+		if okID || info.Name != "" && okName {
+			matched = append(matched, info.ID)
+		}
+	}
+
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no container matches %q", ref)
+	}
+
+	return matched, nil
+}
+
+// resolveID returns ID of container referenced by either its full ID, its name
+// or a unique ID prefix, in that order of precedence.
+func resolveID(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("empty container reference")
+	}
+
+	if _, err := os.Stat(filepath.Join(containerDir(), ref, infoFile)); err == nil {
+		return ref, nil
+	}
+
+	if id, ok := lookupName(ref); ok {
+		return id, nil
+	}
+
+	ids, err := listIDs()
+	if err != nil {
+		return "", err
+	}
+
+	var matched []string
+	for _, id := range ids {
+		if strings.HasPrefix(id, ref) {
+			matched = append(matched, id)
+		}
 	}
 
-	fmt.Printf("%-10s %-10s %-15s %-15s %-15s %-8s %-20s %s\n",
-		"ID", "STATUS", "IMAGE", "IP", "PORTS", "PID", "CREATED", "COMMAND")
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no such container: %s", ref)
+	case 1:
+		return matched[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous container reference %q matches: %s", ref, strings.Join(matched, ", "))
+	}
+}
 
+// listIDs returns IDs of all containers on disk.
+func listIDs() ([]string, error) {
+	entries, err := os.ReadDir(containerDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read containers directory: %w", err)
+	}
+
+	var ids []string
 	for _, entry := range entries {
-		if !entry.IsDir() {
-			continue
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			ids = append(ids, entry.Name())
+		}
+	}
+
+	return ids, nil
+}
+
+// IDs returns IDs of all containers, running or not.
+func IDs() ([]string, error) {
+	return listIDs()
+}
+
+// IDsWithStatus returns IDs of containers with given status.
+func IDsWithStatus(status Status) ([]string, error) {
+	infos, err := loadAllInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, info := range infos {
+		if info.Status == status {
+			ids = append(ids, info.ID)
+		}
+	}
+
+	return ids, nil
+}
+
+// Names returns names of all named containers, running or not.
+func Names() ([]string, error) {
+	infos, err := loadAllInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.Name != "" {
+			names = append(names, info.Name)
+		}
+	}
+
+	return names, nil
+}
+
+// checkName reports an error if name is not a valid container name or is taken
+// by another container.
+func checkName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid container name %q, must match %s", name, validName)
+	}
+
+	if id, ok := lookupName(name); ok {
+		return fmt.Errorf("container name %q is already in use by container %s", name, id)
+	}
+
+	return nil
+}
+
+// reserveName claims name for container of given ID, failing if another
+// container holds it. The claim is atomic, so concurrent runs cannot both get
+// the same name.
+func reserveName(name, id string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(namesDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create names directory: %w", err)
+	}
+
+	link := filepath.Join(namesDir(), name)
+	for {
+		err := os.Symlink(id, link)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("failed to reserve container name: %w", err)
+		}
+
+		// Drop claims left by containers removed without releasing them
+		holder, rerr := os.Readlink(link)
+		if rerr != nil {
+			return fmt.Errorf("failed to read container name: %w", rerr)
+		}
+		if _, err := os.Stat(filepath.Join(containerDir(), holder)); !os.IsNotExist(err) {
+			return fmt.Errorf("container name %q is already in use by container %s", name, holder)
+		}
+		if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove stale container name: %w", err)
+		}
+	}
+}
+
+// Rename gives container a new name, or a first one if it has none. The new
+// name is claimed before the old one is released, so container is never left
+// without a name and no other container can take it in between.
+func Rename(id, name string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Name == name {
+		return fmt.Errorf("container is already named %q", name)
+	}
+
+	if err := reserveName(name, id); err != nil {
+		return err
+	}
+
+	old := info.Name
+	info.Name = name
+	if err := saveInfo(info); err != nil {
+		releaseName(name, id)
+		return err
+	}
+
+	if old != "" {
+		releaseName(old, id)
+	}
+
+	return nil
+}
+
+// releaseName drops claim of container of given ID on name, if it holds it.
+func releaseName(name, id string) {
+	link := filepath.Join(namesDir(), name)
+	if holder, err := os.Readlink(link); err == nil && holder == id {
+		if err := os.Remove(link); err != nil {
+			log.Printf("Failed to release container name %s: %v", name, err)
+		}
+	}
+}
+
+// lookupName returns ID of container holding name, if any.
+func lookupName(name string) (string, bool) {
+	if !validName.MatchString(name) {
+		return "", false
+	}
+
+	id, err := os.Readlink(filepath.Join(namesDir(), name))
+	if err != nil {
+		return "", false
+	}
+
+	info, err := loadInfo(id)
+	if err != nil || info.Name != name {
+		// A container still being created holds its name before saving info
+		if _, err := os.Stat(filepath.Join(containerDir(), id)); err == nil {
+			return id, true
 		}
+		return "", false
+	}
+
+	return id, true
+}
+
+// loadAllInfo retrieves information of all containers from disk.
+//
+// Containers whose information cannot be loaded are skipped with a warning.
+func loadAllInfo() ([]*Info, error) {
+	ids, err := listIDs()
+	if err != nil {
+		return nil, err
+	}
 
-		info, err := loadInfo(entry.Name())
+	var infos []*Info
+	for _, id := range ids {
+		info, err := loadInfo(id)
 		if err != nil {
-			log.Printf("Warning: failed to load container info for %s: %v", entry.Name(), err)
+			log.Printf("Warning: failed to load container info for %s: %v", id, err)
 			continue
 		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// listInfo fetches container information matching the filter condition and prints them.
+func listInfo(showAll, withStats bool, filters LabelFilters) error {
+	infos, err := loadAllInfo()
+	if err != nil {
+		return err
+	}
 
-		if !showAll && info.Status != running {
+	statsHeader := ""
+	if withStats {
+		statsHeader = fmt.Sprintf("%-8s %-12s ", "CPU %", "MEM USAGE")
+	}
+
+	fmt.Printf("%-10s %-15s %-10s %-15s %-15s %-15s %-8s %s%-20s %s\n",
+		"ID", "NAME", "STATUS", "IMAGE", "IP", "PORTS", "PID", statsHeader, "CREATED", "COMMAND")
+
+	for _, info := range infos {
+		if !showAll && !info.Status.active() || !filters.match(info.Labels) {
 			continue
 		}
 
 		var ip, ports string
 		if info.Endpoint != nil {
-			ip = info.Endpoint.IPNet.IP.String()
-			if len(info.Endpoint.PortMappings) > 0 {
-				mappings := make([]string, 0, len(info.Endpoint.PortMappings))
-				for _, p := range info.Endpoint.PortMappings {
-					mappings = append(mappings, fmt.Sprintf("%d->%d", p.HostPort, p.ContainerPort))
-				}
-				ports = strings.Join(mappings, ",")
+			if info.Endpoint.IPNet != nil {
+				ip = info.Endpoint.IPNet.IP.String()
 			}
+			ports = strings.Join(info.Endpoint.Ports(), ",")
 		}
 
 		cmd := strings.Join(info.Command, " ")
@@ -120,8 +429,21 @@ func listInfo(showAll bool) error {
 			cmd = cmd[:truncatedPrintCmdLength] + "..."
 		}
 
-		fmt.Printf("%-10s %-10s %-15s %-15s %-15s %-8d %-20s %s\n",
-			info.ID, info.Status, info.Image, ip, ports, info.PID,
+		var stats string
+		if withStats {
+			cpu, mem := "-", "-"
+			if s, err := cgroups.ReadStats(info.ID); err == nil && info.Status.active() {
+				// A single sample only gives average CPU usage over container lifetime
+				if elapsed := time.Since(info.CreatedAt); elapsed > 0 {
+					cpu = fmt.Sprintf("%.2f%%", float64(s.CPUUsage)/float64(elapsed.Microseconds())*100)
+				}
+				mem = formatBytes(s.MemoryUsage)
+			}
+			stats = fmt.Sprintf("%-8s %-12s ", cpu, mem)
+		}
+
+		fmt.Printf("%-10s %-15s %-10s %-15s %-15s %-15s %-8d %s%-20s %s\n",
+			info.ID, info.Name, info.Status, info.Image, ip, ports, info.PID, stats,
 			info.CreatedAt.Format("2006-01-02 15:04:05"), cmd)
 	}
 
@@ -130,7 +452,11 @@ func listInfo(showAll bool) error {
 
 // removeInfo deletes container information from disk.
 func removeInfo(id string) error {
-	infoDir := filepath.Join(containerDir, id)
+	if info, err := loadInfo(id); err == nil && info.Name != "" {
+		releaseName(info.Name, id)
+	}
+
+	infoDir := filepath.Join(containerDir(), id)
 	if err := os.RemoveAll(infoDir); err != nil {
 		return fmt.Errorf("failed to remove container directory: %w", err)
 	}
@@ -139,21 +465,33 @@ func removeInfo(id string) error {
 }
 
 // handleLifecycle manages container process lifecycle, including cleanup and status updates.
-func handleLifecycle(cmd *exec.Cmd, info *info, detached bool, autoRemove bool) error {
+func handleLifecycle(cmd *exec.Cmd, info *Info, detached bool, autoRemove bool, ready Readiness) error {
 	if detached {
+		if ready.Pattern != nil {
+			if err := ready.wait(info, cmd.Process.Pid); err != nil {
+				return fmt.Errorf("container %s: %w", info.ID, err)
+			}
+		}
+
 		if err := cmd.Process.Release(); err != nil {
 			return fmt.Errorf("failed to release container: %w", err)
 		}
 
+		ready.notify(info.PID, true)
 		fmt.Println(info.ID)
 		return nil
 	}
 
 	defer func() {
-		info.Status = exited
+		info.Status = Exited
+		if cmd.ProcessState != nil {
+			code := exitCode(cmd.ProcessState.Sys().(syscall.WaitStatus))
+			info.ExitCode = &code
+		}
 		if err := saveInfo(info); err != nil {
 			log.Print(err)
 		}
+		removePIDFile(info)
 
 		if autoRemove {
 			if err := Remove(info.ID, false); err != nil {
@@ -162,9 +500,20 @@ func handleLifecycle(cmd *exec.Cmd, info *info, detached bool, autoRemove bool)
 		}
 	}()
 
+	ready.notify(info.PID, false)
+
 	if err := cmd.Wait(); err != nil {
 		return fmt.Errorf("failed to wait for container: %w", err)
 	}
 
 	return nil
 }
+
+// exitCode returns exit code of a container process as a shell reports it,
+// 128 plus signal number if it was killed by a signal.
+func exitCode(ws syscall.WaitStatus) int {
+	if ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return ws.ExitStatus()
+}
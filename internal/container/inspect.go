@@ -0,0 +1,55 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+// inspectInfo is the document printed by Inspect.
+type inspectInfo struct {
+	*Info
+	CgroupPath string         `json:"cgroupPath"`
+	Overlay    overlay.Layout `json:"overlay"`
+}
+
+// Inspect prints full state of given container as JSON: its stored info along
+// with cgroup and overlay directories on host.
+//
+// A detached container found gone is shown as exited, though without exit code,
+// as no one waited for it.
+func Inspect(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return err
+	}
+
+	if info.Status.active() && (syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id)) {
+		info.Status = Exited
+	}
+
+	layout, err := overlay.ContainerLayout(id)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(inspectInfo{
+		Info:       info,
+		CgroupPath: cgroups.Path(id),
+		Overlay:    layout,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal container info: %w", err)
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
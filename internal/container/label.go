@@ -0,0 +1,93 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Labels implements flag.Value for collecting KEY=VALUE metadata attached to a
+// container. A KEY without value sets an empty label.
+type Labels map[string]string
+
+func (l *Labels) String() string {
+	pairs := make([]string, 0, len(*l))
+	for k, v := range *l {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (l *Labels) Set(value string) error {
+	key, val, _ := strings.Cut(value, "=")
+	if key = strings.TrimSpace(key); key == "" {
+		return fmt.Errorf("invalid label %q: expect KEY[=VALUE]", value)
+	}
+
+	if *l == nil {
+		*l = make(Labels)
+	}
+	(*l)[key] = val
+	return nil
+}
+
+// ReadFile adds labels of file at path, one KEY[=VALUE] per line. Blank lines
+// and lines starting with '#' are skipped.
+func (l *Labels) ReadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open label file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := l.Set(line); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read label file: %w", err)
+	}
+
+	return nil
+}
+
+// LabelFilters implements flag.Value for collecting label=KEY[=VALUE] filters
+// of listed containers. A container must match all of them.
+type LabelFilters []string
+
+func (f *LabelFilters) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *LabelFilters) Set(value string) error {
+	label, ok := strings.CutPrefix(value, "label=")
+	if !ok || label == "" || label[0] == '=' {
+		return fmt.Errorf("invalid filter %q: expect label=KEY[=VALUE]", value)
+	}
+
+	*f = append(*f, label)
+	return nil
+}
+
+// match reports whether labels satisfy all filters. A filter of only KEY is
+// satisfied by label of any value.
+func (f LabelFilters) match(labels map[string]string) bool {
+	for _, filter := range f {
+		key, want, hasValue := strings.Cut(filter, "=")
+		got, ok := labels[key]
+		if !ok || hasValue && got != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,140 @@
+// This file implements mounting volumes into running containers. A mount tree
+// cloned on host is passed to a child process that enters container's mount
+// namespace and attaches it there, as setns into a mount namespace is only
+// possible before Go runtime spins up additional threads.
+
+package container
+
+/*
+#define _GNU_SOURCE
+#include <errno.h>
+#include <fcntl.h>
+#include <sched.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <sys/stat.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#ifndef SYS_move_mount
+#define SYS_move_mount 429
+#endif
+#define MOVE_MOUNT_F_EMPTY_PATH 0x00000004
+
+// Cloned mount tree is passed as first extra file
+#define TREE_FD 3
+
+__attribute__((constructor)) void attach_mount(void) {
+   const char* container_pid = getenv("TINYDOCK_MOUNT_PID");
+   const char* target = getenv("TINYDOCK_MOUNT_TARGET");
+
+   if (!container_pid || !target) {
+       return;
+   }
+
+   char nspath[64];
+   snprintf(nspath, sizeof(nspath), "/proc/%s/ns/mnt", container_pid);
+
+   int fd = open(nspath, O_RDONLY);
+   if (fd < 0) {
+       fprintf(stderr, "failed to open mnt namespace: %s\n", strerror(errno));
+       exit(1);
+   }
+
+   // Entering mount namespace also moves root and working directory to its root
+   if (setns(fd, CLONE_NEWNS) == -1) {
+       fprintf(stderr, "failed to enter mnt namespace: %s\n", strerror(errno));
+       exit(1);
+   }
+   close(fd);
+
+   // Mount made on host may have propagated into container already
+   struct stat tree, st;
+   if (fstat(TREE_FD, &tree) == 0 && stat(target, &st) == 0 &&
+           tree.st_dev == st.st_dev && tree.st_ino == st.st_ino) {
+       exit(0);
+   }
+
+   if (syscall(SYS_move_mount, TREE_FD, "", AT_FDCWD, target, MOVE_MOUNT_F_EMPTY_PATH) == -1) {
+       fprintf(stderr, "failed to mount %s: %s\n", target, strerror(errno));
+       exit(1);
+   }
+
+   exit(0);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/volume"
+	"golang.org/x/sys/unix"
+)
+
+// Mount bind mounts a volume into a running container and records it, so it is
+// cleaned up on removal like volumes given at creation.
+//
+// Volume is mounted into container's overlay on host as well, requiring a kernel
+// supporting open_tree and move_mount (Linux 5.2+).
+func Mount(id string, v volume.Volume) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status != Running {
+		return fmt.Errorf("container is not running")
+	}
+
+	for _, existing := range info.Volumes {
+		if existing.Target == v.Target {
+			return fmt.Errorf("%s is already a volume of container", v.Target)
+		}
+	}
+
+	err = overlay.AddVolume(id, v, func() error {
+		return attachMount(info.PID, v)
+	})
+	if err != nil {
+		return err
+	}
+
+	info.Volumes = append(info.Volumes, v)
+	return saveInfo(info)
+}
+
+// attachMount mounts source of volume onto its target in mount namespace of
+// process with given pid.
+func attachMount(pid int, v volume.Volume) error {
+	fd, err := unix.OpenTree(unix.AT_FDCWD, v.Source, unix.OPEN_TREE_CLONE|unix.OPEN_TREE_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("failed to clone mount of %s: %w", v.Source, err)
+	}
+	tree := os.NewFile(uintptr(fd), v.Source)
+	defer tree.Close()
+
+	cmd := exec.Command("/proc/self/exe", "mount")
+	cmd.Env = []string{
+		// Set env vars for C constructor
+		fmt.Sprintf("TINYDOCK_MOUNT_PID=%d", pid),
+		"TINYDOCK_MOUNT_TARGET=" + v.Target,
+	}
+	cmd.ExtraFiles = []*os.File{tree}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to mount volume in container: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package container
+
+import (
+	"fmt"
+
+	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/preflight"
+)
+
+// Netem emulates given network conditions, such as delay and packet loss, on
+// traffic of a running container.
+func Netem(id string, imp network.Impairment) error {
+	ep, err := runningEndpoint(id)
+	if err != nil {
+		return err
+	}
+
+	return network.ApplyImpairment(ep, imp)
+}
+
+// ClearNetem removes network conditions emulated on a container's traffic.
+func ClearNetem(id string) error {
+	ep, err := runningEndpoint(id)
+	if err != nil {
+		return err
+	}
+
+	return network.ClearImpairment(ep)
+}
+
+// runningEndpoint returns network endpoint of a running container.
+func runningEndpoint(id string) (*network.Endpoint, error) {
+	if err := preflight.Verify(preflight.TC); err != nil {
+		return nil, err
+	}
+
+	id, err := resolveID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return nil, fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if !info.Status.active() {
+		return nil, fmt.Errorf("container is not running")
+	}
+
+	if info.Endpoint == nil {
+		return nil, fmt.Errorf("container is not connected to a network")
+	}
+
+	return info.Endpoint, nil
+}
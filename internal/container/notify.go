@@ -0,0 +1,70 @@
+package container
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// notifySocketEnv names variable systemd passes path of its notification
+// socket in to services of Type=notify.
+const notifySocketEnv = "NOTIFY_SOCKET"
+
+// sdNotify sends state to service manager as sd_notify(3) does, e.g. "READY=1".
+// It does nothing unless run under a manager expecting notifications.
+func sdNotify(state string) error {
+	socket := os.Getenv(notifySocketEnv)
+	if socket == "" {
+		return nil
+	}
+
+	// Leading '@' denotes an abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to notification socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
+
+// writePIDFile writes PID of container init process to path, replacing it
+// atomically so readers never see a partial file.
+func writePIDFile(path string, pid int) error {
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmpPath, []byte(strconv.Itoa(pid)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write pid file: %w", err)
+	}
+
+	return nil
+}
+
+// removePIDFile removes pid file of container, if it still holds its PID.
+func removePIDFile(info *Info) {
+	if info.PIDFile == "" {
+		return
+	}
+
+	data, err := os.ReadFile(info.PIDFile)
+	if err != nil || string(data) != strconv.Itoa(info.PID)+"\n" {
+		return
+	}
+	if err := os.Remove(info.PIDFile); err != nil {
+		log.Printf("Failed to remove pid file %s: %v", info.PIDFile, err)
+	}
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+)
+
+// Pause freezes all processes of a running container through cgroup freezer,
+// until Unpause. Unlike SIGSTOP, processes cannot notice or resist it.
+func Pause(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	switch {
+	case info.Status == Paused:
+		return fmt.Errorf("container is already paused")
+	case info.Status != Running || syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id):
+		return fmt.Errorf("container is not running")
+	}
+
+	if err := cgroups.Freeze(id); err != nil {
+		return err
+	}
+
+	info.Status = Paused
+	if err := saveInfo(info); err != nil {
+		if err := cgroups.Thaw(id); err != nil {
+			return err
+		}
+		return fmt.Errorf("failed to update container status: %w", err)
+	}
+
+	return nil
+}
+
+// Unpause resumes processes of a container frozen by Pause.
+func Unpause(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status != Paused {
+		return fmt.Errorf("container is not paused")
+	}
+
+	if err := cgroups.Thaw(id); err != nil {
+		return err
+	}
+
+	info.Status = Running
+	if err := saveInfo(info); err != nil {
+		return fmt.Errorf("failed to update container status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package container
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+// Plan prints what Init would do to run a container with given options,
+// without creating or changing anything on host.
+//
+// A container ID is generated for illustration only, an actual run gets a
+// different one.
+func Plan(image string, args []string, opts Options) error {
+	if err := opts.Priority.validate(); err != nil {
+		return err
+	}
+
+	if _, err := checkRequires(opts.Requires); err != nil {
+		return err
+	}
+
+	if opts.Name != "" {
+		if err := checkName(opts.Name); err != nil {
+			return err
+		}
+	}
+
+	id := generateID()
+
+	overlaySteps, err := overlay.Plan(image, id, opts.Volumes, opts.StorageOpts)
+	if err != nil {
+		return err
+	}
+
+	cgroupSteps, err := cgroups.Plan(id, opts.CPULimit, opts.MemoryLimit)
+	if err != nil {
+		return err
+	}
+
+	networkSteps, err := network.Plan(opts.Network, opts.Ports)
+	if err != nil {
+		return err
+	}
+
+	cmd, err := describeCmd(id, opts.Envs, opts.Security, opts.Priority)
+	if err != nil {
+		return err
+	}
+
+	mergedDir := overlay.MergedDir(id)
+	etcNames := etcFiles[:2]
+	if !opts.DNS.isEmpty() {
+		etcNames = etcFiles
+	}
+	var etcSteps []string
+	for _, name := range etcNames {
+		etcSteps = append(etcSteps, fmt.Sprintf("write %s", filepath.Join(etcDir(id), name)))
+	}
+
+	printPlan("Container", []string{
+		fmt.Sprintf("generate container ID (e.g., %s)", id),
+		fmt.Sprintf("mkdir %s", filepath.Join(containerDir(), id)),
+	})
+	printPlan("Filesystem", append(overlaySteps, etcSteps...))
+	printPlan("Process", cmd)
+	printPlan("Cgroup", cgroupSteps)
+	printPlan("Network", networkSteps)
+	printPlan("Inside container", initSteps(id, mergedDir, etcNames, args, opts.Security, opts.Priority))
+
+	return nil
+}
+
+// describeCmd describes container init process prepareCmd would start.
+func describeCmd(id string, envs Envs, securityOpts SecurityOpts, priority Priority) ([]string, error) {
+	// Interactive command is only built, not started, so no log file is created
+	cmd, err := prepareCmd(id, envs, true, false, securityOpts, priority, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		fmt.Sprintf("start %s in new UTS, IPC, PID, mount and network namespaces", strings.Join(cmd.Args, " ")),
+		fmt.Sprintf("environment: %s", strings.Join(cmd.Env, " ")),
+		"pass user command to init through pipe on fd 3",
+		"read setup errors of init from pipe on fd 4 until it runs user command",
+	}, nil
+}
+
+// initSteps describes what container init process does before running user command.
+func initSteps(id, mergedDir string, etcNames, args []string, opts SecurityOpts, priority Priority) []string {
+	sysMode := "read-only"
+	if opts.WritableSys {
+		sysMode = "read-write"
+	}
+
+	steps := []string{
+		fmt.Sprintf("set hostname to %s", id),
+		"make all mounts private",
+		fmt.Sprintf("bind mount %s over /etc/{%s}", etcDir(id), strings.Join(etcNames, ",")),
+		fmt.Sprintf("pivot_root into %s", mergedDir),
+		"mount proc on /proc",
+		fmt.Sprintf("mount sysfs on /sys %s", sysMode),
+	}
+
+	var masked []string
+	for _, p := range maskedPaths {
+		if (opts.UnmaskProc && strings.HasPrefix(p, "/proc")) || (opts.WritableSys && strings.HasPrefix(p, "/sys")) {
+			continue
+		}
+		masked = append(masked, p)
+	}
+	if len(masked) > 0 {
+		steps = append(steps, fmt.Sprintf("mask %s", strings.Join(masked, " ")))
+	}
+	if !opts.UnmaskProc {
+		steps = append(steps, fmt.Sprintf("remount read-only %s", strings.Join(readonlyPaths, " ")))
+		if opts.NetAdmin {
+			steps = append(steps, fmt.Sprintf("remount read-write %s", netSysctlPath))
+		}
+	}
+
+	steps = append(steps,
+		"unmount old root",
+		"mount tmpfs on /dev",
+	)
+
+	if priority.RTPriority != 0 {
+		steps = append(steps, fmt.Sprintf("set SCHED_RR real-time priority %d", priority.RTPriority))
+	} else if priority.Nice != 0 {
+		steps = append(steps, fmt.Sprintf("set nice %d", priority.Nice))
+	}
+
+	return append(steps, fmt.Sprintf("exec %s", strings.Join(args, " ")))
+}
+
+// printPlan prints a titled list of steps.
+func printPlan(title string, steps []string) {
+	if len(steps) == 0 {
+		return
+	}
+
+	fmt.Printf("%s:\n", title)
+	for _, s := range steps {
+		fmt.Printf("  %s\n", s)
+	}
+	fmt.Println()
+}
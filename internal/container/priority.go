@@ -0,0 +1,85 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	niceArg       = "nice="
+	rtPriorityArg = "rt="
+)
+
+// Priority holds scheduling settings of container init process, inherited by
+// user command and its children.
+type Priority struct {
+	// Nice is niceness from -20 (highest priority) to 19 (lowest).
+	Nice int
+
+	// RTPriority runs container under SCHED_RR real-time policy with given
+	// priority from 1 to 99, or under normal policy if 0. Nice has no effect
+	// on real-time processes.
+	RTPriority int
+}
+
+// validate checks settings are in ranges accepted by kernel.
+func (p Priority) validate() error {
+	if p.Nice < -20 || p.Nice > 19 {
+		return fmt.Errorf("invalid nice value %d: expect -20 to 19", p.Nice)
+	}
+	if p.RTPriority < 0 || p.RTPriority > 99 {
+		return fmt.Errorf("invalid real-time priority %d: expect 1 to 99", p.RTPriority)
+	}
+	return nil
+}
+
+// initArgs encodes non-default settings as arguments for container init process.
+func (p Priority) initArgs() []string {
+	var args []string
+	if p.Nice != 0 {
+		args = append(args, niceArg+strconv.Itoa(p.Nice))
+	}
+	if p.RTPriority != 0 {
+		args = append(args, rtPriorityArg+strconv.Itoa(p.RTPriority))
+	}
+	return args
+}
+
+// parseArg decodes a single init argument, reporting false if it is not a
+// priority setting.
+func (p *Priority) parseArg(arg string) (bool, error) {
+	var err error
+	switch {
+	case strings.HasPrefix(arg, niceArg):
+		p.Nice, err = strconv.Atoi(strings.TrimPrefix(arg, niceArg))
+	case strings.HasPrefix(arg, rtPriorityArg):
+		p.RTPriority, err = strconv.Atoi(strings.TrimPrefix(arg, rtPriorityArg))
+	default:
+		return false, nil
+	}
+
+	if err != nil {
+		return true, fmt.Errorf("invalid priority argument %q: %w", arg, err)
+	}
+	return true, nil
+}
+
+// apply sets scheduling policy and priority of calling thread.
+//
+// Scheduling attributes are per thread, so caller must lock goroutine to its OS
+// thread and exec user command from the same thread for them to carry over.
+func (p Priority) apply() error {
+	attr := &unix.SchedAttr{Policy: unix.SCHED_NORMAL, Nice: int32(p.Nice)}
+	if p.RTPriority != 0 {
+		attr = &unix.SchedAttr{Policy: unix.SCHED_RR, Priority: uint32(p.RTPriority)}
+	}
+
+	if err := unix.SchedSetAttr(0, attr, 0); err != nil {
+		return fmt.Errorf("failed to set scheduling priority: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+	"time"
+)
+
+// readyPollInterval is how often log is checked for new output while waiting.
+const readyPollInterval = 100 * time.Millisecond
+
+// Readiness makes a detached run stay attached to container output until the
+// container reports it is ready.
+type Readiness struct {
+	// Pattern is matched against each log line, nil to detach immediately.
+	Pattern *regexp.Regexp
+
+	// Timeout bounds wait, 0 for no limit.
+	Timeout time.Duration
+
+	// Notify sends READY=1 to systemd once container is started, or ready if
+	// Pattern is set, so units of Type=notify can wrap a run.
+	Notify bool
+}
+
+// notify reports container of given init PID ready to service manager, if
+// asked to. A detached run exits, so container becomes main process of unit.
+func (r Readiness) notify(pid int, detached bool) {
+	if !r.Notify {
+		return
+	}
+
+	state := "READY=1"
+	if detached {
+		state = fmt.Sprintf("MAINPID=%d\n%s", pid, state)
+	}
+	if err := sdNotify(state); err != nil {
+		log.Print(err)
+	}
+}
+
+// wait streams container log to stdout until a line matches pattern.
+//
+// It fails if container exits or timeout elapses first. Child of given pid, the
+// container or its shim, is reaped once exited and container recorded as such.
+func (r Readiness) wait(info *Info, pid int) error {
+	logPath := filepath.Join(containerDir(), info.ID, "container.log")
+	file, err := os.Open(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	var deadline time.Time
+	if r.Timeout > 0 {
+		deadline = time.Now().Add(r.Timeout)
+	}
+
+	reader := bufio.NewReader(file)
+	var partial string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read log: %w", err)
+		}
+
+		if line != "" {
+			fmt.Print(line)
+		}
+
+		// Only match complete lines, the rest may still be written
+		partial += line
+		if err == nil {
+			if r.Pattern.MatchString(partial[:len(partial)-1]) {
+				return nil
+			}
+			partial = ""
+			continue
+		}
+
+		var status syscall.WaitStatus
+		if reaped, _ := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); reaped == pid {
+			info.Status = Exited
+			code := exitCode(status)
+			info.ExitCode = &code
+			if err := saveInfo(info); err != nil {
+				return err
+			}
+			return fmt.Errorf("container exited with code %d before becoming ready", code)
+		}
+
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return fmt.Errorf("container not ready after %s", r.Timeout)
+		}
+
+		time.Sleep(readyPollInterval)
+	}
+}
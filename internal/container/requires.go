@@ -0,0 +1,32 @@
+package container
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// checkRequires resolves containers a new one requires and returns their IDs,
+// failing unless all of them are running.
+func checkRequires(refs []string) ([]string, error) {
+	var ids []string
+	for _, ref := range refs {
+		id, err := resolveID(ref)
+		if err != nil {
+			return nil, fmt.Errorf("required container %s: %w", ref, err)
+		}
+
+		info, err := loadInfo(id)
+		if err != nil {
+			return nil, fmt.Errorf("error loading container %s: %w", id, err)
+		}
+
+		// Detached containers keep running status after exiting on their own
+		if info.Status != Running || syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id) {
+			return nil, fmt.Errorf("required container %s is not running", id)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
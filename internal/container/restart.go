@@ -0,0 +1,224 @@
+package container
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/metrics"
+	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
+	"github.com/lutaod/tinydock/internal/preflight"
+)
+
+// DefaultStopTimeout is how long Restart waits for a container to exit after
+// SIGTERM before killing it.
+const DefaultStopTimeout = 10 * time.Second
+
+// Start runs the recorded command of a stopped container again, detached, with
+// the image, environment, volumes, limits and network it was created with.
+//
+// Container keeps its ID, log and filesystem, as its overlay upper layer is
+// reused. Its network endpoint is created anew, so it may get a different IP
+// address.
+func Start(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status.active() && syscall.Kill(info.PID, 0) == nil && verifyProcess(info.PID, id) {
+		return fmt.Errorf("container is already %s", info.Status)
+	}
+	removePIDFile(info)
+
+	if info.Endpoint != nil && info.Endpoint.IPNet != nil {
+		if err := network.Disconnect(info.Endpoint); err != nil {
+			return err
+		}
+
+		// Network settings are kept to connect again, only address is given up
+		info.Endpoint.IPNet, info.Endpoint.HostInterface, info.Endpoint.Veth = nil, "", ""
+	}
+
+	info.Status = Exited
+	if err := saveInfo(info); err != nil {
+		return fmt.Errorf("failed to update container status: %w", err)
+	}
+
+	return start(info)
+}
+
+// Restart stops a container, killing it if it does not exit within timeout, and
+// starts it again as Start does.
+func Restart(id string, timeout time.Duration) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status.active() && syscall.Kill(info.PID, 0) == nil && verifyProcess(info.PID, id) {
+		syscall.Kill(info.PID, syscall.SIGTERM)
+
+		// Paused container gets to handle signal once thawed
+		if info.Status == Paused {
+			if err := cgroups.Thaw(id); err != nil {
+				return err
+			}
+		}
+
+		if !waitExit(info.PID, timeout) {
+			syscall.Kill(info.PID, syscall.SIGKILL)
+			if !waitExit(info.PID, time.Second) {
+				return fmt.Errorf("container did not stop")
+			}
+		}
+		waitShim(info)
+	}
+
+	return Start(id)
+}
+
+// start launches init process of a stopped container from its recorded info
+// and detaches from it once user command runs.
+func start(info *Info) error {
+	started := time.Now()
+
+	var nw string
+	var ports network.PortMappings
+	var exposed network.ExposedPorts
+	if info.Endpoint != nil {
+		nw, ports, exposed = info.Endpoint.Network, info.Endpoint.PortMappings, info.Endpoint.ExposedPorts
+	}
+
+	if err := preflight.Verify(preflight.ForRun(nw != "")...); err != nil {
+		return err
+	}
+
+	if err := checkAdmission(info.CPULimit, info.MemoryLimit); err != nil {
+		return err
+	}
+
+	if _, err := checkRequires(info.Requires); err != nil {
+		return err
+	}
+
+	// Overlay is gone after host reboots, as are volumes mounted into it
+	if !overlay.Mounted(info.ID) {
+		mountStarted := time.Now()
+		if _, err := overlay.Setup(info.Image, info.ID, info.Volumes, info.StorageOpts); err != nil {
+			return err
+		}
+		metrics.Record(metrics.OpMount, info.ID, mountStarted)
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	errReader, errWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create pipe: %w", err)
+	}
+	defer errReader.Close()
+
+	cmd, err := prepareCmd(info.ID, Envs(info.Env), false, true, info.Security, info.Priority, reader, errWriter)
+	if err != nil {
+		reader.Close()
+		errWriter.Close()
+		return err
+	}
+	cmd.Dir = overlay.MergedDir(info.ID)
+
+	s, err := attachShim(cmd, info.ID, info.OpenStdin)
+	if err != nil {
+		reader.Close()
+		errWriter.Close()
+		return err
+	}
+	defer s.release()
+
+	if err := cmd.Start(); err != nil {
+		reader.Close()
+		errWriter.Close()
+		return fmt.Errorf("failed to start container: %w", err)
+	}
+	reader.Close()
+	errWriter.Close()
+
+	pid, err := s.containerPID()
+	if err != nil {
+		return err
+	}
+
+	if err := writeArgsToPipe(writer, info.Command); err != nil {
+		return err
+	}
+
+	info.PID = pid
+	info.ShimPID = cmd.Process.Pid
+	info.Status = Running
+	info.ExitCode = nil
+	info.Error = ""
+
+	if err := cgroups.Configure(info.ID, info.PID, info.CPULimit, info.MemoryLimit); err != nil {
+		return initFailed(err, errReader)
+	}
+
+	connectStarted := time.Now()
+	endpoint, err := network.Setup(info.PID, nw, ports)
+	if err != nil {
+		return initFailed(err, errReader)
+	}
+	if endpoint != nil {
+		metrics.Record(metrics.OpConnect, info.ID, connectStarted)
+	}
+	if endpoint != nil {
+		endpoint.ExposedPorts = exposed
+
+		if err := writeHosts(info.ID, hostnameOf(cmd.Env), endpoint); err != nil {
+			return err
+		}
+	}
+	info.Endpoint = endpoint
+
+	if err := saveInfo(info); err != nil {
+		return err
+	}
+	s.release()
+
+	if info.PIDFile != "" {
+		if err := writePIDFile(info.PIDFile, info.PID); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if msg := readInitError(errReader, 0); msg != "" {
+		info.Error = msg
+		if err := handleLifecycle(cmd, info, false, false, Readiness{}); err != nil {
+			log.Print(err)
+		}
+		return fmt.Errorf("container %s failed to start: %s", info.ID, msg)
+	}
+	metrics.Record(metrics.OpStart, info.ID, started)
+
+	if err := cmd.Process.Release(); err != nil {
+		return fmt.Errorf("failed to release container: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// maskedPaths are procfs and sysfs entries hidden from containers by default
+// as they expose host kernel internals.
+var maskedPaths = []string{
+	"/proc/acpi",
+	"/proc/asound",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/sys/firmware",
+}
+
+// readonlyPaths are procfs entries remounted read-only by default to prevent
+// containers from changing host kernel settings.
+var readonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+// netSysctlPath holds network sysctls, which only apply to network namespace
+// of container, so are safe to leave writable.
+const netSysctlPath = "/proc/sys/net"
+
+// SecurityOpts relaxes default hardening of container procfs and sysfs, and
+// implements flag.Value interface.
+//
+// Supported values:
+//   - proc=unmasked: do not mask or remount read-only any /proc entries.
+//   - sys=rw: mount /sys read-write and do not mask /sys entries.
+//   - net=admin: keep network sysctls writable, e.g. to enable IP forwarding
+//     in routers and VPNs. Containers hold CAP_NET_ADMIN and CAP_NET_RAW as
+//     root already, so this is all network tooling lacks.
+type SecurityOpts struct {
+	UnmaskProc  bool
+	WritableSys bool
+	NetAdmin    bool
+}
+
+func (o *SecurityOpts) String() string {
+	var opts []string
+	if o.UnmaskProc {
+		opts = append(opts, "proc=unmasked")
+	}
+	if o.WritableSys {
+		opts = append(opts, "sys=rw")
+	}
+	if o.NetAdmin {
+		opts = append(opts, "net=admin")
+	}
+	return strings.Join(opts, ",")
+}
+
+func (o *SecurityOpts) Set(value string) error {
+	switch value {
+	case "proc=unmasked":
+		o.UnmaskProc = true
+	case "sys=rw":
+		o.WritableSys = true
+	case "net=admin":
+		o.NetAdmin = true
+	default:
+		return fmt.Errorf("unsupported security option: %s (expect proc=unmasked, sys=rw or net=admin)", value)
+	}
+
+	return nil
+}
+
+// initArgs encodes options as arguments for container init process.
+func (o SecurityOpts) initArgs() []string {
+	var args []string
+	if o.UnmaskProc {
+		args = append(args, "proc=unmasked")
+	}
+	if o.WritableSys {
+		args = append(args, "sys=rw")
+	}
+	if o.NetAdmin {
+		args = append(args, "net=admin")
+	}
+	return args
+}
+
+// parseInitArgs decodes options passed to container init process, along with
+// directory of generated /etc files.
+func parseInitArgs(args []string) (SecurityOpts, Priority, string, error) {
+	var opts SecurityOpts
+	var priority Priority
+	var etc string
+	for _, arg := range args {
+		if dir, ok := strings.CutPrefix(arg, etcArg); ok {
+			etc = dir
+			continue
+		}
+		if ok, err := priority.parseArg(arg); ok || err != nil {
+			if err != nil {
+				return opts, priority, etc, err
+			}
+			continue
+		}
+		if err := opts.Set(arg); err != nil {
+			return opts, priority, etc, err
+		}
+	}
+	return opts, priority, etc, nil
+}
+
+// mountSysfs mounts sysfs at /sys, read-only unless relaxed by opts.
+func mountSysfs(opts SecurityOpts) error {
+	if err := os.MkdirAll("/sys", 0755); err != nil {
+		return fmt.Errorf("failed to create /sys: %w", err)
+	}
+
+	flags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
+	if !opts.WritableSys {
+		flags |= syscall.MS_RDONLY
+	}
+
+	if err := syscall.Mount("sysfs", "/sys", "sysfs", uintptr(flags), ""); err != nil {
+		return fmt.Errorf("failed to mount sysfs: %w", err)
+	}
+
+	return nil
+}
+
+// hardenMounts masks and remounts read-only sensitive procfs and sysfs paths.
+//
+// Must be called after pivot_root but before old root is unmounted, as files
+// are masked by bind mounting host's /dev/null found under oldRoot.
+func hardenMounts(oldRoot string, opts SecurityOpts) error {
+	devNull := filepath.Join(oldRoot, "dev", "null")
+
+	for _, p := range maskedPaths {
+		if strings.HasPrefix(p, "/proc/") && opts.UnmaskProc {
+			continue
+		}
+		if strings.HasPrefix(p, "/sys/") && opts.WritableSys {
+			continue
+		}
+
+		if err := maskPath(p, devNull); err != nil {
+			return err
+		}
+	}
+
+	if opts.UnmaskProc {
+		return nil
+	}
+
+	for _, p := range readonlyPaths {
+		if err := remountReadonly(p); err != nil {
+			return err
+		}
+	}
+
+	if opts.NetAdmin {
+		if err := remountWritable(netSysctlPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// maskPath hides given path by mounting an empty read-only tmpfs over
+// directories, or /dev/null over files.
+func maskPath(path, devNull string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	if fi.IsDir() {
+		err = syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_RDONLY, "")
+	} else {
+		err = syscall.Mount(devNull, path, "", syscall.MS_BIND, "")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to mask %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// remountReadonly bind mounts given path onto itself and remounts it read-only.
+func remountReadonly(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("failed to bind mount %s: %w", path, err)
+	}
+
+	flags := syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY
+	if err := syscall.Mount(path, path, "", uintptr(flags), ""); err != nil {
+		return fmt.Errorf("failed to remount %s read-only: %w", path, err)
+	}
+
+	return nil
+}
+
+// remountWritable bind mounts given path, found under a read-only mount, onto
+// itself and remounts it read-write, as bind mounts inherit read-only flag.
+func remountWritable(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := syscall.Mount(path, path, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("failed to bind mount %s: %w", path, err)
+	}
+
+	flags := syscall.MS_BIND | syscall.MS_REMOUNT
+	if err := syscall.Mount(path, path, "", uintptr(flags), ""); err != nil {
+		return fmt.Errorf("failed to remount %s read-write: %w", path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const execSessionDir = "exec"
+
+// session records an exec session running inside a container.
+type session struct {
+	PID        int       `json:"pid"`
+	Command    []string  `json:"command"`
+	User       string    `json:"user"`
+	StartedAt  time.Time `json:"startedAt"`
+	Privileged bool      `json:"privileged,omitempty"`
+}
+
+// saveSession records an active exec session under container directory.
+func saveSession(id string, s *session) error {
+	dir := filepath.Join(containerDir(), id, execSessionDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create exec session directory: %w", err)
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal exec session: %w", err)
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(s.PID)+".json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save exec session: %w", err)
+	}
+
+	return nil
+}
+
+// removeSession deletes record of an exec session.
+func removeSession(id string, pid int) error {
+	path := filepath.Join(containerDir(), id, execSessionDir, strconv.Itoa(pid)+".json")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove exec session: %w", err)
+	}
+
+	return nil
+}
+
+// loadSessions retrieves active exec sessions of a container, pruning records
+// of sessions whose process no longer exists.
+func loadSessions(id string) ([]*session, error) {
+	dir := filepath.Join(containerDir(), id, execSessionDir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read exec session directory: %w", err)
+	}
+
+	var sessions []*session
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read exec session: %w", err)
+		}
+
+		var s session
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal exec session: %w", err)
+		}
+
+		if err := syscall.Kill(s.PID, 0); err != nil {
+			if err := removeSession(id, s.PID); err != nil {
+				log.Print(err)
+			}
+			continue
+		}
+		sessions = append(sessions, &s)
+	}
+
+	return sessions, nil
+}
+
+// ListSessions prints active exec sessions of a container.
+func ListSessions(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := loadInfo(id); err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	sessions, err := loadSessions(id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-8s %-12s %-20s %-5s %s\n", "PID", "USER", "STARTED", "PRIV", "COMMAND")
+
+	for _, s := range sessions {
+		cmd := strings.Join(s.Command, " ")
+		if len(cmd) > maxPrintCmdLength {
+			cmd = cmd[:truncatedPrintCmdLength] + "..."
+		}
+
+		priv := "-"
+		if s.Privileged {
+			priv = "yes"
+		}
+
+		fmt.Printf("%-8d %-12s %-20s %-5s %s\n",
+			s.PID, s.User, s.StartedAt.Format("2006-01-02 15:04:05"), priv, cmd)
+	}
+
+	return nil
+}
+
+// KillSession sends a signal to an exec session and every process it spawned.
+func KillSession(id string, pid int, sig string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := loadSessions(id)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, s := range sessions {
+		if s.PID == pid {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no exec session %d in container %s", pid, id)
+	}
+
+	signal := syscall.SIGKILL
+	if sig != "" {
+		signal, err = parseSignal(sig)
+		if err != nil {
+			return fmt.Errorf("failed to parse signal: %w", err)
+		}
+	}
+
+	// Signal descendants first so they are not reparented before being found
+	pids := append(descendants(pid), pid)
+	for _, p := range pids {
+		if err := syscall.Kill(p, signal); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to signal process %d: %w", p, err)
+		}
+	}
+
+	return nil
+}
+
+// currentUser returns name of user invoking tinydock, looking through sudo.
+func currentUser() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+
+	return strconv.Itoa(os.Getuid())
+}
+
+// descendants returns PIDs of all processes descending from given pid, deepest first.
+func descendants(pid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	children := make(map[int][]int)
+	for _, entry := range entries {
+		p, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		proc, err := readProcess(p)
+		if err != nil {
+			continue
+		}
+		children[proc.ppid] = append(children[proc.ppid], p)
+	}
+
+	var result []int
+	var walk func(int)
+	walk = func(p int) {
+		for _, c := range children[p] {
+			walk(c)
+			result = append(result, c)
+		}
+	}
+	walk(pid)
+
+	return result
+}
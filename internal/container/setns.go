@@ -14,12 +14,44 @@ package container
 #include <string.h>
 #include <fcntl.h>
 #include <unistd.h>
+#include <sys/mount.h>
 
 #define MAX_PATH 1024
 
+// lift_hardening moves session into a private copy of container mount namespace
+// and undoes masking and read-only mounts of colon separated paths there, and
+// remounts /sys read-write, leaving container itself unchanged.
+static void lift_hardening(const char* paths) {
+   if (unshare(CLONE_NEWNS) == -1) {
+       fprintf(stderr, "failed to create mount namespace: %s\n", strerror(errno));
+       exit(1);
+   }
+
+   if (mount(NULL, "/", NULL, MS_REC | MS_PRIVATE, NULL) == -1) {
+       fprintf(stderr, "failed to make mounts private: %s\n", strerror(errno));
+       exit(1);
+   }
+
+   char* list = strdup(paths);
+   for (char* p = strtok(list, ":"); p; p = strtok(NULL, ":")) {
+       // Paths not hardened, e.g. missing or already relaxed ones, are not mount points
+       if (umount2(p, MNT_DETACH) == -1 && errno != EINVAL && errno != ENOENT) {
+           fprintf(stderr, "failed to unmount %s: %s\n", p, strerror(errno));
+           exit(1);
+       }
+   }
+   free(list);
+
+   if (mount(NULL, "/sys", NULL, MS_REMOUNT | MS_NOSUID | MS_NODEV | MS_NOEXEC, NULL) == -1) {
+       fprintf(stderr, "failed to remount /sys read-write: %s\n", strerror(errno));
+       exit(1);
+   }
+}
+
 __attribute__((constructor)) void enter_namespace(void) {
    const char* container_pid = getenv("TINYDOCK_PID");
    const char* container_cmd = getenv("TINYDOCK_CMD");
+   const char* container_ns = getenv("TINYDOCK_NS");
 
    if (!container_pid || !container_cmd) {
        return;
@@ -29,6 +61,15 @@ __attribute__((constructor)) void enter_namespace(void) {
    const char* namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
 
    for (int i = 0; i < sizeof(namespaces) / sizeof(namespaces[0]); i++) {
+       // TINYDOCK_NS is a comma separated subset to join, surrounded by commas
+       if (container_ns) {
+           char needle[16];
+           snprintf(needle, sizeof(needle), ",%s,", namespaces[i]);
+           if (!strstr(container_ns, needle)) {
+               continue;
+           }
+       }
+
        if (snprintf(nspath, sizeof(nspath), "/proc/%s/ns/%s",
                    container_pid, namespaces[i]) >= sizeof(nspath)) {
            fprintf(stderr, "path too long for namespace %s\n", namespaces[i]);
@@ -51,6 +92,11 @@ __attribute__((constructor)) void enter_namespace(void) {
        close(fd);
    }
 
+   const char* unmask = getenv("TINYDOCK_UNMASK");
+   if (unmask) {
+       lift_hardening(unmask);
+   }
+
    if (system(container_cmd) == -1) {
        fprintf(stderr, "failed to execute command: %s\n", strerror(errno));
        exit(1);
@@ -60,3 +106,33 @@ __attribute__((constructor)) void enter_namespace(void) {
 }
 */
 import "C"
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// namespaces lists namespaces exec can join, in order they are entered.
+var namespaces = []string{"ipc", "uts", "net", "pid", "mnt"}
+
+// parseNamespaces parses a comma separated subset of namespaces to join,
+// e.g. "net,mnt". An empty string selects all.
+func parseNamespaces(s string) ([]string, error) {
+	if s == "" {
+		return namespaces, nil
+	}
+
+	var selected []string
+	for _, ns := range strings.Split(s, ",") {
+		ns = strings.TrimSpace(ns)
+		if !slices.Contains(namespaces, ns) {
+			return nil, fmt.Errorf("invalid namespace %q: must be one of %s", ns, strings.Join(namespaces, ", "))
+		}
+		if !slices.Contains(selected, ns) {
+			selected = append(selected, ns)
+		}
+	}
+
+	return selected, nil
+}
@@ -0,0 +1,193 @@
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// File descriptors of pipes shim is started with, after args and error pipes
+// it passes on to container init.
+const (
+	shimPIDFd  = 5
+	shimDoneFd = 6
+)
+
+// shimExitTimeout bounds how long callers wait for shim to record exit of its
+// container.
+const shimExitTimeout = time.Second
+
+// shim supervises init process of a detached container in place of tinydock
+// run, which returns once container is up, so exit code of container is still
+// recorded. Without a daemon, nothing else is left to wait for it.
+type shim struct {
+	pidReader  *os.File
+	pidWriter  *os.File
+	doneReader *os.File
+	doneWriter *os.File
+}
+
+// attachShim turns cmd prepared by prepareCmd into one starting a shim, which
+// in turn starts container init as its child in a session of its own. Shim is
+// given root directory, as it does not see environment of tinydock, and with
+// openStdin keeps stdin of container open for attached clients to write to.
+func attachShim(cmd *exec.Cmd, id string, openStdin bool) (*shim, error) {
+	s := &shim{}
+
+	var err error
+	if s.pidReader, s.pidWriter, err = os.Pipe(); err != nil {
+		return nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+	if s.doneReader, s.doneWriter, err = os.Pipe(); err != nil {
+		s.pidReader.Close()
+		s.pidWriter.Close()
+		return nil, fmt.Errorf("failed to create pipe: %w", err)
+	}
+
+	shimArgs := []string{cmd.Path, "shim"}
+	if openStdin {
+		shimArgs = append(shimArgs, "-i")
+	}
+	cmd.Args = append(append(shimArgs, config.Root(), id), cmd.Args[1:]...)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, s.pidWriter, s.doneReader)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	return s, nil
+}
+
+// containerPID returns PID of container init process reported by shim once
+// started. Ends of pipes left to shim are closed.
+func (s *shim) containerPID() (int, error) {
+	s.pidWriter.Close()
+	s.doneReader.Close()
+	defer s.pidReader.Close()
+
+	data, err := io.ReadAll(s.pidReader)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read container PID from shim: %w", err)
+	}
+
+	pid, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("shim failed to start container")
+	}
+
+	return pid, nil
+}
+
+// release lets shim record exit of container once it exits, after its info is
+// saved. Shim is released anyway once caller exits.
+func (s *shim) release() {
+	s.doneWriter.Close()
+}
+
+// RunShim starts container init process with given args and waits for it to
+// exit, holding its standard streams for clients to attach to meanwhile. Its
+// exit code is recorded in info of container with given id and returned, for
+// shim to exit with.
+//
+// Container reads stdin from clients if openStdin is set, otherwise from
+// /dev/null as any detached process does.
+func RunShim(id string, args []string, openStdin bool) (int, error) {
+	pidWriter := os.NewFile(shimPIDFd, "pid")
+	doneReader := os.NewFile(shimDoneFd, "done")
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	cmd := exec.Command("/proc/self/exe", args...)
+	cmd.Dir = dir
+	cmd.ExtraFiles = []*os.File{os.NewFile(3, "pipe"), os.NewFile(initErrorFd, "errors")}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: cloneFlags}
+
+	// Shim is started with log of container as its output
+	streams, err := openStdio(id, os.Stdout, openStdin)
+	if err != nil {
+		pidWriter.Close()
+		return 0, err
+	}
+	streams.connect(cmd)
+
+	if err := cmd.Start(); err != nil {
+		pidWriter.Close()
+		streams.close()
+		return 0, fmt.Errorf("failed to start container: %w", err)
+	}
+	for _, f := range cmd.ExtraFiles {
+		f.Close()
+	}
+	streams.serve()
+
+	// Overlay of container is not kept busy by shim
+	if err := os.Chdir("/"); err != nil {
+		return 0, fmt.Errorf("failed to change directory: %w", err)
+	}
+
+	pid := cmd.Process.Pid
+	if _, err := fmt.Fprint(pidWriter, pid); err != nil {
+		return 0, fmt.Errorf("failed to report container PID: %w", err)
+	}
+	pidWriter.Close()
+
+	// Container gets signals sent to it directly, shim stays until it exits
+	signal.Ignore(syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGPIPE)
+
+	cmd.Wait()
+	code := exitCode(cmd.ProcessState.Sys().(syscall.WaitStatus))
+	streams.close()
+
+	// Info saved by tinydock run after container started must not overwrite exit
+	io.Copy(io.Discard, doneReader)
+	doneReader.Close()
+
+	if err := recordExit(id, pid, code); err != nil {
+		return code, err
+	}
+
+	return code, nil
+}
+
+// recordExit records container with given id as exited with code, unless it
+// has been started again as another process since.
+func recordExit(id string, pid, code int) error {
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+	if info.PID != pid {
+		return nil
+	}
+
+	info.Status = Exited
+	info.ExitCode = &code
+	if err := saveInfo(info); err != nil {
+		return fmt.Errorf("failed to record exit of container %s: %w", id, err)
+	}
+	removePIDFile(info)
+
+	return nil
+}
+
+// waitShim waits for shim of container, if any, to record exit of container
+// and returns info as it recorded it.
+func waitShim(info *Info) *Info {
+	if info.ShimPID == 0 || !waitExit(info.ShimPID, shimExitTimeout) {
+		return info
+	}
+
+	latest, err := loadInfo(info.ID)
+	if err != nil || latest.PID != info.PID {
+		return info
+	}
+
+	return latest
+}
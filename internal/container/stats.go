@@ -0,0 +1,376 @@
+package container
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/network"
+)
+
+const statsInterval = time.Second
+
+// Sort keys accepted by Stats.
+const (
+	SortByCPU    = "cpu"
+	SortByMemory = "mem"
+)
+
+// statsRow holds usage figures of a container computed between two samples.
+type statsRow struct {
+	id          string
+	cpuPercent  float64
+	memoryUsage uint64
+	memoryLimit uint64
+	swapUsage   uint64
+	pids        uint64
+	netRx       uint64
+	netTx       uint64
+	ioRead      uint64
+	ioWrite     uint64
+	pressure    [3]cgroups.Pressure // CPU, memory, IO
+}
+
+// statsSample is a reading of cgroup of a container, along with its network
+// counters, left zero if it has no network.
+type statsSample struct {
+	*cgroups.Stats
+	netRx, netTx uint64
+}
+
+// Output formats accepted by Stats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// statsRecord is exported form of a statsRow, with sizes in bytes.
+type statsRecord struct {
+	ID             string         `json:"id"`
+	CPUPercent     float64        `json:"cpuPercent"`
+	MemoryUsage    uint64         `json:"memoryUsage"`
+	MemoryLimit    uint64         `json:"memoryLimit,omitempty"`
+	SwapUsage      uint64         `json:"swapUsage"`
+	PIDs           uint64         `json:"pids"`
+	NetRx          uint64         `json:"netRx"`
+	NetTx          uint64         `json:"netTx"`
+	BlockRead      uint64         `json:"blockRead"`
+	BlockWrite     uint64         `json:"blockWrite"`
+	CPUPressure    pressureRecord `json:"cpuPressure"`
+	MemoryPressure pressureRecord `json:"memoryPressure"`
+	IOPressure     pressureRecord `json:"ioPressure"`
+}
+
+// pressureRecord is exported form of PSI stall percentages.
+type pressureRecord struct {
+	Some float64 `json:"some"`
+	Full float64 `json:"full"`
+}
+
+// Stats displays a live, in-place refreshing view of container resource usage.
+//
+// Every running container is shown when no ids are given. Rows are sorted in
+// descending order by CPU or memory usage depending on sortBy.
+//
+// With noStream or json format, a single reading is printed instead. With
+// output set, readings are appended to given CSV file every interval until
+// interrupted.
+func Stats(ids []string, sortBy, format, output string, noStream bool) error {
+	if sortBy != SortByCPU && sortBy != SortByMemory {
+		return fmt.Errorf("invalid sort key %q: expect %s or %s", sortBy, SortByCPU, SortByMemory)
+	}
+	if format != FormatTable && format != FormatJSON {
+		return fmt.Errorf("invalid format %q: expect %s or %s", format, FormatTable, FormatJSON)
+	}
+	if format == FormatJSON && output != "" {
+		return fmt.Errorf("json format cannot be combined with CSV output")
+	}
+	if noStream && output != "" {
+		return fmt.Errorf("single reading cannot be combined with CSV output")
+	}
+
+	for i, ref := range ids {
+		id, err := resolveID(ref)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+
+		info, err := loadInfo(id)
+		if err != nil {
+			return fmt.Errorf("error loading container %s: %w", id, err)
+		}
+		if !info.Status.active() {
+			return fmt.Errorf("container %s is not running", id)
+		}
+	}
+
+	if output != "" {
+		return recordStats(ids, output)
+	}
+
+	prev, prevTime := sampleStats(ids), time.Now()
+	for {
+		time.Sleep(statsInterval)
+
+		curr, currTime := sampleStats(ids), time.Now()
+		rows := computeStats(prev, curr, currTime.Sub(prevTime))
+		sortStats(rows, sortBy)
+
+		if format == FormatJSON {
+			return printStatsJSON(rows)
+		}
+		if noStream {
+			printStats(rows)
+			return nil
+		}
+
+		// Clear screen and move cursor to top-left before redrawing
+		fmt.Print("\033[2J\033[H")
+		printStats(rows)
+
+		prev, prevTime = curr, currTime
+	}
+}
+
+// sampleStats reads cgroup stats and network counters of given containers, or
+// of all running ones if none given.
+func sampleStats(ids []string) map[string]*statsSample {
+	var infos []*Info
+	if len(ids) == 0 {
+		all, err := loadAllInfo()
+		if err != nil {
+			log.Print(err)
+		}
+		for _, info := range all {
+			if info.Status.active() {
+				infos = append(infos, info)
+			}
+		}
+	}
+	for _, id := range ids {
+		if info, err := loadInfo(id); err == nil {
+			infos = append(infos, info)
+		}
+	}
+
+	samples := make(map[string]*statsSample, len(infos))
+	for _, info := range infos {
+		s, err := cgroups.ReadStats(info.ID)
+		if err != nil {
+			// Container may have exited between samples
+			continue
+		}
+		sample := &statsSample{Stats: s}
+
+		// Counters stay zero if veth is gone, e.g. while container is exiting
+		if ep := info.Endpoint; ep != nil && ep.Veth != "" {
+			if rx, tx, err := network.Counters(ep); err == nil {
+				sample.netRx, sample.netTx = rx, tx
+			}
+		}
+		samples[info.ID] = sample
+	}
+
+	return samples
+}
+
+// computeStats derives usage rows from two consecutive samples taken elapsed apart.
+func computeStats(prev, curr map[string]*statsSample, elapsed time.Duration) []statsRow {
+	rows := make([]statsRow, 0, len(curr))
+	for id, c := range curr {
+		row := statsRow{
+			id:          id,
+			memoryUsage: c.MemoryUsage,
+			memoryLimit: c.MemoryLimit,
+			swapUsage:   c.SwapUsage,
+			pids:        c.PIDs,
+			netRx:       c.netRx,
+			netTx:       c.netTx,
+			ioRead:      c.IORead,
+			ioWrite:     c.IOWrite,
+			pressure:    [3]cgroups.Pressure{c.CPUPressure, c.MemoryPressure, c.IOPressure},
+		}
+
+		if p, ok := prev[id]; ok && c.CPUUsage >= p.CPUUsage && elapsed > 0 {
+			row.cpuPercent = float64(c.CPUUsage-p.CPUUsage) / float64(elapsed.Microseconds()) * 100
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// sortStats orders rows by given key in descending order, breaking ties by ID.
+func sortStats(rows []statsRow, sortBy string) {
+	sort.Slice(rows, func(i, j int) bool {
+		switch {
+		case sortBy == SortByMemory && rows[i].memoryUsage != rows[j].memoryUsage:
+			return rows[i].memoryUsage > rows[j].memoryUsage
+		case sortBy == SortByCPU && rows[i].cpuPercent != rows[j].cpuPercent:
+			return rows[i].cpuPercent > rows[j].cpuPercent
+		default:
+			return rows[i].id < rows[j].id
+		}
+	})
+}
+
+// printStats prints usage rows as a table.
+//
+// Network and block I/O columns show totals since container started, received
+// or read first. Pressure columns show 10 second averages of PSI as "some/full"
+// stall percentages.
+func printStats(rows []statsRow) {
+	fmt.Printf("%-10s %-8s %-22s %-8s %-10s %-6s %-22s %-22s %-12s %-12s %s\n",
+		"ID", "CPU %", "MEM USAGE / LIMIT", "MEM %", "SWAP", "PIDS", "NET I/O", "BLOCK I/O", "CPU PSI", "MEM PSI", "IO PSI")
+
+	for _, r := range rows {
+		limit, memPercent := "-", "-"
+		if r.memoryLimit > 0 {
+			limit = formatBytes(r.memoryLimit)
+			memPercent = fmt.Sprintf("%.2f%%", float64(r.memoryUsage)/float64(r.memoryLimit)*100)
+		}
+
+		fmt.Printf("%-10s %-8s %-22s %-8s %-10s %-6d %-22s %-22s %-12s %-12s %s\n",
+			r.id,
+			fmt.Sprintf("%.2f%%", r.cpuPercent),
+			formatBytes(r.memoryUsage)+" / "+limit,
+			memPercent,
+			formatBytes(r.swapUsage),
+			r.pids,
+			formatBytes(r.netRx)+" / "+formatBytes(r.netTx),
+			formatBytes(r.ioRead)+" / "+formatBytes(r.ioWrite),
+			formatPressure(r.pressure[0]),
+			formatPressure(r.pressure[1]),
+			formatPressure(r.pressure[2]),
+		)
+	}
+}
+
+// record converts row into its exported form.
+func (r statsRow) record() statsRecord {
+	return statsRecord{
+		ID:             r.id,
+		CPUPercent:     r.cpuPercent,
+		MemoryUsage:    r.memoryUsage,
+		MemoryLimit:    r.memoryLimit,
+		SwapUsage:      r.swapUsage,
+		PIDs:           r.pids,
+		NetRx:          r.netRx,
+		NetTx:          r.netTx,
+		BlockRead:      r.ioRead,
+		BlockWrite:     r.ioWrite,
+		CPUPressure:    pressureRecord(r.pressure[0]),
+		MemoryPressure: pressureRecord(r.pressure[1]),
+		IOPressure:     pressureRecord(r.pressure[2]),
+	}
+}
+
+// printStatsJSON prints usage rows as a JSON array.
+func printStatsJSON(rows []statsRow) error {
+	records := make([]statsRecord, 0, len(rows))
+	for _, r := range rows {
+		records = append(records, r.record())
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal stats: %w", err)
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
+
+// statsCSVHeader names columns written by recordStats.
+var statsCSVHeader = []string{
+	"timestamp", "id", "cpu_percent", "memory_usage", "memory_limit", "swap_usage", "pids",
+	"cpu_psi_some", "cpu_psi_full", "memory_psi_some", "memory_psi_full", "io_psi_some", "io_psi_full",
+	"net_rx", "net_tx", "block_read", "block_write",
+}
+
+// recordStats appends a CSV row per container to file at path every interval,
+// writing a header first if file is empty.
+func recordStats(ids []string, path string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open stats output: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		w.Write(statsCSVHeader)
+	}
+
+	fmt.Fprintf(os.Stderr, "Recording stats to %s every %s, press Ctrl-C to stop\n", path, statsInterval)
+
+	prev, prevTime := sampleStats(ids), time.Now()
+	for {
+		time.Sleep(statsInterval)
+
+		curr, currTime := sampleStats(ids), time.Now()
+		rows := computeStats(prev, curr, currTime.Sub(prevTime))
+		sortStats(rows, "")
+
+		timestamp := currTime.UTC().Format(time.RFC3339)
+		for _, r := range rows {
+			rec := r.record()
+			w.Write([]string{
+				timestamp,
+				rec.ID,
+				strconv.FormatFloat(rec.CPUPercent, 'f', 2, 64),
+				strconv.FormatUint(rec.MemoryUsage, 10),
+				strconv.FormatUint(rec.MemoryLimit, 10),
+				strconv.FormatUint(rec.SwapUsage, 10),
+				strconv.FormatUint(rec.PIDs, 10),
+				strconv.FormatFloat(rec.CPUPressure.Some, 'f', 2, 64),
+				strconv.FormatFloat(rec.CPUPressure.Full, 'f', 2, 64),
+				strconv.FormatFloat(rec.MemoryPressure.Some, 'f', 2, 64),
+				strconv.FormatFloat(rec.MemoryPressure.Full, 'f', 2, 64),
+				strconv.FormatFloat(rec.IOPressure.Some, 'f', 2, 64),
+				strconv.FormatFloat(rec.IOPressure.Full, 'f', 2, 64),
+				strconv.FormatUint(rec.NetRx, 10),
+				strconv.FormatUint(rec.NetTx, 10),
+				strconv.FormatUint(rec.BlockRead, 10),
+				strconv.FormatUint(rec.BlockWrite, 10),
+			})
+		}
+
+		// Flush every interval so file is usable while recording
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("failed to write stats output: %w", err)
+		}
+
+		prev, prevTime = curr, currTime
+	}
+}
+
+// formatPressure renders PSI as "some/full" percentages.
+func formatPressure(p cgroups.Pressure) string {
+	return fmt.Sprintf("%.1f/%.1f", p.Some, p.Full)
+}
+
+// formatBytes renders a byte count in binary units.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.2f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
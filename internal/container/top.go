@@ -0,0 +1,391 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+)
+
+// DefaultTopColumns are columns shown by Top when none are selected.
+const DefaultTopColumns = "pid,ppid,user,etime,args"
+
+// clockTicks is the USER_HZ used by procfs for time values.
+const clockTicks = 100
+
+// process holds fields of a container process parsed from procfs.
+type process struct {
+	pid       int
+	ppid      int
+	nspid     int
+	uid       int
+	user      string
+	state     string
+	comm      string
+	args      string
+	cpuTicks  uint64
+	startTick uint64
+	rssKB     uint64
+}
+
+// topColumn describes a selectable column of Top output.
+type topColumn struct {
+	header string
+	value  func(p *process, uptime float64) string
+	less   func(a, b *process) bool
+}
+
+var topColumns = map[string]topColumn{
+	"pid": {
+		header: "PID",
+		value:  func(p *process, _ float64) string { return strconv.Itoa(p.pid) },
+		less:   func(a, b *process) bool { return a.pid < b.pid },
+	},
+	"ppid": {
+		header: "PPID",
+		value:  func(p *process, _ float64) string { return strconv.Itoa(p.ppid) },
+		less:   func(a, b *process) bool { return a.ppid < b.ppid },
+	},
+	"nspid": {
+		header: "NSPID",
+		value:  func(p *process, _ float64) string { return strconv.Itoa(p.nspid) },
+		less:   func(a, b *process) bool { return a.nspid < b.nspid },
+	},
+	"user": {
+		header: "USER",
+		value:  func(p *process, _ float64) string { return p.user },
+		less:   func(a, b *process) bool { return a.user < b.user },
+	},
+	"uid": {
+		header: "UID",
+		value:  func(p *process, _ float64) string { return strconv.Itoa(p.uid) },
+		less:   func(a, b *process) bool { return a.uid < b.uid },
+	},
+	"stat": {
+		header: "STAT",
+		value:  func(p *process, _ float64) string { return p.state },
+		less:   func(a, b *process) bool { return a.state < b.state },
+	},
+	"etime": {
+		header: "ELAPSED",
+		value: func(p *process, uptime float64) string {
+			return formatDuration(uint64(uptime) - p.startTick/clockTicks)
+		},
+		// Earlier start means longer elapsed time
+		less: func(a, b *process) bool { return a.startTick > b.startTick },
+	},
+	"time": {
+		header: "TIME",
+		value:  func(p *process, _ float64) string { return formatDuration(p.cpuTicks / clockTicks) },
+		less:   func(a, b *process) bool { return a.cpuTicks < b.cpuTicks },
+	},
+	"rss": {
+		header: "RSS",
+		value:  func(p *process, _ float64) string { return strconv.FormatUint(p.rssKB, 10) },
+		less:   func(a, b *process) bool { return a.rssKB < b.rssKB },
+	},
+	"comm": {
+		header: "COMMAND",
+		value:  func(p *process, _ float64) string { return p.comm },
+		less:   func(a, b *process) bool { return a.comm < b.comm },
+	},
+	"args": {
+		header: "COMMAND",
+		value:  func(p *process, _ float64) string { return p.args },
+		less:   func(a, b *process) bool { return a.args < b.args },
+	},
+}
+
+// Top displays processes running in a container.
+//
+// columns is a comma separated list of column names (e.g., "pid,user,args").
+// sortKeys follows ps conventions: a comma separated list of column names, each
+// optionally prefixed with "-" for descending or "+" for ascending order.
+func Top(id, columns, sortKeys string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if !info.Status.active() {
+		return fmt.Errorf("container is not running")
+	}
+
+	cols, err := parseTopColumns(columns)
+	if err != nil {
+		return err
+	}
+
+	less, err := parseTopSort(sortKeys)
+	if err != nil {
+		return err
+	}
+
+	pids, err := cgroups.Processes(id)
+	if err != nil {
+		return err
+	}
+
+	uptime, err := readUptime()
+	if err != nil {
+		return err
+	}
+
+	users := readContainerUsers(info.PID)
+
+	var procs []*process
+	for _, pid := range pids {
+		p, err := readProcess(pid)
+		if err != nil {
+			// Process may have exited after cgroup was read
+			continue
+		}
+
+		p.user = strconv.Itoa(p.uid)
+		if name, ok := users[p.uid]; ok {
+			p.user = name
+		}
+		procs = append(procs, p)
+	}
+
+	if less != nil {
+		sort.SliceStable(procs, func(i, j int) bool { return less(procs[i], procs[j]) })
+	}
+
+	rows := make([][]string, 0, len(procs)+1)
+	header := make([]string, len(cols))
+	for i, c := range cols {
+		header[i] = c.header
+	}
+	rows = append(rows, header)
+
+	for _, p := range procs {
+		row := make([]string, len(cols))
+		for i, c := range cols {
+			row[i] = c.value(p, uptime)
+		}
+		rows = append(rows, row)
+	}
+
+	printTable(rows)
+	return nil
+}
+
+// parseTopColumns resolves comma separated column names.
+func parseTopColumns(columns string) ([]topColumn, error) {
+	var cols []topColumn
+	for _, name := range strings.Split(columns, ",") {
+		c, ok := topColumns[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown column: %s", name)
+		}
+		cols = append(cols, c)
+	}
+
+	return cols, nil
+}
+
+// parseTopSort builds a comparison function from ps-style sort keys.
+func parseTopSort(sortKeys string) (func(a, b *process) bool, error) {
+	if sortKeys == "" {
+		return nil, nil
+	}
+
+	type key struct {
+		less func(a, b *process) bool
+		desc bool
+	}
+
+	var keys []key
+	for _, k := range strings.Split(sortKeys, ",") {
+		k = strings.TrimSpace(k)
+		desc := strings.HasPrefix(k, "-")
+		k = strings.TrimLeft(k, "+-")
+
+		c, ok := topColumns[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key: %s", k)
+		}
+		keys = append(keys, key{less: c.less, desc: desc})
+	}
+
+	return func(a, b *process) bool {
+		for _, k := range keys {
+			if k.less(a, b) {
+				return !k.desc
+			}
+			if k.less(b, a) {
+				return k.desc
+			}
+		}
+		return false
+	}, nil
+}
+
+// readProcess parses procfs entries of process with given pid.
+func readProcess(pid int) (*process, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// comm is enclosed in parentheses and may itself contain spaces or parentheses
+	s := string(stat)
+	start, end := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+
+	p := &process{pid: pid, nspid: pid, comm: s[start+1 : end]}
+
+	// Fields after comm start from field 3 (state)
+	fields := strings.Fields(s[end+1:])
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	p.state = fields[0]
+	p.ppid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	p.cpuTicks = utime + stime
+	p.startTick, _ = strconv.ParseUint(fields[19], 10, 64)
+	rssPages, _ := strconv.ParseUint(fields[21], 10, 64)
+	p.rssKB = rssPages * uint64(os.Getpagesize()) / 1024
+
+	if err := readProcessStatus(p); err != nil {
+		return nil, err
+	}
+
+	cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return nil, err
+	}
+	p.args = strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	if p.args == "" {
+		p.args = "[" + p.comm + "]"
+	}
+
+	return p, nil
+}
+
+// readProcessStatus fills in uid and namespaced pid of process from /proc/PID/status.
+func readProcessStatus(p *process) error {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", p.pid))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch key {
+		case "Uid":
+			p.uid, _ = strconv.Atoi(fields[0])
+		case "NSpid":
+			// Last entry is pid in innermost namespace, i.e. the container's
+			p.nspid, _ = strconv.Atoi(fields[len(fields)-1])
+		}
+	}
+
+	return scanner.Err()
+}
+
+// readContainerUsers maps uids to user names using container's own /etc/passwd.
+func readContainerUsers(pid int) map[int]string {
+	users := make(map[int]string)
+
+	f, err := os.Open(fmt.Sprintf("/proc/%d/root/etc/passwd", pid))
+	if err != nil {
+		return users
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) < 3 {
+			continue
+		}
+
+		if uid, err := strconv.Atoi(fields[2]); err == nil {
+			users[uid] = fields[0]
+		}
+	}
+
+	return users
+}
+
+// readUptime returns system uptime in seconds.
+func readUptime() (float64, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read uptime: %w", err)
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("malformed /proc/uptime")
+	}
+
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// formatDuration renders seconds in ps style [[dd-]hh:]mm:ss.
+func formatDuration(seconds uint64) string {
+	days := seconds / 86400
+	hours := seconds / 3600 % 24
+	minutes := seconds / 60 % 60
+	secs := seconds % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, minutes, secs)
+	case hours > 0:
+		return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, secs)
+	default:
+		return fmt.Sprintf("%02d:%02d", minutes, secs)
+	}
+}
+
+// printTable prints rows with columns padded to their widest cell.
+func printTable(rows [][]string) {
+	if len(rows) == 0 {
+		return
+	}
+
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(row)-1 {
+				fmt.Println(cell)
+			} else {
+				fmt.Printf("%-*s ", widths[i], cell)
+			}
+		}
+	}
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"syscall"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 // generateID creates a random ID for container.
@@ -28,9 +30,9 @@ func generateID() string {
 
 // createContainerDir creates container directory if it doesn't exist.
 func createContainerDir(id string) error {
-	containerDir := filepath.Join(containerDir, id)
-	if _, err := os.Stat(containerDir); os.IsNotExist(err) {
-		if err := os.MkdirAll(containerDir, 0755); err != nil {
+	dir := filepath.Join(containerDir(), id)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create container directory: %w", err)
 		}
 	}
@@ -38,37 +40,46 @@ func createContainerDir(id string) error {
 	return nil
 }
 
+// cloneFlags are namespaces container init process is created in.
+//
+// NOTE: CLONE_NEWUSER is left out for mounting procfs
+const cloneFlags = syscall.CLONE_NEWUTS |
+	syscall.CLONE_NEWIPC |
+	syscall.CLONE_NEWPID |
+	syscall.CLONE_NEWNS |
+	syscall.CLONE_NEWNET
+
 // prepareCmd initializes and returns an exec.Cmd for running container process.
 func prepareCmd(
 	id string,
 	envs Envs,
 	interactive bool,
 	detached bool,
+	securityOpts SecurityOpts,
+	priority Priority,
 	reader *os.File,
+	errWriter *os.File,
 ) (*exec.Cmd, error) {
 	// Prepare to re-execute current program with "init" argument
-	cmd := exec.Command("/proc/self/exe", "init")
+	initArgs := append([]string{"init"}, securityOpts.initArgs()...)
+	initArgs = append(initArgs, priority.initArgs()...)
+	initArgs = append(initArgs, etcArg+etcDir(id))
+	cmd := exec.Command("/proc/self/exe", initArgs...)
 
-	// Pass read end of pipe as fd 3 to container process
-	cmd.ExtraFiles = []*os.File{reader}
+	// Pass read end of args pipe as fd 3 and write end of error pipe as fd 4
+	cmd.ExtraFiles = []*os.File{reader, errWriter}
 
-	cmd.Env = []string{
+	cmd.Env = envs.apply([]string{
 		fmt.Sprintf("HOSTNAME=%s", id),
 		"HOME=/root",
 		"TERM=xterm",
 		"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
-	}
-	cmd.Env = append(cmd.Env, envs...)
+	})
 
 	// Set up namespace isolation for container
-	// NOTE: CLONE_NEWUSER is removed for mounting procfs
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS |
-			syscall.CLONE_NEWIPC |
-			syscall.CLONE_NEWPID |
-			syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET,
-		Setpgid: detached,
+		Cloneflags: cloneFlags,
+		Setpgid:    detached,
 	}
 
 	if interactive {
@@ -76,8 +87,9 @@ func prepareCmd(
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 	} else {
-		logPath := filepath.Join(containerDir, id, "container.log")
-		logFile, err := os.Create(logPath)
+		logPath := filepath.Join(containerDir(), id, "container.log")
+		// Restarted containers keep adding to log of earlier runs
+		logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create log file: %w", err)
 		}
@@ -119,6 +131,38 @@ func readArgsFromPipe() ([]string, error) {
 	return args, nil
 }
 
+const (
+	// initErrorFd is where container init process reports errors of setting up
+	// container. It is closed on exec, so parent reads EOF once user command runs.
+	initErrorFd = 4
+
+	// initErrorTimeout is how long an init process failing alongside its parent
+	// is given to report why.
+	initErrorTimeout = 100 * time.Millisecond
+)
+
+// reportInitError sends error of container init process to parent.
+func reportInitError(err error) {
+	w := os.NewFile(uintptr(initErrorFd), "error pipe")
+	defer w.Close()
+
+	w.Write([]byte(err.Error()))
+}
+
+// readInitError reads error container init process reported, if any, waiting
+// until it runs user command or exits.
+//
+// With a non-zero timeout, it only waits that long, so an init process still
+// setting up is not waited for.
+func readInitError(r *os.File, timeout time.Duration) string {
+	if timeout > 0 {
+		r.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	data, _ := io.ReadAll(r)
+	return strings.TrimSpace(string(data))
+}
+
 // waitForLoopbackInterface waits up to 1s for container's loopback interface to be ready.
 //
 // This prevents container from executing network-dependent commands before networking is initialized.
@@ -140,7 +184,9 @@ func waitForLoopbackInterface() error {
 }
 
 // setupMounts configures container mounts and root filesystem.
-func setupMounts() error {
+//
+// Generated /etc files found in etc are bind mounted over those of image.
+func setupMounts(opts SecurityOpts, etc string) error {
 	// Make container mounts private to prevent propagation to host
 	mountPropagationFlags := syscall.MS_SLAVE | syscall.MS_REC
 	if err := syscall.Mount("", "/", "", uintptr(mountPropagationFlags), ""); err != nil {
@@ -159,6 +205,12 @@ func setupMounts() error {
 		return fmt.Errorf("failed to create bind mount: %w", err)
 	}
 
+	if etc != "" {
+		if err := mountEtcFiles(etc, newRoot); err != nil {
+			return err
+		}
+	}
+
 	// Change working directory to new root before pivot_root
 	if err := os.Chdir(newRoot); err != nil {
 		return fmt.Errorf("failed to change directory: %w", err)
@@ -175,6 +227,21 @@ func setupMounts() error {
 		return fmt.Errorf("failed to pivot root: %w", err)
 	}
 
+	// Mount procfs for process information
+	mountProcFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
+	if err := syscall.Mount("proc", "/proc", "proc", uintptr(mountProcFlags), ""); err != nil {
+		return fmt.Errorf("failed to mount procfs: %w", err)
+	}
+
+	if err := mountSysfs(opts); err != nil {
+		return err
+	}
+
+	// Harden procfs and sysfs while host /dev/null is still reachable via old root
+	if err := hardenMounts("/"+putOld, opts); err != nil {
+		return err
+	}
+
 	// Unmount old root
 	if err := syscall.Unmount(putOld, syscall.MNT_DETACH); err != nil {
 		return fmt.Errorf("failed to unmount old root: %w", err)
@@ -185,12 +252,6 @@ func setupMounts() error {
 		return fmt.Errorf("failed to remove old root: %w", err)
 	}
 
-	// Mount procfs for process information
-	mountProcFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	if err := syscall.Mount("proc", "/proc", "proc", uintptr(mountProcFlags), ""); err != nil {
-		return fmt.Errorf("failed to mount procfs: %w", err)
-	}
-
 	// Mount /dev using tmpfs for device isolation
 	mountDevFlags := syscall.MS_NOSUID | syscall.MS_STRICTATIME
 	if err := syscall.Mount("tmpfs", "/dev", "tmpfs", uintptr(mountDevFlags), "mode=755"); err != nil {
@@ -200,27 +261,29 @@ func setupMounts() error {
 	return nil
 }
 
-// parseSignal parses common literal signals (e.g., SIGTERM, SIGKILL) and numeric signals.
+// maxSignal is highest signal number on Linux, SIGRTMAX.
+const maxSignal = 64
+
+// parseSignal parses a signal given by number or by name, with or without "SIG"
+// prefix and in any case, e.g. "SIGHUP", "hup" or "1".
 func parseSignal(sig string) (syscall.Signal, error) {
-	if strings.HasPrefix(sig, "SIG") {
-		s := strings.ToUpper(sig)
-		switch s {
-		case "SIGINT":
-			return syscall.SIGINT, nil
-		case "SIGTERM":
-			return syscall.SIGTERM, nil
-		case "SIGKILL":
-			return syscall.SIGKILL, nil
-		default:
-			return 0, fmt.Errorf("unsupported signal: %s", sig)
+	if n, err := strconv.Atoi(sig); err == nil {
+		if n < 1 || n > maxSignal {
+			return 0, fmt.Errorf("invalid signal: %s", sig)
 		}
+		return syscall.Signal(n), nil
 	}
 
-	sigNum, err := strconv.Atoi(sig)
-	if err != nil {
-		return 0, fmt.Errorf("invalid signal: %s", sig)
+	name := strings.ToUpper(sig)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	signal := unix.SignalNum(name)
+	if signal == 0 {
+		return 0, fmt.Errorf("unsupported signal: %s", sig)
 	}
-	return syscall.Signal(sigNum), nil
+	return signal, nil
 }
 
 // verifyProcess checks if process with given PID belongs to specified container.
@@ -0,0 +1,47 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		name      string
+		sig       string
+		want      syscall.Signal
+		wantError bool
+	}{
+		{name: "name with prefix", sig: "SIGHUP", want: syscall.SIGHUP},
+		{name: "name without prefix", sig: "TERM", want: syscall.SIGTERM},
+		{name: "lower case", sig: "kill", want: syscall.SIGKILL},
+		{name: "mixed case prefix", sig: "SigUsr1", want: syscall.SIGUSR1},
+		{name: "lowest number", sig: "1", want: syscall.Signal(1)},
+		{name: "highest number", sig: "64", want: syscall.Signal(64)},
+		{name: "zero", sig: "0", wantError: true},
+		{name: "negative number", sig: "-9", wantError: true},
+		{name: "number above range", sig: "65", wantError: true},
+		{name: "unknown name", sig: "SIGFOO", wantError: true},
+		{name: "prefix only", sig: "SIG", wantError: true},
+		{name: "doubled prefix", sig: "SIGSIGTERM", wantError: true},
+		{name: "empty", sig: "", wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSignal(tt.sig)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("parseSignal(%q) = %v, expected error", tt.sig, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSignal(%q) unexpected error: %v", tt.sig, err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSignal(%q) = %v, want %v", tt.sig, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package container
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+	"github.com/lutaod/tinydock/internal/inroot"
+	"github.com/lutaod/tinydock/internal/network"
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+// Verify compares recorded state of a running container against live kernel
+// state and prints outcome of each check: cgroup and its limits, overlay and
+// volume mounts, and network address and port forwarding rules. It fails if any
+// has drifted, e.g. after manual changes or a partially failed operation.
+func Verify(id string) error {
+	id, err := resolveID(id)
+	if err != nil {
+		return err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if !info.Status.active() {
+		return fmt.Errorf("container is not running")
+	}
+	if syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, id) {
+		return fmt.Errorf("container is recorded as %s, but process %d is gone", info.Status, info.PID)
+	}
+
+	checks := []struct {
+		name  string
+		drift func(*Info) ([]string, error)
+	}{
+		{"status", statusDrift},
+		{"cgroup", func(info *Info) ([]string, error) {
+			return cgroups.Drift(info.ID, info.PID, info.CPULimit, info.MemoryLimit)
+		}},
+		{"mounts", mountDrift},
+		{"network", func(info *Info) ([]string, error) {
+			if info.Endpoint == nil {
+				return nil, nil
+			}
+			return network.Drift(info.Endpoint, info.PID)
+		}},
+	}
+
+	drifted := 0
+	for _, c := range checks {
+		drift, err := c.drift(info)
+		switch {
+		case err != nil:
+			fmt.Printf("%s: %v\n", c.name, err)
+			drifted++
+		case len(drift) > 0:
+			fmt.Printf("%s: %s\n", c.name, strings.Join(drift, "; "))
+			drifted++
+		default:
+			fmt.Printf("%s: ok\n", c.name)
+		}
+	}
+
+	if drifted > 0 {
+		return fmt.Errorf("%d check(s) found drift from recorded state", drifted)
+	}
+
+	return nil
+}
+
+// statusDrift reports whether cgroup freezer agrees with recorded status.
+func statusDrift(info *Info) ([]string, error) {
+	frozen, err := cgroups.Frozen(info.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if frozen != (info.Status == Paused) {
+		return []string{fmt.Sprintf("recorded as %s, but cgroup frozen is %t", info.Status, frozen)}, nil
+	}
+
+	return nil, nil
+}
+
+// mountDrift reports whether overlay of container is mounted, and each volume
+// bind mounted at its target, i.e. target is the same file as source.
+func mountDrift(info *Info) ([]string, error) {
+	if !overlay.Mounted(info.ID) {
+		return []string{"overlay is not mounted"}, nil
+	}
+
+	var drift []string
+	merged := overlay.MergedDir(info.ID)
+	for _, v := range info.Volumes {
+		var src, dst syscall.Stat_t
+		if err := syscall.Stat(v.Source, &src); err != nil {
+			drift = append(drift, fmt.Sprintf("volume source %s is missing", v.Source))
+			continue
+		}
+
+		target, err := inroot.Resolve(merged, v.Target)
+		if err == nil {
+			err = syscall.Stat(target, &dst)
+		}
+		if err != nil || src.Dev != dst.Dev || src.Ino != dst.Ino {
+			drift = append(drift, fmt.Sprintf("volume %s is not mounted at %s", v.Source, v.Target))
+		}
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,91 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// waitPollInterval is how often exit of a container is checked for without a
+// pidfd, and whether it has been recorded yet.
+const waitPollInterval = 100 * time.Millisecond
+
+// Wait blocks until container exits and returns its exit code, as recorded by
+// shim of a detached container or by run of a foreground one.
+func Wait(id string) (int, error) {
+	id, err := resolveID(id)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := loadInfo(id)
+	if err != nil {
+		return 0, fmt.Errorf("error loading container %s: %w", id, err)
+	}
+
+	if info.Status.active() && syscall.Kill(info.PID, 0) == nil && verifyProcess(info.PID, id) {
+		if err := waitPID(info.PID); err != nil {
+			return 0, err
+		}
+		info = waitRecorded(info)
+	}
+
+	// Containers run detached before shims existed, or killed with their shim
+	if info.ExitCode == nil {
+		return 0, fmt.Errorf("exit code of container %s is unknown", id)
+	}
+
+	return *info.ExitCode, nil
+}
+
+// waitPID blocks until process of given PID exits. Unlike wait(2), process need
+// not be a child.
+func waitPID(pid int) error {
+	fd, err := unix.PidfdOpen(pid, 0)
+	if errors.Is(err, unix.ESRCH) {
+		return nil
+	}
+	if err != nil {
+		// Kernels before 5.3 have no pidfd
+		for syscall.Kill(pid, 0) == nil {
+			time.Sleep(waitPollInterval)
+		}
+		return nil
+	}
+	defer unix.Close(fd)
+
+	// Pidfd becomes readable once process exits
+	fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to wait for container: %w", err)
+		}
+		return nil
+	}
+}
+
+// waitRecorded waits for exit of container to be recorded, by its shim or by
+// run it was in foreground of, and returns info as recorded.
+func waitRecorded(info *Info) *Info {
+	if info.ShimPID != 0 {
+		return waitShim(info)
+	}
+
+	deadline := time.Now().Add(shimExitTimeout)
+	for time.Now().Before(deadline) {
+		latest, err := loadInfo(info.ID)
+		if err == nil && (latest.PID != info.PID || !latest.Status.active()) {
+			return latest
+		}
+		time.Sleep(waitPollInterval)
+	}
+
+	return info
+}
@@ -0,0 +1,122 @@
+package container
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/cgroups"
+)
+
+// Actions accepted by Watchdog.
+const (
+	EvictPause = "pause"
+	EvictKill  = "kill"
+)
+
+// pressureWindow is period host pressure is averaged over, waited after each
+// eviction so its effect shows before another container is picked.
+const pressureWindow = 10 * time.Second
+
+// Watchdog checks host memory pressure every interval, and once share of time
+// all tasks stalled on memory reaches threshold percent, pauses or kills the
+// container with lowest eviction priority, so host OOM killer does not pick
+// arbitrary victims. Ties go to container using most memory.
+//
+// It runs until an error occurs, so is meant to be kept running, e.g. as a
+// systemd service.
+func Watchdog(threshold float64, action string, interval time.Duration) error {
+	if action != EvictPause && action != EvictKill {
+		return fmt.Errorf("invalid action %q: expect %s or %s", action, EvictPause, EvictKill)
+	}
+	if threshold <= 0 || threshold > 100 {
+		return fmt.Errorf("invalid threshold %g: expect a percentage above 0", threshold)
+	}
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s: must be positive", interval)
+	}
+
+	// Fail early on kernels without PSI
+	if _, err := cgroups.HostMemoryPressure(); err != nil {
+		return err
+	}
+
+	log.Printf("Watching host memory pressure, %s containers above %g%% full stall", action, threshold)
+
+	for {
+		time.Sleep(interval)
+
+		p, err := cgroups.HostMemoryPressure()
+		if err != nil {
+			return err
+		}
+		if p.Full < threshold {
+			continue
+		}
+
+		victim := evictionCandidate(action)
+		if victim == nil {
+			log.Printf("Memory pressure at %.1f%%, no container left to %s", p.Full, action)
+			time.Sleep(pressureWindow)
+			continue
+		}
+
+		log.Printf("Memory pressure at %.1f%%, evicting container %s with priority %d", p.Full, victim.ID, victim.Eviction)
+		if action == EvictPause {
+			err = Pause(victim.ID)
+		} else {
+			err = Stop(victim.ID, "SIGKILL")
+		}
+		if err != nil {
+			log.Printf("Failed to %s container %s: %v", action, victim.ID, err)
+			continue
+		}
+
+		time.Sleep(pressureWindow)
+	}
+}
+
+// evictionCandidate returns container to evict by given action next, or nil if
+// none is left. Paused containers are only candidates to be killed.
+func evictionCandidate(action string) *Info {
+	infos, err := loadAllInfo()
+	if err != nil {
+		log.Print(err)
+	}
+
+	type candidate struct {
+		info   *Info
+		memory uint64
+	}
+
+	var candidates []candidate
+	for _, info := range infos {
+		if info.Status != Running && (action != EvictKill || info.Status != Paused) {
+			continue
+		}
+		if syscall.Kill(info.PID, 0) != nil || !verifyProcess(info.PID, info.ID) {
+			continue
+		}
+
+		c := candidate{info: info}
+		if s, err := cgroups.ReadStats(info.ID); err == nil {
+			c.memory = s.MemoryUsage
+		}
+		candidates = append(candidates, c)
+	}
+
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].info.Eviction != candidates[j].info.Eviction {
+			return candidates[i].info.Eviction < candidates[j].info.Eviction
+		}
+		return candidates[i].memory > candidates[j].memory
+	})
+
+	return candidates[0].info
+}
@@ -0,0 +1,156 @@
+// Package inroot resolves paths inside a container root filesystem on the host.
+//
+// Paths are resolved with openat2(RESOLVE_IN_ROOT), so ".." and symlinks of
+// an image, absolute ones included, are interpreted as if root were "/" and
+// can never lead outside of it.
+package inroot
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Resolve returns host path of path inside root, following symlinks within
+// root. The path must exist.
+func Resolve(root, path string) (string, error) {
+	rootFd, err := openRoot(root)
+	if err != nil {
+		return "", err
+	}
+	defer unix.Close(rootFd)
+
+	fd, err := openBeneath(rootFd, components(path))
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s in %s: %w", path, root, err)
+	}
+	defer unix.Close(fd)
+
+	return hostPath(rootFd, fd)
+}
+
+// MkdirAll creates directory path inside root along with any missing parents,
+// following symlinks within root. It returns host path of the directory, and
+// host path of topmost directory it created, or an empty string if path
+// already existed.
+func MkdirAll(root, path string, perm os.FileMode) (string, string, error) {
+	rootFd, err := openRoot(root)
+	if err != nil {
+		return "", "", err
+	}
+	defer unix.Close(rootFd)
+
+	dirFd, err := unix.Dup(rootFd)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to duplicate descriptor of %s: %w", root, err)
+	}
+	defer func() { unix.Close(dirFd) }()
+
+	created := ""
+	parts := components(path)
+	for i, name := range parts {
+		fd, err := openBeneath(rootFd, parts[:i+1])
+		if errors.Is(err, unix.ENOENT) {
+			// Create missing component in its resolved parent only, a dangling
+			// symlink in its place makes mkdirat fail or reopening fail below
+			if err := unix.Mkdirat(dirFd, name, uint32(perm.Perm())); err != nil && !errors.Is(err, unix.EEXIST) {
+				return "", "", fmt.Errorf("failed to create %s in %s: %w", filepath.Join(parts[:i+1]...), root, err)
+			}
+			if fd, err = openBeneath(rootFd, parts[:i+1]); err == nil && created == "" {
+				if created, err = hostPath(rootFd, fd); err != nil {
+					unix.Close(fd)
+					return "", "", err
+				}
+			}
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to resolve %s in %s: %w", filepath.Join(parts[:i+1]...), root, err)
+		}
+
+		unix.Close(dirFd)
+		dirFd = fd
+	}
+
+	dir, err := hostPath(rootFd, dirFd)
+	if err != nil {
+		return "", "", err
+	}
+
+	return dir, created, nil
+}
+
+// openRoot opens root directory as an O_PATH descriptor.
+func openRoot(root string) (int, error) {
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("failed to open %s: %w", root, err)
+	}
+	return fd, nil
+}
+
+// openBeneath opens path given by parts relative to rootFd as an O_PATH
+// descriptor, treating rootFd as "/".
+func openBeneath(rootFd int, parts []string) (int, error) {
+	path := "."
+	if len(parts) > 0 {
+		path = filepath.Join(parts...)
+	}
+
+	for {
+		fd, err := unix.Openat2(rootFd, path, &unix.OpenHow{
+			Flags:   unix.O_PATH | unix.O_CLOEXEC,
+			Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+		})
+		// Resolution is retried if a concurrent rename raced with it
+		if errors.Is(err, unix.EAGAIN) {
+			continue
+		}
+		if errors.Is(err, unix.ENOSYS) {
+			return -1, fmt.Errorf("openat2 is not supported by kernel, Linux 5.6 or later is required")
+		}
+		return fd, err
+	}
+}
+
+// hostPath returns path of file opened as fd, checking it lies within root
+// opened as rootFd.
+func hostPath(rootFd, fd int) (string, error) {
+	root, err := fdPath(rootFd)
+	if err != nil {
+		return "", err
+	}
+	path, err := fdPath(fd)
+	if err != nil {
+		return "", err
+	}
+
+	if root != "/" && path != root && !strings.HasPrefix(path, root+"/") {
+		return "", fmt.Errorf("path %s escapes %s", path, root)
+	}
+
+	return path, nil
+}
+
+// fdPath returns path of file opened as fd.
+func fdPath(fd int) (string, error) {
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(fd))
+	if err != nil {
+		return "", fmt.Errorf("failed to read path of descriptor: %w", err)
+	}
+	return path, nil
+}
+
+// components splits path into its names, dropping ".." that would climb
+// above "/".
+func components(path string) []string {
+	path = strings.TrimPrefix(filepath.Clean("/"+path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
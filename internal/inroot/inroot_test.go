@@ -0,0 +1,213 @@
+package inroot
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// newRoot creates a root filesystem holding directories a/b and etc, with
+// symlinks pointing within and out of it, and returns its resolved path.
+func newRoot(t *testing.T) string {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to resolve temporary directory: %v", err)
+	}
+
+	for _, dir := range []string{"a/b", "etc"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+
+	links := map[string]string{
+		"abs":      "/a/b",
+		"rel":      "a/b",
+		"up":       "../../..",
+		"escape":   "../../etc",
+		"loop1":    "loop2",
+		"loop2":    "loop1",
+		"dangling": "/nowhere",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", name, err)
+		}
+	}
+
+	return root
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{
+			name: "plain path",
+			path: "/a/b",
+			want: "a/b",
+		},
+		{
+			name: "relative path",
+			path: "a/b",
+			want: "a/b",
+		},
+		{
+			name: "dot dot above root",
+			path: "../../a",
+			want: "a",
+		},
+		{
+			name: "root",
+			path: "/",
+			want: "",
+		},
+		{
+			name: "absolute symlink",
+			path: "abs",
+			want: "a/b",
+		},
+		{
+			name: "relative symlink",
+			path: "rel",
+			want: "a/b",
+		},
+		{
+			name: "symlink climbing above root",
+			path: "up/a/b",
+			want: "a/b",
+		},
+		{
+			name: "symlink escaping root",
+			path: "escape",
+			want: "etc",
+		},
+		{
+			name:    "symlink loop",
+			path:    "loop1",
+			wantErr: unix.ELOOP,
+		},
+		{
+			name:    "dangling symlink",
+			path:    "dangling",
+			wantErr: unix.ENOENT,
+		},
+		{
+			name:    "missing path",
+			path:    "a/missing",
+			wantErr: unix.ENOENT,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRoot(t)
+
+			got, err := Resolve(root, tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Resolve(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(%q) unexpected error: %v", tt.path, err)
+			}
+
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("Resolve(%q) = %s, want %s", tt.path, got, want)
+			}
+		})
+	}
+}
+
+func TestMkdirAll(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		wantDir     string
+		wantCreated string
+		wantErr     error
+	}{
+		{
+			name:    "existing directory",
+			path:    "a/b",
+			wantDir: "a/b",
+		},
+		{
+			name:        "missing parents",
+			path:        "x/y/z",
+			wantDir:     "x/y/z",
+			wantCreated: "x",
+		},
+		{
+			name:        "partly existing",
+			path:        "a/b/c/d",
+			wantDir:     "a/b/c/d",
+			wantCreated: "a/b/c",
+		},
+		{
+			name:        "through absolute symlink",
+			path:        "abs/c",
+			wantDir:     "a/b/c",
+			wantCreated: "a/b/c",
+		},
+		{
+			name:        "through symlink climbing above root",
+			path:        "up/new",
+			wantDir:     "new",
+			wantCreated: "new",
+		},
+		{
+			name:    "through dangling symlink",
+			path:    "dangling/c",
+			wantErr: unix.ENOENT,
+		},
+		{
+			name:    "through symlink loop",
+			path:    "loop1/c",
+			wantErr: unix.ELOOP,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newRoot(t)
+
+			dir, created, err := MkdirAll(root, tt.path, 0755)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("MkdirAll(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				if _, err := os.Lstat(filepath.Join(root, "nowhere")); !os.IsNotExist(err) {
+					t.Errorf("MkdirAll(%q) created symlink target", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MkdirAll(%q) unexpected error: %v", tt.path, err)
+			}
+
+			if want := filepath.Join(root, tt.wantDir); dir != want {
+				t.Errorf("MkdirAll(%q) dir = %s, want %s", tt.path, dir, want)
+			}
+			wantCreated := ""
+			if tt.wantCreated != "" {
+				wantCreated = filepath.Join(root, tt.wantCreated)
+			}
+			if created != wantCreated {
+				t.Errorf("MkdirAll(%q) created = %q, want %q", tt.path, created, wantCreated)
+			}
+
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				t.Errorf("MkdirAll(%q) left no directory at %s", tt.path, dir)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package metrics records how long runtime operations take, such as starting a
+// container, so regressions in their latency can be tracked over time.
+//
+// Samples are appended as JSON lines to a journal file. Without a daemon there
+// is nothing to scrape, so they are summarized by reading the journal instead.
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// Operations timed, named after where they happen.
+const (
+	// OpStart spans creating a container until its command runs.
+	OpStart = "container.start"
+
+	// OpMount spans preparing and mounting overlay and volumes of a container.
+	OpMount = "overlay.setup"
+
+	// OpConnect spans connecting a container to its network.
+	OpConnect = "network.setup"
+)
+
+// maxJournalSize is size journal is rotated at, keeping one older file.
+const maxJournalSize = 1 << 20
+
+// journalPath returns where samples are appended.
+func journalPath() string {
+	return filepath.Join(config.Root(), "metrics.jsonl")
+}
+
+// Sample is duration of a single operation.
+type Sample struct {
+	Time      time.Time     `json:"time"`
+	Op        string        `json:"op"`
+	Container string        `json:"container,omitempty"`
+	Duration  time.Duration `json:"durationNs"`
+}
+
+// Record appends duration of op since start to journal. Failures are logged
+// only, as they should never fail operation itself.
+func Record(op, containerID string, start time.Time) {
+	s := Sample{
+		Time:      time.Now(),
+		Op:        op,
+		Container: containerID,
+		Duration:  time.Since(start),
+	}
+	if err := appendSample(s); err != nil {
+		log.Printf("Failed to record %s metric: %v", op, err)
+	}
+}
+
+// appendSample writes s as a line of journal, rotating it once too large.
+func appendSample(s Sample) error {
+	if fi, err := os.Stat(journalPath()); err == nil && fi.Size() > maxJournalSize {
+		if err := os.Rename(journalPath(), journalPath()+".1"); err != nil {
+			return fmt.Errorf("failed to rotate metrics journal: %w", err)
+		}
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metric: %w", err)
+	}
+
+	f, err := os.OpenFile(journalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open metrics journal: %w", err)
+	}
+	defer f.Close()
+
+	// A single write of a short line is not interleaved with those of others
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write metrics journal: %w", err)
+	}
+
+	return nil
+}
+
+// Print summarizes durations of each operation recorded since given time, or
+// all of them if zero.
+func Print(since time.Time) error {
+	byOp := make(map[string][]time.Duration)
+	for _, path := range []string{journalPath() + ".1", journalPath()} {
+		if err := readJournal(path, func(s Sample) {
+			if !s.Time.Before(since) {
+				byOp[s.Op] = append(byOp[s.Op], s.Duration)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+
+	ops := make([]string, 0, len(byOp))
+	for op := range byOp {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	fmt.Printf("%-16s %-8s %-10s %-10s %-10s %s\n", "OPERATION", "COUNT", "MEAN", "P50", "P95", "MAX")
+	for _, op := range ops {
+		ds := byOp[op]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+
+		var total time.Duration
+		for _, d := range ds {
+			total += d
+		}
+
+		fmt.Printf("%-16s %-8d %-10s %-10s %-10s %s\n", op, len(ds),
+			round(total/time.Duration(len(ds))), round(percentile(ds, 50)),
+			round(percentile(ds, 95)), round(ds[len(ds)-1]))
+	}
+
+	return nil
+}
+
+// readJournal calls fn for each sample in journal at path, skipping lines that
+// cannot be parsed, e.g. one cut short by a crash.
+func readJournal(path string, fn func(Sample)) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open metrics journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Sample
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			continue
+		}
+		fn(s)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read metrics journal: %w", err)
+	}
+
+	return nil
+}
+
+// percentile returns p-th percentile of sorted durations by nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// round shortens d for display.
+func round(d time.Duration) time.Duration {
+	if d >= time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(10 * time.Microsecond)
+}
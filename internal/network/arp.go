@@ -0,0 +1,138 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ARP probing as described by RFC 5227, with shorter intervals than it suggests
+// so starting a container is not delayed by seconds.
+const (
+	arpProbeCount    = 3
+	arpProbeInterval = 200 * time.Millisecond
+	arpProbeWait     = time.Second
+)
+
+// Offsets into an Ethernet frame carrying an ARP packet.
+const (
+	arpFrameSize = 42
+	arpSenderMAC = 22
+	arpSenderIP  = 28
+	arpTargetIP  = 38
+)
+
+// probeARP sends ARP probes for ip on host interface with given name and
+// returns hardware address of a device answering for it, or nil if none does
+// within arpProbeWait.
+//
+// A device probing for the same address at the same time is reported too.
+func probeARP(ifName string, ip net.IP) (net.HardwareAddr, error) {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find interface %s: %w", ifName, err)
+	}
+	mac := link.Attrs().HardwareAddr
+	ip = ip.To4()
+
+	proto := htons(unix.ETH_P_ARP)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW|unix.SOCK_CLOEXEC, int(proto))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ARP socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	addr := &unix.SockaddrLinklayer{Protocol: proto, Ifindex: link.Attrs().Index}
+	if err := unix.Bind(fd, addr); err != nil {
+		return nil, fmt.Errorf("failed to bind ARP socket to %s: %w", ifName, err)
+	}
+
+	// Reads wake up periodically so probes are sent on time
+	tv := unix.NsecToTimeval(int64(arpProbeInterval))
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &tv); err != nil {
+		return nil, fmt.Errorf("failed to set ARP socket timeout: %w", err)
+	}
+
+	probe := arpProbe(mac, ip)
+	broadcast := &unix.SockaddrLinklayer{Ifindex: link.Attrs().Index, Halen: 6}
+	copy(broadcast.Addr[:], probe[:6])
+
+	buf := make([]byte, 1500)
+	deadline := time.Now().Add(arpProbeWait)
+	var nextProbe time.Time
+	for sent := 0; time.Now().Before(deadline); {
+		if sent < arpProbeCount && !time.Now().Before(nextProbe) {
+			if err := unix.Sendto(fd, probe, 0, broadcast); err != nil {
+				return nil, fmt.Errorf("failed to send ARP probe on %s: %w", ifName, err)
+			}
+			sent++
+			nextProbe = time.Now().Add(arpProbeInterval)
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err == unix.EAGAIN || err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ARP reply on %s: %w", ifName, err)
+		}
+
+		if owner := arpConflict(buf[:n], mac, ip); owner != nil {
+			return owner, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// arpProbe builds a broadcast Ethernet frame asking who has ip, sent from mac
+// with sender address left unspecified, so no ARP cache learns it.
+func arpProbe(mac net.HardwareAddr, ip net.IP) []byte {
+	frame := make([]byte, arpFrameSize)
+
+	// Ethernet header
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], mac)
+	binary.BigEndian.PutUint16(frame[12:14], unix.ETH_P_ARP)
+
+	// ARP request for IPv4 over Ethernet
+	binary.BigEndian.PutUint16(frame[14:16], 1)
+	binary.BigEndian.PutUint16(frame[16:18], unix.ETH_P_IP)
+	frame[18], frame[19] = 6, 4
+	binary.BigEndian.PutUint16(frame[20:22], 1)
+	copy(frame[arpSenderMAC:arpSenderMAC+6], mac)
+	copy(frame[arpTargetIP:arpTargetIP+4], ip)
+
+	return frame
+}
+
+// arpConflict returns hardware address of sender of ARP frame if it uses ip or
+// probes for it, other than mac itself.
+func arpConflict(frame []byte, mac net.HardwareAddr, ip net.IP) net.HardwareAddr {
+	if len(frame) < arpFrameSize || binary.BigEndian.Uint16(frame[12:14]) != unix.ETH_P_ARP {
+		return nil
+	}
+
+	sender := net.HardwareAddr(bytes.Clone(frame[arpSenderMAC : arpSenderMAC+6]))
+	if bytes.Equal(sender, mac) {
+		return nil
+	}
+
+	senderIP := net.IP(frame[arpSenderIP : arpSenderIP+4])
+	targetIP := net.IP(frame[arpTargetIP : arpTargetIP+4])
+	if senderIP.Equal(ip) || (senderIP.Equal(net.IPv4zero) && targetIP.Equal(ip)) {
+		return sender
+	}
+
+	return nil
+}
+
+// htons converts a 16-bit value to network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestArpConflict(t *testing.T) {
+	own := net.HardwareAddr{0x02, 0x42, 0xac, 0x1a, 0x00, 0x01}
+	other := net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+	ip := net.ParseIP("172.26.0.5").To4()
+	otherIP := net.ParseIP("172.26.0.9").To4()
+
+	// reply builds a frame from sender with senderIP asking for targetIP.
+	reply := func(sender net.HardwareAddr, senderIP, targetIP net.IP) []byte {
+		frame := arpProbe(sender, targetIP)
+		copy(frame[arpSenderIP:arpSenderIP+4], senderIP)
+		return frame
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  net.HardwareAddr
+	}{
+		{
+			name:  "device using address",
+			frame: reply(other, ip, otherIP),
+			want:  other,
+		},
+		{
+			name:  "device probing for address",
+			frame: arpProbe(other, ip),
+			want:  other,
+		},
+		{
+			name:  "own probe",
+			frame: arpProbe(own, ip),
+			want:  nil,
+		},
+		{
+			name:  "device probing for other address",
+			frame: arpProbe(other, otherIP),
+			want:  nil,
+		},
+		{
+			name:  "device using other address asking for address",
+			frame: reply(other, otherIP, ip),
+			want:  nil,
+		},
+		{
+			name:  "short frame",
+			frame: arpProbe(other, ip)[:arpFrameSize-1],
+			want:  nil,
+		},
+		{
+			name: "not ARP",
+			frame: func() []byte {
+				frame := arpProbe(other, ip)
+				binary.BigEndian.PutUint16(frame[12:14], 0x0800)
+				return frame
+			}(),
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := arpConflict(tt.frame, own, ip)
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("arpConflict() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
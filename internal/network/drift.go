@@ -0,0 +1,78 @@
+package network
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// Drift compares network state of container with init process pid against its
+// endpoint, returning a description of each difference: host veth and bridge it
+// is attached to, address inside container and port forwarding rules.
+func Drift(ep *Endpoint, pid int) ([]string, error) {
+	if ep.IPNet == nil {
+		return []string{fmt.Sprintf("no address recorded on network %s", ep.Network)}, nil
+	}
+
+	var drift []string
+
+	veth, err := netlink.LinkByName(ep.Veth)
+	if err != nil {
+		drift = append(drift, fmt.Sprintf("host veth %s is missing", ep.Veth))
+	} else if bridge, err := netlink.LinkByName(ep.HostInterface); err != nil {
+		drift = append(drift, fmt.Sprintf("bridge %s is missing", ep.HostInterface))
+	} else if veth.Attrs().MasterIndex != bridge.Attrs().Index {
+		drift = append(drift, fmt.Sprintf("host veth %s is not attached to bridge %s", ep.Veth, ep.HostInterface))
+	}
+
+	assigned, err := hasAddress(pid, ep)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		drift = append(drift, fmt.Sprintf("address %s is not assigned in container", ep.IPNet))
+	}
+
+	// "-C" checks rule exists, as rules are appended with "-A"
+	for _, rule := range portForwardingRules("-C", ep.HostInterface, ep.IPNet.IP.String(), ep.PortMappings) {
+		if exec.Command("iptables", rule...).Run() != nil {
+			// Shown as table, chain and match, without "-t" and "-C"
+			drift = append(drift, fmt.Sprintf("iptables rule missing: %s %s", rule[1], strings.Join(rule[3:], " ")))
+		}
+	}
+
+	return drift, nil
+}
+
+// hasAddress reports whether address of endpoint is assigned to an interface in
+// network namespace of pid.
+func hasAddress(pid int, ep *Endpoint) (bool, error) {
+	ns, err := netns.GetFromPid(pid)
+	if err != nil {
+		return false, fmt.Errorf("failed to get container namespace: %w", err)
+	}
+	defer ns.Close()
+
+	// Handle queries namespace without switching thread into it
+	handle, err := netlink.NewHandleAt(ns)
+	if err != nil {
+		return false, fmt.Errorf("failed to open container namespace: %w", err)
+	}
+	defer handle.Close()
+
+	addrs, err := handle.AddrList(nil, netlink.FAMILY_V4)
+	if err != nil {
+		return false, fmt.Errorf("failed to list container addresses: %w", err)
+	}
+
+	for _, addr := range addrs {
+		if addr.IPNet.String() == ep.IPNet.String() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
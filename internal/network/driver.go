@@ -1,18 +1,23 @@
 package network
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net"
 	"time"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 const bridgePrefix = "br-"
 
 type Driver interface {
-	// create sets up network infrastructure using given subnet.
-	create(name string, subnet *net.IPNet) (*Network, error)
+	// create sets up network infrastructure using given subnet and options.
+	//
+	// With adopt, infrastructure left behind by an earlier run is reused.
+	create(name string, subnet *net.IPNet, opts Options, adopt bool) (*Network, error)
 
 	// delete tears down network infrastructure for given network.
 	delete(nw *Network) error
@@ -23,15 +28,48 @@ type Driver interface {
 
 type BridgeDriver struct{}
 
-func (d *BridgeDriver) create(name string, subnet *net.IPNet) (*Network, error) {
-	bridgeName := bridgePrefix + name
+func (d *BridgeDriver) create(name string, subnet *net.IPNet, opts Options, adopt bool) (*Network, error) {
+	nw := &Network{
+		Name:    name,
+		Gateway: subnet,
+		Driver:  "bridge",
+		Options: opts,
+	}
+
+	// Existing host bridge is only verified, its address and state are managed
+	// outside tinydock. Its subnet's first address is assumed to be the gateway.
+	if nw.isExternalBridge() {
+		link, err := netlink.LinkByName(nw.bridgeName())
+		if err != nil {
+			return nil, fmt.Errorf("failed to find bridge %s: %w", nw.bridgeName(), err)
+		}
+		if _, ok := link.(*netlink.Bridge); !ok {
+			return nil, fmt.Errorf("%s is not a bridge", nw.bridgeName())
+		}
+
+		return nw, nil
+	}
+
+	bridgeName := nw.bridgeName()
 
-	linkAttrs := netlink.NewLinkAttrs()
-	linkAttrs.Name = bridgeName
-	bridge := &netlink.Bridge{LinkAttrs: linkAttrs}
+	var bridge netlink.Link
+	if link, err := netlink.LinkByName(bridgeName); err == nil {
+		if !adopt {
+			return nil, fmt.Errorf("bridge %s already exists, use -adopt to reuse it", bridgeName)
+		}
+		if _, ok := link.(*netlink.Bridge); !ok {
+			return nil, fmt.Errorf("%s exists but is not a bridge", bridgeName)
+		}
+		log.Printf("Warning: adopting existing bridge %s", bridgeName)
+		bridge = link
+	} else {
+		linkAttrs := netlink.NewLinkAttrs()
+		linkAttrs.Name = bridgeName
+		bridge = &netlink.Bridge{LinkAttrs: linkAttrs}
 
-	if err := netlink.LinkAdd(bridge); err != nil {
-		return nil, fmt.Errorf("failed to create bridge: %w", err)
+		if err := netlink.LinkAdd(bridge); err != nil {
+			return nil, fmt.Errorf("failed to create bridge: %w", err)
+		}
 	}
 
 	addr := &netlink.Addr{
@@ -40,7 +78,8 @@ func (d *BridgeDriver) create(name string, subnet *net.IPNet) (*Network, error)
 			Mask: subnet.Mask,
 		},
 	}
-	if err := netlink.AddrAdd(bridge, addr); err != nil {
+	// An adopted bridge may already carry gateway address
+	if err := netlink.AddrAdd(bridge, addr); err != nil && !(adopt && errors.Is(err, unix.EEXIST)) {
 		return nil, fmt.Errorf("failed to set bridge IP: %w", err)
 	}
 
@@ -48,15 +87,15 @@ func (d *BridgeDriver) create(name string, subnet *net.IPNet) (*Network, error)
 		return nil, fmt.Errorf("failed to set bridge up: %w", err)
 	}
 
-	return &Network{
-		Name:    name,
-		Gateway: subnet,
-		Driver:  "bridge",
-	}, nil
+	return nw, nil
 }
 
 func (d *BridgeDriver) delete(nw *Network) error {
-	bridgeName := bridgePrefix + nw.Name
+	if nw.isExternalBridge() {
+		return nil
+	}
+
+	bridgeName := nw.bridgeName()
 
 	link, err := netlink.LinkByName(bridgeName)
 	if err != nil {
@@ -77,6 +116,9 @@ func (d *BridgeDriver) connect(nw *Network, ep *Endpoint, pid int) error {
 	}
 
 	if err := d.configureHostNetwork(veth, ep, nw, pid); err != nil {
+		if delErr := deleteVeth(veth.Name); delErr != nil {
+			log.Printf("Error deleting veth %s: %v", veth.Name, delErr)
+		}
 		return err
 	}
 
@@ -117,7 +159,7 @@ func (d *BridgeDriver) configureHostNetwork(veth *netlink.Veth, ep *Endpoint, nw
 	}
 
 	// Connect host end to bridge
-	bridge, err := netlink.LinkByName(bridgePrefix + nw.Name)
+	bridge, err := netlink.LinkByName(nw.bridgeName())
 	if err != nil {
 		return fmt.Errorf("failed to find bridge: %w", err)
 	}
@@ -129,7 +171,8 @@ func (d *BridgeDriver) configureHostNetwork(veth *netlink.Veth, ep *Endpoint, nw
 	if err = netlink.LinkSetUp(veth); err != nil {
 		return fmt.Errorf("failed to set host veth up: %w", err)
 	}
-	ep.HostInterface = bridgePrefix + nw.Name
+	ep.HostInterface = nw.bridgeName()
+	ep.Veth = veth.Name
 
 	return nil
 }
@@ -150,6 +193,11 @@ func (d *BridgeDriver) configureContainerNetwork(containerVeth string, ep *Endpo
 		return fmt.Errorf("failed to set container interface up: %w", err)
 	}
 
+	// Internal networks get no default route, leaving only the on-link subnet reachable
+	if nw.Internal {
+		return nil
+	}
+
 	// Add default route
 	route := &netlink.Route{
 		Scope:     netlink.SCOPE_UNIVERSE,
@@ -163,3 +211,22 @@ func (d *BridgeDriver) configureContainerNetwork(containerVeth string, ep *Endpo
 
 	return nil
 }
+
+// deleteVeth deletes host side of a veth pair, which also removes its peer.
+//
+// A veth already removed by kernel is not treated as an error.
+func deleteVeth(name string) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("failed to find veth: %w", err)
+	}
+
+	if err := netlink.LinkDel(link); err != nil {
+		return fmt.Errorf("failed to delete veth: %w", err)
+	}
+
+	return nil
+}
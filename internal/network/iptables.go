@@ -16,68 +16,79 @@ func execIptables(args ...string) error {
 	return nil
 }
 
+// ensureRule inserts ("-I") or appends ("-A") given rule to chain of table,
+// unless an identical rule already exists, e.g. one left behind by a crash.
+func ensureRule(table, action, chain string, rule ...string) error {
+	check := append([]string{"-t", table, "-C", chain}, rule...)
+	if exec.Command("iptables", check...).Run() == nil {
+		return nil
+	}
+
+	return execIptables(append([]string{"-t", table, action, chain}, rule...)...)
+}
+
 // enableExternalAccess allows given network's containers to access external networks.
+//
+// Internal networks have no external access, and pre-existing host bridges are
+// left alone as their NAT is managed outside tinydock.
 func enableExternalAccess(nw *Network) error {
-	return execIptables(
-		"-t", "nat",
-		"-A", "POSTROUTING",
+	if nw.Internal || nw.isExternalBridge() {
+		return nil
+	}
+
+	return ensureRule(
+		"nat", "-A", "POSTROUTING",
 		"-s", nw.Gateway.String(),
-		"!", "-o", "br-"+nw.Name,
+		"!", "-o", nw.bridgeName(),
 		"-j", "MASQUERADE",
 	)
 }
 
 // disableExternalAccess removes iptables rule for given network's external access.
 func disableExternalAccess(nw *Network) error {
+	if nw.Internal || nw.isExternalBridge() {
+		return nil
+	}
+
 	return execIptables(
 		"-t", "nat",
 		"-D", "POSTROUTING",
 		"-s", nw.Gateway.String(),
-		"!", "-o", "br-"+nw.Name,
+		"!", "-o", nw.bridgeName(),
 		"-j", "MASQUERADE",
 	)
 }
 
+// disableICC blocks traffic between containers attached to given network's bridge.
+//
+// NOTE: Bridged traffic only traverses iptables when br_netfilter is loaded and
+// `net.bridge.bridge-nf-call-iptables=1` is set.
+func disableICC(nw *Network) error {
+	return ensureRule(
+		"filter", "-I", "FORWARD",
+		"-i", nw.bridgeName(),
+		"-o", nw.bridgeName(),
+		"-j", "DROP",
+	)
+}
+
+// enableICC removes iptables rule blocking traffic between given network's containers.
+func enableICC(nw *Network) error {
+	return execIptables(
+		"-D", "FORWARD",
+		"-i", nw.bridgeName(),
+		"-o", nw.bridgeName(),
+		"-j", "DROP",
+	)
+}
+
 // setupPortForwarding configures iptables rules for port forwarding to container.
 //
 // NOTE: Set `net.ipv4.conf.all.route_localnet=1` to enable localhost access.
 // Without this setting, the kernel blocks localhost port forwarding after DNAT.
 func setupPortForwarding(ep *Endpoint) error {
-	containerIP := ep.IPNet.IP.String()
-
-	for _, pm := range ep.PortMappings {
-		if err := execIptables(
-			"-t", "nat",
-			"-A", "PREROUTING",
-			"!", "-i", ep.HostInterface,
-			"-p", "tcp",
-			"--dport", strconv.Itoa(int(pm.HostPort)),
-			"-j", "DNAT",
-			"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
-		); err != nil {
-			return err
-		}
-
-		if err := execIptables(
-			"-t", "nat",
-			"-A", "OUTPUT",
-			"-p", "tcp",
-			"-d", "127.0.0.1",
-			"--dport", strconv.Itoa(int(pm.HostPort)),
-			"-j", "DNAT",
-			"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
-		); err != nil {
-			return err
-		}
-
-		if err := execIptables(
-			"-t", "nat",
-			"-A", "POSTROUTING",
-			"-p", "tcp",
-			"-d", containerIP,
-			"--dport", strconv.Itoa(int(pm.ContainerPort)),
-			"-j", "MASQUERADE",
-		); err != nil {
+	for _, rule := range portForwardingRules("-A", ep.HostInterface, ep.IPNet.IP.String(), ep.PortMappings) {
+		if err := execIptables(rule...); err != nil {
 			return err
 		}
 	}
@@ -87,44 +98,49 @@ func setupPortForwarding(ep *Endpoint) error {
 
 // cleanupPortForwarding removes iptables rules configured for port forwarding to container.
 func cleanupPortForwarding(ep *Endpoint) error {
-	containerIP := ep.IPNet.IP.String()
-
-	for _, pm := range ep.PortMappings {
-		if err := execIptables(
-			"-t", "nat",
-			"-D", "PREROUTING",
-			"!", "-i", ep.HostInterface,
-			"-p", "tcp",
-			"--dport", strconv.Itoa(int(pm.HostPort)),
-			"-j", "DNAT",
-			"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
-		); err != nil {
+	for _, rule := range portForwardingRules("-D", ep.HostInterface, ep.IPNet.IP.String(), ep.PortMappings) {
+		if err := execIptables(rule...); err != nil {
 			return err
 		}
+	}
 
-		if err := execIptables(
-			"-t", "nat",
-			"-D", "OUTPUT",
-			"-p", "tcp",
-			"-d", "127.0.0.1",
-			"--dport", strconv.Itoa(int(pm.HostPort)),
-			"-j", "DNAT",
-			"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
-		); err != nil {
-			return err
-		}
+	return nil
+}
 
-		if err := execIptables(
-			"-t", "nat",
-			"-D", "POSTROUTING",
-			"-p", "tcp",
-			"-d", containerIP,
-			"--dport", strconv.Itoa(int(pm.ContainerPort)),
-			"-j", "MASQUERADE",
-		); err != nil {
-			return err
-		}
+// portForwardingRules returns iptables arguments that append ("-A") or delete
+// ("-D") rules forwarding given host ports to container.
+func portForwardingRules(action, hostInterface, containerIP string, pms PortMappings) [][]string {
+	var rules [][]string
+	for _, pm := range pms {
+		rules = append(rules,
+			[]string{
+				"-t", "nat",
+				action, "PREROUTING",
+				"!", "-i", hostInterface,
+				"-p", "tcp",
+				"--dport", strconv.Itoa(int(pm.HostPort)),
+				"-j", "DNAT",
+				"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
+			},
+			[]string{
+				"-t", "nat",
+				action, "OUTPUT",
+				"-p", "tcp",
+				"-d", "127.0.0.1",
+				"--dport", strconv.Itoa(int(pm.HostPort)),
+				"-j", "DNAT",
+				"--to-destination", fmt.Sprintf("%s:%d", containerIP, pm.ContainerPort),
+			},
+			[]string{
+				"-t", "nat",
+				action, "POSTROUTING",
+				"-p", "tcp",
+				"-d", containerIP,
+				"--dport", strconv.Itoa(int(pm.ContainerPort)),
+				"-j", "MASQUERADE",
+			},
+		)
 	}
 
-	return nil
+	return rules
 }
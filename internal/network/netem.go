@@ -0,0 +1,94 @@
+package network
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Impairment describes network conditions emulated by netem.
+type Impairment struct {
+	// Delay is added to every packet, varied by up to Jitter either way.
+	Delay  time.Duration
+	Jitter time.Duration
+
+	// Loss is percentage of packets dropped.
+	Loss float64
+}
+
+// ParseLoss parses a packet loss percentage such as "1%" or "0.5".
+func ParseLoss(s string) (float64, error) {
+	loss, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || loss < 0 || loss > 100 {
+		return 0, fmt.Errorf("invalid loss %q: must be a percentage between 0 and 100", s)
+	}
+	return loss, nil
+}
+
+// netemArgs builds tc netem parameters of impairment.
+func (imp Impairment) netemArgs() []string {
+	var args []string
+	if imp.Delay > 0 {
+		args = append(args, "delay", formatTCTime(imp.Delay))
+		if imp.Jitter > 0 {
+			args = append(args, formatTCTime(imp.Jitter))
+		}
+	}
+	if imp.Loss > 0 {
+		args = append(args, "loss", strconv.FormatFloat(imp.Loss, 'f', -1, 64)+"%")
+	}
+	return args
+}
+
+// formatTCTime renders duration in microseconds, a unit understood by tc.
+func formatTCTime(d time.Duration) string {
+	return strconv.FormatInt(d.Microseconds(), 10) + "us"
+}
+
+// ApplyImpairment emulates given conditions on host side of a container's veth,
+// replacing any applied before.
+//
+// Host side egress is container ingress, so only traffic sent to container is
+// affected, which also delays replies seen by container peers.
+func ApplyImpairment(ep *Endpoint, imp Impairment) error {
+	if imp.Delay < 0 || imp.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must not be negative")
+	}
+	if imp.Jitter > 0 && imp.Delay == 0 {
+		return fmt.Errorf("jitter requires a delay")
+	}
+
+	args := imp.netemArgs()
+	if len(args) == 0 {
+		return fmt.Errorf("no delay or loss given")
+	}
+
+	return execTC(append([]string{"qdisc", "replace", "dev", ep.Veth, "root", "netem"}, args...)...)
+}
+
+// ClearImpairment removes emulated conditions from a container's veth.
+//
+// A veth without impairment is not treated as an error.
+func ClearImpairment(ep *Endpoint) error {
+	out, err := exec.Command("tc", "qdisc", "show", "dev", ep.Veth, "root").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc qdisc show: %w: %s", err, out)
+	}
+	if !strings.Contains(string(out), "netem") {
+		return nil
+	}
+
+	return execTC("qdisc", "del", "dev", ep.Veth, "root")
+}
+
+// execTC executes tc command with given arguments and returns error if any.
+func execTC(args ...string) error {
+	cmd := exec.Command("tc", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("tc %v: %w: %s", args, err, out)
+	}
+
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/vishvananda/netlink"
@@ -17,44 +18,135 @@ import (
 )
 
 const (
-	defaultDriver = "bridge"
-	defaultSubnet = "172.26.0.0/16"
+	defaultDriver  = "bridge"
+	defaultSubnet  = "172.26.0.0/16"
+	defaultNetwork = "tinydock0"
 )
 
-var (
-	networkDir = filepath.Join(config.Root, "network")
-
-	drivers = map[string]Driver{
-		"bridge": &BridgeDriver{},
-	}
+var drivers = map[string]Driver{
+	"bridge": &BridgeDriver{},
+}
 
-	ipamer *ipam.IPAM
-)
+// networkDir returns directory holding network configurations.
+func networkDir() string {
+	return filepath.Join(config.Root(), "network")
+}
 
 // Network represents network configuration.
+//
+// Conflicts are addresses reserved because a device not managed by tinydock
+// answered ARP probes for them, released when network is removed.
 type Network struct {
-	Name    string     `json:"name"`
-	Gateway *net.IPNet `json:"gateway"`
-	Driver  string     `json:"driver"`
+	Name      string       `json:"name"`
+	Gateway   *net.IPNet   `json:"gateway"`
+	Driver    string       `json:"driver"`
+	Internal  bool         `json:"internal,omitempty"`
+	Options   Options      `json:"options,omitempty"`
+	Conflicts []*net.IPNet `json:"conflicts,omitempty"`
+}
+
+// bridgeName returns name of bridge device backing network.
+func (nw *Network) bridgeName() string {
+	if name := nw.Options["bridge"]; name != "" {
+		return name
+	}
+	return bridgePrefix + nw.Name
+}
+
+// isExternalBridge reports whether network uses a pre-existing host bridge not
+// managed by tinydock.
+func (nw *Network) isExternalBridge() bool {
+	return nw.Options["bridge"] != ""
+}
+
+// iccEnabled reports whether containers on network may communicate with each other.
+func (nw *Network) iccEnabled() bool {
+	return nw.Options["icc"] != "false"
+}
+
+// arpProbeEnabled reports whether addresses are probed for before containers on
+// network are given them.
+func (nw *Network) arpProbeEnabled() bool {
+	return nw.Options["arp_probe"] == "true"
+}
+
+// arpProbeAttempts bounds how many addresses are probed for a single container,
+// each attempt taking up to arpProbeWait.
+const arpProbeAttempts = 4
+
+// requestFreeIP allocates an address in prefix that no device on bridge of
+// network, not managed by tinydock, answers ARP probes for.
+//
+// Addresses found in use stay reserved and are recorded in network, so they are
+// not handed out again while device holding them is there.
+func requestFreeIP(nw *Network, ipamer *ipam.IPAM, prefix *net.IPNet) (*net.IPNet, error) {
+	for range arpProbeAttempts {
+		ipNet, err := ipamer.RequestIP(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to request IP: %w", err)
+		}
+
+		owner, err := probeARP(nw.bridgeName(), ipNet.IP)
+		if err != nil {
+			if releaseErr := ipamer.ReleaseIP(ipNet); releaseErr != nil {
+				log.Printf("Error releasing IP %s: %v", ipNet.String(), releaseErr)
+			}
+			return nil, err
+		}
+		if owner == nil {
+			return ipNet, nil
+		}
+
+		log.Printf("Address %s is in use by %s on %s, keeping it reserved", ipNet.IP, owner, nw.bridgeName())
+		nw.Conflicts = append(nw.Conflicts, ipNet)
+		if err := save(nw); err != nil {
+			log.Printf("Error recording reserved IP %s: %v", ipNet.String(), err)
+		}
+	}
+
+	return nil, fmt.Errorf("no free address found on %s after %d attempts, move devices out of subnet %s", nw.bridgeName(), arpProbeAttempts, prefix)
 }
 
 // Endpoint represents network endpoint configuration for single container.
 //
-// NOTE: No need to keep track of devices as kernel automatically cleans up veth devices
-// when container exits.
+// HostInterface is the bridge container traffic enters host through, and Veth is
+// host side of the veth pair connecting container to it.
 type Endpoint struct {
+	Network       string       `json:"network"`
 	IPNet         *net.IPNet   `json:"ipnet"`
 	HostInterface string       `json:"host_interface"`
+	Veth          string       `json:"veth"`
 	PortMappings  PortMappings `json:"port_mappings"`
+	ExposedPorts  ExposedPorts `json:"exposed_ports,omitempty"`
+}
+
+// Ports returns all container ports reachable through endpoint, published or
+// only exposed, in "HOST->CONTAINER" or "CONTAINER" form.
+func (ep *Endpoint) Ports() []string {
+	ports := make([]string, 0, len(ep.PortMappings)+len(ep.ExposedPorts))
+	published := make(map[uint16]bool)
+
+	for _, p := range ep.PortMappings {
+		ports = append(ports, fmt.Sprintf("%d->%d", p.HostPort, p.ContainerPort))
+		published[p.ContainerPort] = true
+	}
+
+	for _, p := range ep.ExposedPorts {
+		if !published[p] {
+			ports = append(ports, strconv.Itoa(int(p)))
+		}
+	}
+
+	return ports
 }
 
-// init initializes global IP allocator during package load.
-func init() {
-	var err error
-	ipamer, err = ipam.New(filepath.Join(networkDir, "ipam", "ipam.json"))
+// allocator loads IP allocator from its state under root directory.
+func allocator() (*ipam.IPAM, error) {
+	ipamer, err := ipam.New(filepath.Join(networkDir(), "ipam", "ipam.json"))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("failed to load IP allocator: %w", err)
 	}
+	return ipamer, nil
 }
 
 // Setup enables loopback interface for container and connects it to network if specified.
@@ -76,8 +168,12 @@ func Setup(pid int, nw string, pms PortMappings) (*Endpoint, error) {
 	return endpoint, nil
 }
 
-// Create sets up and saves a network with given name, driver, and subnet.
-func Create(name, driver, subnet string) error {
+// Create sets up and saves a network with given name, driver, subnet, and options.
+//
+// Containers on an internal network can reach each other but not external networks.
+// With adopt, a bridge or prefix left behind by an earlier run (e.g. after a crash)
+// is reconciled and reused instead of failing.
+func Create(name, driver, subnet string, internal, adopt bool, opts Options) error {
 	if driver == "" {
 		driver = defaultDriver
 	}
@@ -87,6 +183,9 @@ func Create(name, driver, subnet string) error {
 	}
 
 	if subnet == "" {
+		if opts["bridge"] != "" {
+			return fmt.Errorf("subnet of existing bridge %s must be specified", opts["bridge"])
+		}
 		subnet = defaultSubnet
 	}
 	_, prefixNet, err := net.ParseCIDR(subnet)
@@ -94,43 +193,80 @@ func Create(name, driver, subnet string) error {
 		return fmt.Errorf("failed to parse subnet: %w", err)
 	}
 
-	// First create the prefix
-	if err := ipamer.CreatePrefix(subnet); err != nil {
-		return fmt.Errorf("failed to create prefix: %w", err)
-	}
-
-	// Request gateway IP from prefix
-	gatewayIPNet, err := ipamer.RequestIP(prefixNet)
+	ipamer, err := allocator()
 	if err != nil {
-		if releaseErr := ipamer.ReleasePrefix(prefixNet); releaseErr != nil {
-			log.Printf("failed to release prefix after IP request failure: %v", releaseErr)
+		return err
+	}
+
+	var gatewayIPNet *net.IPNet
+	adopted := adopt && ipamer.HasPrefix(prefixNet)
+
+	if adopted {
+		// Gateway is always first address of subnet, as RequestIP hands it out
+		// first on a fresh prefix
+		log.Printf("Warning: adopting existing prefix %s", prefixNet)
+		gateway := make(net.IP, net.IPv4len)
+		copy(gateway, prefixNet.IP.To4())
+		gateway[net.IPv4len-1]++
+		gatewayIPNet = &net.IPNet{IP: gateway, Mask: prefixNet.Mask}
+		if err := ipamer.ReserveIP(gatewayIPNet); err != nil {
+			return fmt.Errorf("failed to reserve gateway IP: %w", err)
+		}
+	} else {
+		// First create the prefix
+		if err := ipamer.CreatePrefix(subnet); err != nil {
+			if !adopt && ipamer.HasPrefix(prefixNet) {
+				return fmt.Errorf("failed to create prefix: %w (use -adopt to reuse it)", err)
+			}
+			return fmt.Errorf("failed to create prefix: %w", err)
+		}
+
+		// Request gateway IP from prefix
+		gatewayIPNet, err = ipamer.RequestIP(prefixNet)
+		if err != nil {
+			if releaseErr := ipamer.ReleasePrefix(prefixNet); releaseErr != nil {
+				log.Printf("failed to release prefix after IP request failure: %v", releaseErr)
+			}
+			return fmt.Errorf("failed to request gateway IP: %w", err)
 		}
-		return fmt.Errorf("failed to request gateway IP: %w", err)
 	}
 
-	nw, err := d.create(name, gatewayIPNet)
-	if err != nil {
-		// Clean up IP and prefix on failure
+	// release cleans up IP and prefix on failure. Adopted state is kept, as it
+	// predates this call.
+	release := func() {
+		if adopted {
+			return
+		}
 		if releaseErr := ipamer.ReleaseIP(gatewayIPNet); releaseErr != nil {
 			log.Printf("failed to release gateway IP after network creation failure: %v", releaseErr)
 		}
 		if releaseErr := ipamer.ReleasePrefix(prefixNet); releaseErr != nil {
 			log.Printf("failed to release prefix after network creation failure: %v", releaseErr)
 		}
+	}
+
+	nw, err := d.create(name, gatewayIPNet, opts, adopt)
+	if err != nil {
+		release()
 		return fmt.Errorf("failed to set up network: %w", err)
 	}
+	nw.Internal = internal
 
 	if err := enableExternalAccess(nw); err != nil {
-		// Clean up network resources, IP, and prefix on failure
-		if releaseErr := ipamer.ReleaseIP(gatewayIPNet); releaseErr != nil {
-			log.Printf("failed to release gateway IP after external access failure: %v", releaseErr)
-		}
-		if releaseErr := ipamer.ReleasePrefix(prefixNet); releaseErr != nil {
-			log.Printf("failed to release prefix after external access failure: %v", releaseErr)
-		}
+		release()
 		return fmt.Errorf("failed to enable external access: %w", err)
 	}
 
+	if !nw.iccEnabled() {
+		if err := disableICC(nw); err != nil {
+			if disableErr := disableExternalAccess(nw); disableErr != nil {
+				log.Printf("failed to disable external access after icc failure: %v", disableErr)
+			}
+			release()
+			return fmt.Errorf("failed to disable inter-container communication: %w", err)
+		}
+	}
+
 	return save(nw)
 }
 
@@ -150,16 +286,33 @@ func Remove(name string) error {
 		log.Printf("Error disabling external access %s: %v", nw.Gateway.String(), err)
 	}
 
+	if !nw.iccEnabled() {
+		if err := enableICC(nw); err != nil {
+			log.Printf("Error removing icc rule for %s: %v", nw.Name, err)
+		}
+	}
+
 	_, prefix, err := net.ParseCIDR(nw.Gateway.String())
 	if err != nil {
 		return fmt.Errorf("invalid gateway network %s: %w", nw.Gateway, err)
 	}
 
+	ipamer, err := allocator()
+	if err != nil {
+		return err
+	}
+
 	// Release gateway IP first
 	if err := ipamer.ReleaseIP(nw.Gateway); err != nil {
 		log.Printf("failed to release gateway IP: %v", err) // Log but continue
 	}
 
+	for _, ipNet := range nw.Conflicts {
+		if err := ipamer.ReleaseIP(ipNet); err != nil {
+			log.Printf("failed to release reserved IP %s: %v", ipNet.String(), err)
+		}
+	}
+
 	// Then release the prefix
 	if err := ipamer.ReleasePrefix(prefix); err != nil {
 		return fmt.Errorf("failed to release prefix: %w", err)
@@ -169,7 +322,7 @@ func Remove(name string) error {
 		return fmt.Errorf("failed to delete network: %w", err)
 	}
 
-	return os.Remove(filepath.Join(networkDir, name+".json"))
+	return os.Remove(filepath.Join(networkDir(), name+".json"))
 }
 
 // List displays all configured networks.
@@ -179,21 +332,93 @@ func List() error {
 		return fmt.Errorf("failed to load networks: %w", err)
 	}
 
-	fmt.Printf("%-15s %-10s %s\n", "NAME", "DRIVER", "GATEWAY")
+	fmt.Printf("%-15s %-10s %-20s %s\n", "NAME", "DRIVER", "GATEWAY", "INTERNAL")
 
 	for _, nw := range networks {
-		fmt.Printf("%-15s %-10s %s\n",
+		fmt.Printf("%-15s %-10s %-20s %t\n",
 			nw.Name,
 			nw.Driver,
 			nw.Gateway.String(),
+			nw.Internal,
 		)
 	}
 
 	return nil
 }
 
+// ListIPAM displays address usage of all prefixes managed by IPAM, along with
+// networks they belong to.
+func ListIPAM() error {
+	ipamer, err := allocator()
+	if err != nil {
+		return err
+	}
+
+	usages, err := ipamer.Usages()
+	if err != nil {
+		return fmt.Errorf("failed to read IPAM usage: %w", err)
+	}
+
+	networks, err := loadAll()
+	if err != nil {
+		return fmt.Errorf("failed to load networks: %w", err)
+	}
+
+	owners := make(map[string]string)
+	for _, nw := range networks {
+		subnet := &net.IPNet{IP: nw.Gateway.IP.Mask(nw.Gateway.Mask), Mask: nw.Gateway.Mask}
+		owners[subnet.String()] = nw.Name
+	}
+
+	fmt.Printf("%-20s %-15s %-10s %-10s %-10s %s\n", "PREFIX", "NETWORK", "TOTAL", "USED", "FREE", "UTILIZATION")
+
+	for _, u := range usages {
+		owner := owners[u.CIDR]
+		if owner == "" {
+			owner = "-"
+		}
+
+		fmt.Printf("%-20s %-15s %-10d %-10d %-10d %.1f%%\n",
+			u.CIDR,
+			owner,
+			u.Total,
+			u.Used,
+			u.Free(),
+			u.Utilization(),
+		)
+	}
+
+	return nil
+}
+
+// Names returns names of all configured networks.
+func Names() ([]string, error) {
+	networks, err := loadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load networks: %w", err)
+	}
+
+	names := make([]string, len(networks))
+	for i, nw := range networks {
+		names[i] = nw.Name
+	}
+	return names, nil
+}
+
 // Connect creates a network endpoint between network of given name and container specified by pid.
+//
+// Name "bridge" refers to default network, which is created on first use.
 func Connect(pid int, name string, pms PortMappings) (*Endpoint, error) {
+	if name == defaultDriver {
+		name = defaultNetwork
+	}
+
+	if name == defaultNetwork {
+		if err := ensureDefaultNetwork(); err != nil {
+			return nil, err
+		}
+	}
+
 	nw, err := load(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load network: %w", err)
@@ -209,12 +434,26 @@ func Connect(pid int, name string, pms PortMappings) (*Endpoint, error) {
 		return nil, fmt.Errorf("invalid gateway network %s: %w", nw.Gateway, err)
 	}
 
-	ipNet, err := ipamer.RequestIP(prefix)
+	ipamer, err := allocator()
+	if err != nil {
+		return nil, err
+	}
+
+	var ipNet *net.IPNet
+	if nw.arpProbeEnabled() {
+		ipNet, err = requestFreeIP(nw, ipamer, prefix)
+	} else {
+		ipNet, err = ipamer.RequestIP(prefix)
+		if err != nil {
+			err = fmt.Errorf("failed to request IP: %w", err)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to request IP: %w", err)
+		return nil, err
 	}
 
 	ep := &Endpoint{
+		Network:      name,
 		IPNet:        ipNet,
 		PortMappings: pms,
 	}
@@ -238,12 +477,43 @@ func Connect(pid int, name string, pms PortMappings) (*Endpoint, error) {
 	return ep, nil
 }
 
+// Counters returns bytes container received and sent through endpoint, read
+// from host side of its veth, where directions are reversed.
+func Counters(ep *Endpoint) (rx, tx uint64, err error) {
+	link, err := netlink.LinkByName(ep.Veth)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to find veth %s: %w", ep.Veth, err)
+	}
+
+	s := link.Attrs().Statistics
+	if s == nil {
+		return 0, 0, fmt.Errorf("no statistics for veth %s", ep.Veth)
+	}
+
+	return s.TxBytes, s.RxBytes, nil
+}
+
 // Disconnect removes network endpoint and releases its resources.
+//
+// Kernel deletes the veth pair once container network namespace is gone, but it
+// is deleted explicitly here so that it does not linger while namespace is kept
+// alive (e.g., by a leftover exec session).
 func Disconnect(ep *Endpoint) error {
 	if err := cleanupPortForwarding(ep); err != nil {
 		log.Printf("Error cleaning up port forwarding %s: %v", ep.IPNet.String(), err)
 	}
 
+	if ep.Veth != "" {
+		if err := deleteVeth(ep.Veth); err != nil {
+			log.Printf("Error deleting veth %s: %v", ep.Veth, err)
+		}
+	}
+
+	ipamer, err := allocator()
+	if err != nil {
+		return err
+	}
+
 	return ipamer.ReleaseIP(ep.IPNet)
 }
 
@@ -263,9 +533,24 @@ func EnableLoopback(pid int) error {
 	})
 }
 
+// ensureDefaultNetwork creates default network with default subnet if it does not exist.
+func ensureDefaultNetwork() error {
+	if _, err := os.Stat(filepath.Join(networkDir(), defaultNetwork+".json")); err == nil {
+		return nil
+	}
+
+	// Default network is created implicitly, so leftovers of an interrupted
+	// creation are adopted rather than blocking every later run
+	if err := Create(defaultNetwork, defaultDriver, defaultSubnet, false, true, nil); err != nil {
+		return fmt.Errorf("failed to create default network %s: %w", defaultNetwork, err)
+	}
+
+	return nil
+}
+
 // save persists network information to disk.
 func save(nw *Network) error {
-	if err := os.MkdirAll(networkDir, 0755); err != nil {
+	if err := os.MkdirAll(networkDir(), 0755); err != nil {
 		return fmt.Errorf("failed to create network directory: %w", err)
 	}
 
@@ -274,7 +559,7 @@ func save(nw *Network) error {
 		return fmt.Errorf("failed to marshal network info: %w", err)
 	}
 
-	path := filepath.Join(networkDir, nw.Name+".json")
+	path := filepath.Join(networkDir(), nw.Name+".json")
 	if err := os.WriteFile(path, data, 0644); err != nil {
 		return fmt.Errorf("failed to save network info: %w", err)
 	}
@@ -284,7 +569,7 @@ func save(nw *Network) error {
 
 // load retrieves network information from disk by name.
 func load(name string) (*Network, error) {
-	path := filepath.Join(networkDir, name+".json")
+	path := filepath.Join(networkDir(), name+".json")
 
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -304,7 +589,10 @@ func load(name string) (*Network, error) {
 
 // loadAll retrieves all network information from disk.
 func loadAll() ([]*Network, error) {
-	files, err := os.ReadDir(networkDir)
+	files, err := os.ReadDir(networkDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to read network directory: %w", err)
 	}
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options is a set of driver specific network options that implements flag.Value interface.
+type Options map[string]string
+
+// Supported option keys and their accepted values.
+var supportedOptions = map[string][]string{
+	// icc toggles inter-container communication on the same bridge.
+	"icc": {"true", "false"},
+
+	// bridge attaches network to an existing host bridge instead of creating one.
+	"bridge": nil,
+
+	// arp_probe checks address of each container is unused on bridge before
+	// assigning it, e.g. when bridge is shared with other hosts on LAN.
+	"arp_probe": {"true", "false"},
+}
+
+func (o *Options) String() string {
+	pairs := make([]string, 0, len(*o))
+	for k, v := range *o {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (o *Options) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expect KEY=VALUE")
+	}
+
+	allowed, ok := supportedOptions[key]
+	if !ok {
+		return fmt.Errorf("unsupported option: %s", key)
+	}
+	if len(allowed) > 0 && !contains(allowed, val) {
+		return fmt.Errorf("invalid value for option %s: %s (expect one of %s)",
+			key, val, strings.Join(allowed, ", "))
+	}
+
+	if *o == nil {
+		*o = make(Options)
+	}
+	(*o)[key] = val
+	return nil
+}
+
+// contains reports whether s is in slice.
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plan describes steps Setup would take to connect a container to given network
+// with given port mappings, without changing anything.
+//
+// Names and addresses only known once allocated are shown as placeholders.
+func Plan(name string, pms PortMappings) ([]string, error) {
+	var steps []string
+
+	if name != "" {
+		if name == defaultDriver {
+			name = defaultNetwork
+		}
+
+		var nw *Network
+		if _, err := os.Stat(filepath.Join(networkDir(), name+".json")); os.IsNotExist(err) && name == defaultNetwork {
+			// Gateway takes first address of subnet once network is created
+			_, subnet, _ := net.ParseCIDR(defaultSubnet)
+			gateway := &net.IPNet{IP: make(net.IP, len(subnet.IP)), Mask: subnet.Mask}
+			copy(gateway.IP, subnet.IP)
+			gateway.IP[len(gateway.IP)-1]++
+
+			nw = &Network{Name: defaultNetwork, Driver: defaultDriver, Gateway: gateway}
+			steps = append(steps, fmt.Sprintf("create default network %s on bridge %s with subnet %s and gateway %s",
+				defaultNetwork, nw.bridgeName(), defaultSubnet, gateway.IP))
+		} else {
+			loaded, err := load(name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load network: %w", err)
+			}
+			nw = loaded
+		}
+
+		_, prefix, err := net.ParseCIDR(nw.Gateway.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway network %s: %w", nw.Gateway, err)
+		}
+
+		const (
+			hostVeth      = "veth-<random>"
+			containerVeth = "ceth-<random>"
+			containerIP   = "<allocated IP>"
+		)
+
+		steps = append(steps,
+			fmt.Sprintf("allocate IP address from %s", prefix),
+			fmt.Sprintf("create veth pair %s (host) <-> %s (container)", hostVeth, containerVeth),
+			fmt.Sprintf("move %s into container network namespace", containerVeth),
+			fmt.Sprintf("attach %s to bridge %s and bring it up", hostVeth, nw.bridgeName()),
+			fmt.Sprintf("in container: assign %s/%d to %s and bring it up", containerIP, maskSize(prefix), containerVeth),
+		)
+
+		if !nw.Internal {
+			steps = append(steps, fmt.Sprintf("in container: add default route via %s", nw.Gateway.IP))
+		}
+
+		for _, rule := range portForwardingRules("-A", nw.bridgeName(), containerIP, pms) {
+			steps = append(steps, "iptables "+strings.Join(rule, " "))
+		}
+	}
+
+	return append(steps, "in container: bring up loopback interface lo"), nil
+}
+
+// maskSize returns prefix length of given network.
+func maskSize(n *net.IPNet) int {
+	ones, _ := n.Mask.Size()
+	return ones
+}
@@ -40,3 +40,22 @@ func (p *PortMappings) Set(value string) error {
 	})
 	return nil
 }
+
+// ExposedPorts is a list of container ports that implements flag.Value interface.
+//
+// Exposed ports are recorded on endpoint without being published on host.
+type ExposedPorts []uint16
+
+func (e *ExposedPorts) String() string {
+	return fmt.Sprintf("%v", *e)
+}
+
+func (e *ExposedPorts) Set(value string) error {
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || port == 0 {
+		return fmt.Errorf("invalid port: %s", value)
+	}
+
+	*e = append(*e, uint16(port))
+	return nil
+}
@@ -0,0 +1,303 @@
+package overlay
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestName is name of archive entry describing its images.
+const manifestName = "manifest.json"
+
+// archiveManifest lists images bundled in an archive.
+type archiveManifest struct {
+	// Image is reference of saved image.
+	Image string `json:"image"`
+
+	// Layers lists references of image and its parents, topmost first.
+	Layers []string `json:"layers"`
+}
+
+// SaveArchive writes given image into a tar archive at output, so it can be
+// moved to another machine without a registry.
+//
+// The archive holds reference records of image and of every parent it is
+// stacked on under refs/, their blobs and those they are stacked on by content
+// under blobs/sha256/, and a manifest naming them.
+func SaveArchive(ref, output string) error {
+	key, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	chain, err := imageChain(key)
+	if err != nil {
+		return err
+	}
+
+	manifest := archiveManifest{Image: imageRef(key)}
+	for _, k := range chain {
+		manifest.Layers = append(manifest.Layers, imageRef(k))
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive manifest: %w", err)
+	}
+
+	tmpPath := output + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	if err := writeEntry(tw, manifestName, data); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, k := range chain {
+		meta, err := requireImage(k)
+		if err != nil {
+			return err
+		}
+
+		if err := addFile(tw, "refs/"+k+".json", metadataPath(k)); err != nil {
+			return err
+		}
+		for _, digest := range meta.blobs() {
+			if written[digest] {
+				continue
+			}
+			if err := addFile(tw, "blobs/sha256/"+layerID(digest), blobPath(digest)); err != nil {
+				return err
+			}
+			written[digest] = true
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := os.Rename(tmpPath, output); err != nil {
+		return fmt.Errorf("failed to move archive into place: %w", err)
+	}
+
+	return nil
+}
+
+// LoadArchive adds images of an archive written by SaveArchive to store,
+// replacing images of same references, and returns reference of saved image.
+//
+// Blobs are checked against their digests, and ones already in store are
+// not added again.
+func LoadArchive(input string) (string, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(imageDir(), ".load-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Entries are unpacked aside first, so a broken archive leaves store untouched
+	var manifest *archiveManifest
+	records := make(map[string]*Metadata)
+	blobs := make(map[string]string) // temporary path by digest
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return "", fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+
+		if hdr.Name == manifestName {
+			manifest = &archiveManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return "", fmt.Errorf("failed to parse archive manifest: %w", err)
+			}
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(hdr.Name, "refs/"); ok {
+			key, ok := strings.CutSuffix(name, ".json")
+			if !ok || !validKey(key) {
+				return "", fmt.Errorf("unexpected archive entry %q", hdr.Name)
+			}
+
+			var meta Metadata
+			if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+				return "", fmt.Errorf("failed to parse %s: %w", hdr.Name, err)
+			}
+			records[key] = &meta
+			continue
+		}
+
+		hex, ok := strings.CutPrefix(hdr.Name, "blobs/sha256/")
+		if !ok || !validDigest("sha256:"+hex) {
+			return "", fmt.Errorf("unexpected archive entry %q", hdr.Name)
+		}
+
+		path := filepath.Join(tmpDir, hex)
+		if err := extractEntry(tr, path); err != nil {
+			return "", err
+		}
+		if digest, err := fileDigest(path); err != nil {
+			return "", err
+		} else if digest != "sha256:"+hex {
+			return "", fmt.Errorf("blob %s in archive is corrupted", shortID(hex))
+		}
+		blobs["sha256:"+hex] = path
+	}
+
+	if manifest == nil || len(manifest.Layers) == 0 {
+		return "", fmt.Errorf("archive has no image manifest")
+	}
+
+	var keys []string
+	for _, ref := range manifest.Layers {
+		key, err := imageKey(ref)
+		if err != nil {
+			return "", fmt.Errorf("archive manifest is invalid: %w", err)
+		}
+
+		meta := records[key]
+		if meta == nil {
+			return "", fmt.Errorf("archive is missing image '%s'", ref)
+		}
+		for _, digest := range meta.blobs() {
+			if !validDigest(digest) {
+				return "", fmt.Errorf("image '%s' in archive has invalid digest %q", ref, digest)
+			}
+			if _, ok := blobs[digest]; !ok {
+				if _, err := os.Stat(blobPath(digest)); err != nil {
+					return "", fmt.Errorf("archive is missing blob %s of image '%s'", shortID(digest), ref)
+				}
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	// Images of archive may replace parents of each other, but of no others
+	for _, key := range keys {
+		if err := checkReplaceable(key, keys...); err != nil {
+			return "", err
+		}
+	}
+
+	for digest, path := range blobs {
+		if _, err := putBlob(path); err != nil {
+			return "", fmt.Errorf("failed to add blob %s: %w", shortID(digest), err)
+		}
+	}
+
+	// Parents go in first, so a loaded image never points at a missing one
+	for i := len(keys) - 1; i >= 0; i-- {
+		key := keys[i]
+
+		old, err := loadMetadata(key)
+		if err != nil {
+			return "", err
+		}
+
+		meta := records[key]
+		if err := saveMetadata(key, meta); err != nil {
+			return "", err
+		}
+
+		if err := releaseBlobs(old, meta); err != nil {
+			return "", err
+		}
+	}
+
+	return imageRef(keys[0]), nil
+}
+
+// validKey reports whether key is a storage name imageKey can return.
+func validKey(key string) bool {
+	k, err := imageKey(imageRef(key))
+	return err == nil && k == key
+}
+
+// addFile adds file at path to archive under given name.
+func addFile(tw *tar.Writer, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return nil
+}
+
+// writeEntry adds data to archive as a file with given name.
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	return nil
+}
+
+// extractEntry writes current archive entry to path.
+func extractEntry(r io.Reader, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to unpack archive: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return fmt.Errorf("failed to unpack archive: %w", err)
+	}
+
+	return f.Close()
+}
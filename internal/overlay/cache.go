@@ -0,0 +1,582 @@
+package overlay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// cachedImage describes an extracted layer under rootfs/, named by its ID.
+type cachedImage struct {
+	name     string
+	size     int64
+	lastUsed time.Time
+	inUse    bool
+}
+
+// ListCache prints extracted images in least recently used order.
+func ListCache() error {
+	images, err := readCache()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	names, err := layerNames()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-14s %-30s %-20s %-12s %s\n", "LAYER", "IMAGES", "LAST USED", "SIZE", "IN USE")
+
+	var total int64
+	for _, img := range images {
+		total += img.size
+		fmt.Printf("%-14s %-30s %-20s %-12s %t\n",
+			shortID(img.name),
+			names[img.name],
+			img.lastUsed.Format("2006-01-02 15:04:05"),
+			fmt.Sprintf("%.2f MB", float64(img.size)/1024/1024),
+			img.inUse,
+		)
+	}
+
+	limit := "unlimited"
+	if cfg.ImageCacheLimit > 0 {
+		limit = fmt.Sprintf("%.2f MB", float64(cfg.ImageCacheLimit)/1024/1024)
+	}
+	fmt.Printf("\nTotal: %.2f MB, limit: %s\n", float64(total)/1024/1024, limit)
+
+	return nil
+}
+
+// ClearCache removes every extracted layer not used by a container and returns
+// their short IDs. Blobs are kept, so layers are re-extracted on next use.
+func ClearCache() ([]string, error) {
+	images, err := readCache()
+	if err != nil {
+		return nil, err
+	}
+
+	evicted, err := evict(images, 0)
+	for i, id := range evicted {
+		evicted[i] = shortID(id)
+	}
+	return evicted, err
+}
+
+// layerNames maps layer IDs to references of images stored in or stacked on
+// them, joined by commas, or "<none>" if no image refers to them anymore.
+func layerNames() (map[string]string, error) {
+	keys, err := imageKeys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	refs := make(map[string][]string)
+	for _, key := range keys {
+		if meta, err := loadMetadata(key); err == nil && meta != nil {
+			for _, digest := range meta.blobs() {
+				id := layerID(digest)
+				refs[id] = append(refs[id], imageRef(key))
+			}
+		}
+	}
+
+	names := make(map[string]string)
+	entries, err := os.ReadDir(rootfsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read rootfs directory: %w", err)
+	}
+	for _, entry := range entries {
+		names[entry.Name()] = "<none>"
+		if r, ok := refs[entry.Name()]; ok {
+			names[entry.Name()] = strings.Join(r, ",")
+		}
+	}
+
+	return names, nil
+}
+
+// evictImages removes least recently used extracted images until cache fits in
+// configured limit. Images used by containers are never evicted.
+func evictImages() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	if cfg.ImageCacheLimit <= 0 {
+		return nil
+	}
+
+	images, err := readCache()
+	if err != nil {
+		return err
+	}
+
+	_, err = evict(images, int64(cfg.ImageCacheLimit))
+	return err
+}
+
+// evict removes unused images in given order until their total size is within limit.
+func evict(images []cachedImage, limit int64) ([]string, error) {
+	var total int64
+	for _, img := range images {
+		total += img.size
+	}
+
+	var evicted []string
+	for _, img := range images {
+		if total <= limit {
+			break
+		}
+		if img.inUse {
+			continue
+		}
+
+		removed, err := removeImage(img.name)
+		if err != nil {
+			return evicted, err
+		}
+		if removed {
+			total -= img.size
+			evicted = append(evicted, img.name)
+		}
+	}
+
+	return evicted, nil
+}
+
+// DeleteImage removes reference of given image. Its blob and extracted rootfs
+// are removed once no other image refers to them. Images that others are
+// stacked on are kept.
+//
+// Unless force is set, image is kept if a container holds a layer no other
+// image refers to. Rootfs still mounted by a container is kept until cache
+// eviction or clearing drops it once unused.
+func DeleteImage(ref string, force bool) error {
+	image, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	meta, err := lookupImage(image)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		return fmt.Errorf("no such image: %s", ref)
+	}
+
+	children, err := childImages(image)
+	if err != nil {
+		return err
+	}
+	if len(children) > 0 {
+		return fmt.Errorf("image is parent of %s, remove them first", strings.Join(children, ", "))
+	}
+
+	if !force {
+		users, err := exclusiveHolders(image, meta)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			return fmt.Errorf("image is used by container(s) %s, use -f to force", strings.Join(users, ", "))
+		}
+	}
+
+	if err := os.Remove(metadataPath(image)); err != nil {
+		return fmt.Errorf("failed to remove image reference: %w", err)
+	}
+
+	return releaseBlobs(meta, nil)
+}
+
+// PruneImages removes images holding no layer used by a container, except
+// parents of kept ones, then blobs and extracted layers no remaining image
+// refers to. It returns references of removed images and disk space reclaimed.
+//
+// Extracted layers still mounted are kept, as by ClearCache.
+func PruneImages() ([]string, int64, error) {
+	h, err := loadHolds()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	keys, err := imageKeys()
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(keys)
+
+	kept := make(map[string]bool)
+	for _, key := range keys {
+		meta, err := loadMetadata(key)
+		if err != nil || meta == nil || !slices.ContainsFunc(meta.blobs(), func(digest string) bool {
+			return h.count(layerID(digest)) > 0
+		}) {
+			continue
+		}
+
+		chain, err := walkChain(key, loadMetadata)
+		if err != nil {
+			log.Printf("Failed to read parents of image '%s': %v", imageRef(key), err)
+			chain = []string{key}
+		}
+		for _, k := range chain {
+			kept[k] = true
+		}
+	}
+
+	before, err := storeUsage()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var removed []string
+	released := make(map[string]bool)
+	for _, key := range keys {
+		if kept[key] {
+			continue
+		}
+
+		meta, err := loadMetadata(key)
+		if err != nil {
+			log.Printf("Failed to read image '%s': %v", imageRef(key), err)
+			continue
+		}
+		if err := os.Remove(metadataPath(key)); err != nil {
+			return removed, 0, fmt.Errorf("failed to remove image reference: %w", err)
+		}
+		removed = append(removed, imageRef(key))
+		if meta != nil {
+			for _, digest := range meta.blobs() {
+				released[digest] = true
+			}
+		}
+	}
+
+	for digest := range released {
+		if err := releaseBlob(digest); err != nil {
+			return removed, 0, err
+		}
+	}
+
+	if err := removeOrphans(); err != nil {
+		return removed, 0, err
+	}
+
+	after, err := storeUsage()
+	if err != nil {
+		return removed, 0, err
+	}
+
+	return removed, max(before-after, 0), nil
+}
+
+// exclusiveHolders returns IDs of containers holding a layer of image stored
+// under key that no other image refers to, so removing image would drop it.
+func exclusiveHolders(key string, meta *Metadata) ([]string, error) {
+	h, err := loadHolds()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, digest := range meta.blobs() {
+		holders := h.holders(layerID(digest))
+		if len(holders) == 0 {
+			continue
+		}
+
+		refs, err := referencesOf(digest)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(refs, func(k string) bool { return k != key }) {
+			continue
+		}
+
+		for _, id := range holders {
+			if !slices.Contains(users, id) {
+				users = append(users, id)
+			}
+		}
+	}
+
+	sort.Strings(users)
+	return users, nil
+}
+
+// removeOrphans removes blobs and extracted layers no image refers to, left
+// behind e.g. by interrupted removals.
+func removeOrphans() error {
+	keys, err := imageKeys()
+	if err != nil {
+		return err
+	}
+
+	referenced := make(map[string]bool)
+	for _, key := range keys {
+		if meta, err := loadMetadata(key); err == nil && meta != nil {
+			for _, digest := range meta.blobs() {
+				referenced[layerID(digest)] = true
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(blobsDir())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read blob directory: %w", err)
+	}
+	for _, entry := range entries {
+		// Temporary files may belong to blobs being written
+		if strings.HasPrefix(entry.Name(), ".") || referenced[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobsDir(), entry.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove image blob: %w", err)
+		}
+	}
+
+	images, err := readCache()
+	if err != nil {
+		return err
+	}
+	for _, img := range images {
+		if img.inUse || referenced[img.name] {
+			continue
+		}
+		if _, err := removeImage(img.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeUsage returns disk space used by blobs and extracted layers.
+func storeUsage() (int64, error) {
+	var total int64
+	for _, dir := range []string{blobsDir(), rootfsDir()} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		size, err := diskUsage(dir)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+
+	return total, nil
+}
+
+// removeImage deletes extracted rootfs of given layer ID, reporting false if it
+// is locked by another process, e.g. being extracted or mounted.
+func removeImage(image string) (bool, error) {
+	unlock, err := tryLockImage(image)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	rootfsPath := filepath.Join(rootfsDir(), image)
+
+	// Image may have been mounted since cache was read
+	inUse, err := mountedImages()
+	if err != nil {
+		return false, err
+	}
+	if inUse[rootfsPath] {
+		return false, nil
+	}
+
+	// Move aside first so a partially removed rootfs is never used as lower directory
+	tmpPath, err := os.MkdirTemp(rootfsDir(), "."+image+"-")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	trash := filepath.Join(tmpPath, image)
+	if err := os.Rename(rootfsPath, trash); err != nil {
+		os.Remove(tmpPath)
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to move image '%s' out of cache: %w", image, err)
+	}
+
+	if err := os.Remove(usedPath(image)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove %s: %v", usedPath(image), err)
+	}
+
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return true, fmt.Errorf("failed to remove image '%s': %w", image, err)
+	}
+
+	return true, nil
+}
+
+// readCache returns extracted images sorted from least to most recently used.
+func readCache() ([]cachedImage, error) {
+	entries, err := os.ReadDir(rootfsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rootfs directory: %w", err)
+	}
+
+	inUse, err := mountedImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []cachedImage
+	for _, entry := range entries {
+		// Skip lock, digest and temporary entries
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(rootfsDir(), entry.Name())
+		size, err := diskUsage(path)
+		if err != nil {
+			return nil, err
+		}
+
+		images = append(images, cachedImage{
+			name:     entry.Name(),
+			size:     size,
+			lastUsed: lastUsed(entry.Name()),
+			inUse:    inUse[path],
+		})
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].lastUsed.Before(images[j].lastUsed)
+	})
+
+	return images, nil
+}
+
+// usedPath returns path of file whose modification time records last use of given image.
+func usedPath(image string) string {
+	return filepath.Join(rootfsDir(), "."+image+".used")
+}
+
+// touchImage records given image as used now.
+func touchImage(image string) error {
+	now := time.Now()
+	if err := os.Chtimes(usedPath(image), now, now); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.WriteFile(usedPath(image), nil, 0644)
+}
+
+// lastUsed returns when given image was last used, falling back to its extraction time.
+func lastUsed(image string) time.Time {
+	if fi, err := os.Stat(usedPath(image)); err == nil {
+		return fi.ModTime()
+	}
+
+	if fi, err := os.Stat(filepath.Join(rootfsDir(), image)); err == nil {
+		return fi.ModTime()
+	}
+
+	return time.Time{}
+}
+
+// diskUsage returns disk space used by files under path, counting hard links once.
+func diskUsage(path string) (int64, error) {
+	seen := make(map[uint64]bool)
+
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		st, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			size += fi.Size()
+			return nil
+		}
+
+		if st.Nlink > 1 && !fi.IsDir() {
+			if seen[st.Ino] {
+				return nil
+			}
+			seen[st.Ino] = true
+		}
+		size += st.Blocks * 512
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of %s: %w", path, err)
+	}
+
+	return size, nil
+}
+
+// mountedImages returns lower directories of overlay mounts on host.
+func mountedImages() (map[string]bool, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+	defer f.Close()
+
+	dirs := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Optional fields end with a "-" separator, followed by fstype, source and super options
+		_, after, ok := strings.Cut(scanner.Text(), " - ")
+		if !ok {
+			continue
+		}
+
+		fields := strings.Fields(after)
+		if len(fields) < 3 || fields[0] != "overlay" {
+			continue
+		}
+
+		for _, opt := range strings.Split(fields[2], ",") {
+			if lower, ok := strings.CutPrefix(opt, "lowerdir="); ok {
+				for _, dir := range strings.Split(lower, ":") {
+					dirs[dir] = true
+				}
+			}
+		}
+	}
+
+	return dirs, scanner.Err()
+}
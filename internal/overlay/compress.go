@@ -0,0 +1,61 @@
+package overlay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/lutaod/tinydock/internal/config"
+)
+
+// legacyExts are tarball extensions recognized in RegistryDir.
+var legacyExts = []string{".tar.gz", ".tar.zst"}
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// compressFlag returns tar flag compressing tarballs written to store with
+// compressor selected in config.
+//
+// Compression of tarballs is detected on extraction, so blobs written with
+// either compressor remain usable after changing it.
+func compressFlag() (string, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.Compression == config.CompressionZstd {
+		return "--zstd", nil
+	}
+	return "--gzip", nil
+}
+
+// legacyTarball returns path of tarball of image stored under key dropped into
+// RegistryDir, or an empty string if there is none.
+func legacyTarball(key string) string {
+	for _, ext := range legacyExts {
+		path := filepath.Join(RegistryDir(), key+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// isGzip reports whether file at path is gzip compressed.
+func isGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, len(gzipMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(magic, gzipMagic), nil
+}
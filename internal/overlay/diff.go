@@ -0,0 +1,327 @@
+package overlay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// DiffImages writes a gzipped layer tarball at output holding changes that turn
+// parent into image, in the format of incremental commits: added and modified
+// files along with their directories, and overlay whiteouts for removed ones.
+//
+// Files are compared by type, ownership, permissions, size, modification time
+// and link target, not by content.
+func DiffImages(ref, parentRef, output string) error {
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(imageDir(), ".diff-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imageRoot := filepath.Join(tmpDir, "image")
+	unmountImage, err := mountReadOnly(ref, imageRoot, tmpDir)
+	if err != nil {
+		return err
+	}
+	defer unmountImage()
+
+	parentRoot := filepath.Join(tmpDir, "parent")
+	unmountParent, err := mountReadOnly(parentRef, parentRoot, tmpDir)
+	if err != nil {
+		return err
+	}
+	defer unmountParent()
+
+	entries, err := diffTrees(imageRoot, parentRoot)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := output + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create diff tarball: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, e := range entries {
+		if e.whiteout {
+			err = writeWhiteout(tw, e.path)
+		} else {
+			err = addTreeEntry(tw, imageRoot, e.path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+	if err := os.Rename(tmpPath, output); err != nil {
+		return fmt.Errorf("failed to move diff tarball into place: %w", err)
+	}
+
+	return nil
+}
+
+// mountReadOnly mounts root filesystem of given image read-only at dir, and
+// returns a function unmounting it. Image layers are locked only until mounted,
+// as mounted ones are never evicted, and their use is recorded.
+func mountReadOnly(ref, dir, tmpDir string) (func(), error) {
+	key, err := imageKey(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := imageChain(key)
+	if err != nil {
+		return nil, err
+	}
+	layers, err := chainLayers(chain)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockChain(layers)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	lowerDir, err := extractChain(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range layers {
+		if err := touchImage(id); err != nil {
+			log.Printf("Failed to record image use: %v", err)
+		}
+	}
+
+	// Overlay without upper directory needs at least two lower ones
+	if len(layers) == 1 {
+		empty := filepath.Join(tmpDir, "empty")
+		if err := os.MkdirAll(empty, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create empty directory: %w", err)
+		}
+		lowerDir += ":" + empty
+	}
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create mount point: %w", err)
+	}
+	if err := syscall.Mount("overlay", dir, "overlay", syscall.MS_RDONLY, "lowerdir="+lowerDir); err != nil {
+		return nil, fmt.Errorf("failed to mount image '%s': %w", ref, err)
+	}
+
+	return func() {
+		if err := syscall.Unmount(dir, 0); err != nil {
+			log.Printf("Failed to unmount %s: %v", dir, err)
+		}
+	}, nil
+}
+
+// diffEntry is a path, relative to root, written into a diff tarball.
+type diffEntry struct {
+	path     string
+	whiteout bool
+}
+
+// diffTrees returns entries turning tree at parentRoot into tree at imageRoot,
+// sorted so that directories precede their contents.
+func diffTrees(imageRoot, parentRoot string) ([]diffEntry, error) {
+	included := make(map[string]bool)
+	include := func(rel string) {
+		for ; rel != "." && !included[rel]; rel = filepath.Dir(rel) {
+			included[rel] = true
+		}
+	}
+
+	err := filepath.WalkDir(imageRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(imageRoot, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		// A missing path, or one below a replaced directory, counts as changed
+		pfi, err := os.Lstat(filepath.Join(parentRoot, rel))
+		if err != nil || !sameFile(path, fi, filepath.Join(parentRoot, rel), pfi) {
+			include(rel)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare images: %w", err)
+	}
+
+	var whiteouts []string
+	err = filepath.WalkDir(parentRoot, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(parentRoot, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		fi, err := os.Lstat(filepath.Join(imageRoot, rel))
+		if os.IsNotExist(err) {
+			whiteouts = append(whiteouts, rel)
+			include(filepath.Dir(rel))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Contents of a directory replaced by a file are hidden already
+		if d.IsDir() && !fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare images: %w", err)
+	}
+
+	entries := make([]diffEntry, 0, len(included)+len(whiteouts))
+	for rel := range included {
+		entries = append(entries, diffEntry{path: rel})
+	}
+	for _, rel := range whiteouts {
+		entries = append(entries, diffEntry{path: rel, whiteout: true})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].path < entries[j].path
+	})
+
+	return entries, nil
+}
+
+// sameFile reports whether two files are considered unchanged.
+func sameFile(path string, fi fs.FileInfo, parentPath string, pfi fs.FileInfo) bool {
+	if fi.Mode() != pfi.Mode() {
+		return false
+	}
+
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	pst, pok := pfi.Sys().(*syscall.Stat_t)
+	if !ok || !pok || st.Uid != pst.Uid || st.Gid != pst.Gid || st.Rdev != pst.Rdev {
+		return false
+	}
+
+	// Directory size and time change with their entries, which are compared by themselves
+	if fi.IsDir() {
+		return true
+	}
+	if fi.Size() != pfi.Size() || !fi.ModTime().Equal(pfi.ModTime()) {
+		return false
+	}
+
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return false
+		}
+		parentTarget, err := os.Readlink(parentPath)
+		return err == nil && target == parentTarget
+	}
+
+	return true
+}
+
+// addTreeEntry adds file at rel under root to tarball, keeping numeric
+// ownership so it extracts alike on any host.
+func addTreeEntry(tw *tar.Writer, root, rel string) error {
+	path := filepath.Join(root, rel)
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", rel, err)
+	}
+
+	link := ""
+	if fi.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(path); err != nil {
+			return fmt.Errorf("failed to read link %s: %w", rel, err)
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return fmt.Errorf("failed to describe %s: %w", rel, err)
+	}
+	hdr.Name = "./" + filepath.ToSlash(rel)
+	if fi.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uname, hdr.Gname = "", ""
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", rel, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+
+	return nil
+}
+
+// writeWhiteout adds an overlay whiteout, a 0/0 character device, hiding rel
+// of lower layers.
+func writeWhiteout(tw *tar.Writer, rel string) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeChar,
+		Name:     "./" + filepath.ToSlash(rel),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write diff tarball: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package overlay
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/untar"
+)
+
+// zstdMagic starts every zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// extractTarball unpacks tarball at path into dir, keeping overlay whiteouts
+// and xattrs of layers as they are. Entries leading outside dir are refused.
+func extractTarball(path, dir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open tarball: %w", err)
+	}
+	defer f.Close()
+
+	r, wait, err := decompress(f)
+	if err != nil {
+		return err
+	}
+
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			wait()
+			return fmt.Errorf("failed to read tarball: %w", err)
+		}
+
+		target, err := untar.SecurePath(dir, hdr.Name)
+		if err != nil {
+			wait()
+			return err
+		}
+		if target == dir {
+			// Root entry only carries metadata of rootfs, set once extracted
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			wait()
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+
+		if err := untar.Entry(dir, target, hdr, tr); err != nil {
+			wait()
+			return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTime{target, hdr.ModTime})
+		}
+	}
+
+	if err := wait(); err != nil {
+		return err
+	}
+
+	// Directory times change as entries are created in them, restore them last
+	for _, d := range dirs {
+		os.Chtimes(d.path, d.mtime, d.mtime)
+	}
+
+	return nil
+}
+
+// decompress returns reader of tarball content of r, detecting gzip and zstd
+// compression, along with a function to call once done reading it.
+//
+// zstd streams are decompressed by zstd command, as standard library has no
+// decoder for them.
+func decompress(r io.Reader) (io.Reader, func() error, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress tarball: %w", err)
+		}
+		return gz, gz.Close, nil
+
+	case bytes.Equal(magic, zstdMagic):
+		var stderr strings.Builder
+		cmd := exec.Command("zstd", "-dc")
+		cmd.Stdin = br
+		cmd.Stderr = &stderr
+
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress tarball: %w", err)
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, nil, fmt.Errorf("failed to decompress tarball: %w", err)
+		}
+
+		wait := func() error {
+			// Drain output so zstd is not left blocked on a full pipe
+			io.Copy(io.Discard, out)
+			if err := cmd.Wait(); err != nil {
+				return fmt.Errorf("failed to decompress tarball: %s", strings.TrimSpace(stderr.String()))
+			}
+			return nil
+		}
+		return out, wait, nil
+
+	default:
+		return br, func() error { return nil }, nil
+	}
+}
@@ -0,0 +1,102 @@
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxPrintCreatedByLength bounds CREATED BY column of history unless not
+// truncated.
+const maxPrintCreatedByLength = 45
+
+// History records how a layer of an image was created.
+type History struct {
+	Created time.Time `json:"created"`
+
+	// CreatedBy is command that created layer, e.g. a build step.
+	CreatedBy string `json:"createdBy,omitempty"`
+
+	// Comment describes where layer came from, e.g. a registry reference.
+	Comment string `json:"comment,omitempty"`
+
+	// Digest is blob holding layer. It is empty for layers merged into a later
+	// one, e.g. upstream layers of pulled images, which are flattened.
+	Digest string `json:"digest,omitempty"`
+}
+
+// historyOf returns history of image stored under key, oldest layer first.
+//
+// Images stored before history was recorded, and tarballs dropped by hand,
+// are described by their blobs and the source they came from.
+func historyOf(key string) ([]History, error) {
+	meta, err := requireImage(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.History) > 0 {
+		return meta.History, nil
+	}
+
+	var history []History
+	if meta.stackedOnParent() {
+		parentKey, err := imageKey(meta.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("image '%s' has invalid parent: %w", imageRef(key), err)
+		}
+		if history, err = historyOf(parentKey); err != nil {
+			return nil, err
+		}
+	}
+	for _, digest := range slices.Backward(meta.Base) {
+		history = append(history, History{Digest: digest})
+	}
+
+	return append(history, History{
+		Created: meta.Created,
+		Comment: meta.Source,
+		Digest:  meta.Digest,
+	}), nil
+}
+
+// ImageHistory prints layers of given image, newest first, along with how
+// each of them was created.
+func ImageHistory(ref string, noTrunc bool) error {
+	key, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	history, err := historyOf(key)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-14s %-20s %-12s %-*s %s\n", "LAYER", "CREATED", "SIZE", maxPrintCreatedByLength, "CREATED BY", "COMMENT")
+
+	for _, h := range slices.Backward(history) {
+		layer, size := "<merged>", "-"
+		if h.Digest != "" {
+			layer = shortID(h.Digest)
+			if fi, err := os.Stat(blobPath(h.Digest)); err == nil {
+				size = fmt.Sprintf("%.2f MB", float64(fi.Size())/1024/1024)
+			}
+		}
+
+		created := "-"
+		if !h.Created.IsZero() {
+			created = h.Created.Format("2006-01-02 15:04:05")
+		}
+
+		createdBy := strings.Join(strings.Fields(h.CreatedBy), " ")
+		if !noTrunc && len(createdBy) > maxPrintCreatedByLength {
+			createdBy = createdBy[:maxPrintCreatedByLength-3] + "..."
+		}
+
+		fmt.Printf("%-14s %-20s %-12s %-*s %s\n", layer, created, size, maxPrintCreatedByLength, createdBy, h.Comment)
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// maxLayers bounds parent chain of an image, well below the number of lower
+// directories overlayfs accepts.
+const maxLayers = 64
+
+// imageChain returns storage names of image stored under key and its parents,
+// topmost first, as overlayfs expects lower directories.
+func imageChain(key string) ([]string, error) {
+	return walkChain(key, requireImage)
+}
+
+// walkChain is imageChain with reference records read by load.
+func walkChain(key string, load func(string) (*Metadata, error)) ([]string, error) {
+	chain := []string{key}
+	for {
+		meta, err := load(key)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil || !meta.stackedOnParent() {
+			return chain, nil
+		}
+
+		if key, err = imageKey(meta.Parent); err != nil {
+			return nil, fmt.Errorf("image '%s' has invalid parent: %w", imageRef(chain[0]), err)
+		}
+		for _, k := range chain {
+			if k == key {
+				return nil, fmt.Errorf("image '%s' has cyclic parents", imageRef(chain[0]))
+			}
+		}
+		if len(chain) == maxLayers {
+			return nil, fmt.Errorf("image '%s' has more than %d layers", imageRef(chain[0]), maxLayers)
+		}
+
+		chain = append(chain, key)
+	}
+}
+
+// chainLayers returns layer IDs of blobs of images in chain, in same order,
+// followed by those the bottom one is stacked on by content.
+func chainLayers(chain []string) ([]string, error) {
+	ids := make([]string, 0, len(chain))
+	for _, key := range chain {
+		meta, err := requireImage(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, digest := range meta.blobs() {
+			ids = append(ids, layerID(digest))
+		}
+	}
+
+	return ids, nil
+}
+
+// lockChain locks every layer of chain, returning a function releasing them all.
+//
+// Layers are always locked from top to bottom, so concurrent callers sharing
+// parents cannot deadlock. A layer appearing twice is locked once.
+func lockChain(ids []string) (func(), error) {
+	var unlocks []func()
+	unlockAll := func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+
+	locked := make(map[string]bool)
+	for _, id := range ids {
+		if locked[id] {
+			continue
+		}
+
+		unlock, err := lockImage(id)
+		if err != nil {
+			unlockAll()
+			return nil, err
+		}
+		unlocks = append(unlocks, unlock)
+		locked[id] = true
+	}
+
+	return unlockAll, nil
+}
+
+// extractChain extracts every layer of chain and returns their root filesystems
+// joined as overlay lowerdir. Caller must hold locks of all layers.
+func extractChain(ids []string) (string, error) {
+	dirs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		dir, err := extractImage(id)
+		if err != nil {
+			return "", err
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return strings.Join(dirs, ":"), nil
+}
+
+// childImages returns references of images stacked by name on image stored
+// under key.
+func childImages(key string) ([]string, error) {
+	keys, err := imageKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var children []string
+	for _, k := range keys {
+		meta, err := loadMetadata(k)
+		if err != nil || meta == nil || !meta.stackedOnParent() {
+			continue
+		}
+		if parent, err := imageKey(meta.Parent); err == nil && parent == key {
+			children = append(children, imageRef(k))
+		}
+	}
+
+	return children, nil
+}
+
+// checkReplaceable fails if images other than those stored under skip are
+// stacked by name on image stored under key, as replacing it would change
+// their content.
+func checkReplaceable(key string, skip ...string) error {
+	children, err := childImages(key)
+	if err != nil {
+		return err
+	}
+
+	children = slices.DeleteFunc(children, func(ref string) bool {
+		k, err := imageKey(ref)
+		return err == nil && slices.Contains(skip, k)
+	})
+	if len(children) > 0 {
+		return fmt.Errorf("image '%s' is parent of %s, remove them first", imageRef(key), strings.Join(children, ", "))
+	}
+
+	return nil
+}
+
+// containerBase returns digests of blobs whose extractions container's overlay
+// is mounted on, topmost first, as recorded when it was set up. It fails if
+// there are too many to stack another layer on, or a blob is gone.
+func containerBase(containerID string) ([]string, error) {
+	h, err := loadHolds()
+	if err != nil {
+		return nil, err
+	}
+
+	layers, ok := h[containerID]
+	if !ok {
+		return nil, fmt.Errorf("layers of container %s are not recorded", containerID)
+	}
+	if len(layers) >= maxLayers {
+		return nil, fmt.Errorf("container already runs on %d layers", len(layers))
+	}
+
+	base := make([]string, 0, len(layers))
+	for _, id := range layers {
+		digest := "sha256:" + id
+		if !validDigest(digest) {
+			return nil, fmt.Errorf("layer %s is not an image layer", id)
+		}
+		if _, err := os.Stat(blobPath(digest)); err != nil {
+			return nil, fmt.Errorf("blob of layer %s is gone", shortID(digest))
+		}
+		base = append(base, digest)
+	}
+
+	return base, nil
+}
@@ -0,0 +1,213 @@
+package overlay
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Metadata is reference record of an image: its content and how it was created.
+type Metadata struct {
+	// Digest is sha256 digest of image tarball in blob store, set by store.
+	Digest string `json:"digest"`
+
+	// Created is when image was pulled, committed or imported.
+	Created time.Time `json:"created"`
+
+	// Source is where image came from, e.g. a registry reference or a container.
+	Source string `json:"source,omitempty"`
+
+	// Parent is image this one was committed incrementally on. Blobs of parent
+	// are listed in Base, so it is only a record and may since name another
+	// image. Images committed before parents were recorded by content have no
+	// Base and are stacked on Parent by name.
+	Parent string `json:"parent,omitempty"`
+
+	// Base lists digests of blobs image is stacked on, topmost first, if it was
+	// committed from a container. They are referenced by content, so image does
+	// not depend on any other image.
+	Base []string `json:"base,omitempty"`
+
+	// Layers lists digests of layers image content was built from, bottom first.
+	Layers []string `json:"layers,omitempty"`
+
+	// Config holds defaults image was published with.
+	Config ImageConfig `json:"config"`
+
+	// History records how layers of image were created, oldest first.
+	History []History `json:"history,omitempty"`
+
+	// Provenance attests how image was committed or built, if recorded.
+	Provenance *Envelope `json:"provenance,omitempty"`
+}
+
+// ImageConfig holds default runtime settings of an image.
+type ImageConfig struct {
+	Env        []string `json:"env,omitempty"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Cmd        []string `json:"cmd,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+}
+
+// inspectInfo is the document printed by InspectImage.
+type inspectInfo struct {
+	Name       string          `json:"name"`
+	Tag        string          `json:"tag"`
+	Size       int64           `json:"size"`
+	Created    time.Time       `json:"created"`
+	Digest     string          `json:"digest"`
+	Source     string          `json:"source,omitempty"`
+	Parent     string          `json:"parent,omitempty"`
+	Base       []string        `json:"base,omitempty"`
+	Layers     []string        `json:"layers"`
+	Config     ImageConfig     `json:"config"`
+	History    []History       `json:"history,omitempty"`
+	Provenance *provenanceInfo `json:"provenance,omitempty"`
+}
+
+// InspectImage prints metadata of given image as JSON.
+//
+// Images without recorded layers, e.g. ones dropped into RegistryDir by hand,
+// are described by their tarball as only layer. With verifyKey given, whether
+// provenance of image is signed by it and attests to its digest is shown too.
+func InspectImage(ref string, verifyKey ed25519.PublicKey) error {
+	key, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	meta, err := requireImage(key)
+	if err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(blobPath(meta.Digest))
+	if err != nil {
+		return fmt.Errorf("blob of image '%s' missing: %w", ref, err)
+	}
+
+	if len(meta.Layers) == 0 {
+		meta.Layers = []string{meta.Digest}
+	}
+
+	var provenance *provenanceInfo
+	if meta.Provenance != nil {
+		if provenance, err = meta.Provenance.inspect(verifyKey, meta.Digest); err != nil {
+			return err
+		}
+	}
+
+	name, tag := splitKey(key)
+	data, err := json.MarshalIndent(inspectInfo{
+		Name:       name,
+		Tag:        tag,
+		Size:       fi.Size(),
+		Created:    meta.Created,
+		Digest:     meta.Digest,
+		Source:     meta.Source,
+		Parent:     meta.Parent,
+		Base:       meta.Base,
+		Layers:     meta.Layers,
+		Config:     meta.Config,
+		History:    meta.History,
+		Provenance: provenance,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal image metadata: %w", err)
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
+
+// ImageMetadata returns stored metadata of given image, or nil if there is no
+// such image.
+func ImageMetadata(ref string) (*Metadata, error) {
+	key, err := imageKey(ref)
+	if err != nil {
+		return nil, err
+	}
+	return lookupImage(key)
+}
+
+// SetImageConfig replaces default config of given image, leaving other images
+// tagged from it unchanged.
+func SetImageConfig(ref string, cfg ImageConfig) error {
+	key, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	meta, err := requireImage(key)
+	if err != nil {
+		return err
+	}
+	meta.Config = cfg
+
+	return saveMetadata(key, meta)
+}
+
+// metadataPath returns path of reference record of image stored under key.
+func metadataPath(key string) string {
+	return filepath.Join(refsDir(), key+".json")
+}
+
+// saveMetadata writes reference record of image stored under key.
+func saveMetadata(key string, meta *Metadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("failed to marshal image metadata: %w", err)
+	}
+
+	if err := os.MkdirAll(refsDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create reference directory: %w", err)
+	}
+
+	tmpPath := metadataPath(key) + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save image metadata: %w", err)
+	}
+	if err := os.Rename(tmpPath, metadataPath(key)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save image metadata: %w", err)
+	}
+
+	return nil
+}
+
+// loadMetadata reads reference record of image stored under key, returning
+// nil if there is none. Unlike lookupImage, store is left unchanged.
+func loadMetadata(key string) (*Metadata, error) {
+	meta, err := readMetadata(metadataPath(key))
+	if err != nil || meta == nil {
+		return meta, err
+	}
+	for _, digest := range meta.blobs() {
+		if !validDigest(digest) {
+			return nil, fmt.Errorf("image '%s' has invalid digest %q", imageRef(key), digest)
+		}
+	}
+
+	return meta, nil
+}
+
+// readMetadata reads metadata at path, returning nil if there is none.
+func readMetadata(path string) (*Metadata, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image metadata: %w", err)
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse image metadata: %w", err)
+	}
+
+	return &meta, nil
+}
@@ -0,0 +1,55 @@
+package overlay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// supportedMountOptions maps overlay mount options accepted from users to their
+// allowed values. Options with no values are flags without "=VALUE".
+var supportedMountOptions = map[string][]string{
+	"metacopy":     {"on", "off"},
+	"index":        {"on", "off"},
+	"redirect_dir": {"on", "off", "follow", "nofollow"},
+	"userxattr":    nil,
+	"volatile":     nil,
+}
+
+// MountOptions is a list of extra overlay mount options that implements flag.Value interface.
+type MountOptions []string
+
+func (o *MountOptions) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *MountOptions) Set(value string) error {
+	key, val, hasValue := strings.Cut(value, "=")
+
+	allowed, ok := supportedMountOptions[key]
+	if !ok {
+		return fmt.Errorf("unsupported storage option: %s", key)
+	}
+
+	switch {
+	case allowed == nil && hasValue:
+		return fmt.Errorf("storage option %s takes no value", key)
+	case allowed != nil && !hasValue:
+		return fmt.Errorf("storage option %s requires a value (one of %s)", key, strings.Join(allowed, ", "))
+	case allowed != nil && !contains(allowed, val):
+		return fmt.Errorf("invalid value for storage option %s: %s (expect one of %s)",
+			key, val, strings.Join(allowed, ", "))
+	}
+
+	*o = append(*o, value)
+	return nil
+}
+
+// contains reports whether s is in slice.
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
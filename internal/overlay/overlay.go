@@ -1,16 +1,23 @@
 package overlay
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"syscall"
+	"time"
 
-	"github.com/lutaod/tinydock/assets"
 	"github.com/lutaod/tinydock/internal/config"
+	"github.com/lutaod/tinydock/internal/inroot"
 	"github.com/lutaod/tinydock/internal/volume"
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -21,19 +28,40 @@ const (
 	merged = "merged"
 )
 
-var (
-	overlayDir  = filepath.Join(config.Root, "overlay")
-	imageDir    = filepath.Join(config.Root, "image")
-	RegistryDir = filepath.Join(imageDir, "registry")
-	rootfsDir   = filepath.Join(imageDir, "rootfs")
-)
+// Directories of container overlays and image store under root directory.
+func overlayDir() string { return filepath.Join(config.Root(), "overlay") }
+func imageDir() string   { return filepath.Join(config.Root(), "image") }
+func blobsDir() string   { return filepath.Join(imageDir(), "blobs", "sha256") }
+func refsDir() string    { return filepath.Join(imageDir(), "refs") }
+func rootfsDir() string  { return filepath.Join(imageDir(), "rootfs") }
+
+// RegistryDir returns where image tarballs can be dropped by hand, to be added
+// to store on first use.
+func RegistryDir() string {
+	return filepath.Join(imageDir(), "registry")
+}
 
 // Setup prepares overlay filesystem and mount volumes for a container.
-func Setup(image, containerID string, volumes volume.Volumes) (string, error) {
+//
+// Image and its parents, if it was committed incrementally, are stacked as
+// lower directories.
+//
+// mountOpts are appended to overlay mount options, and may be rejected by
+// kernels lacking support for them.
+//
+// Setup is transactional: if it fails midway, volumes mounted so far and the
+// overlay are unmounted, and volume targets it created are removed again, so no
+// busy mount is left behind to block later cleanup.
+func Setup(ref, containerID string, volumes volume.Volumes, mountOpts MountOptions) (_ string, err error) {
+	image, err := imageKey(ref)
+	if err != nil {
+		return "", err
+	}
+
 	paths := map[string]string{
-		upper:  filepath.Join(overlayDir, containerID, upper),
-		work:   filepath.Join(overlayDir, containerID, work),
-		merged: filepath.Join(overlayDir, containerID, merged),
+		upper:  filepath.Join(overlayDir(), containerID, upper),
+		work:   filepath.Join(overlayDir(), containerID, work),
+		merged: filepath.Join(overlayDir(), containerID, merged),
 	}
 
 	for _, dir := range paths {
@@ -42,77 +70,363 @@ func Setup(image, containerID string, volumes volume.Volumes) (string, error) {
 		}
 	}
 
-	lowerDir, err := extractImage(image)
+	chain, err := imageChain(image)
+	if err != nil {
+		return "", err
+	}
+	layers, err := chainLayers(chain)
 	if err != nil {
 		return "", err
 	}
 
-	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s",
-		lowerDir,
-		paths[upper],
-		paths[work],
-	)
+	// Hold image locks until mounted so cache eviction cannot remove lower directories
+	unlock, err := lockChain(layers)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	lowerDir, err := extractChain(layers)
+	if err != nil {
+		return "", err
+	}
 
+	opts := mountData(lowerDir, paths[upper], paths[work], mountOpts)
 	if err := syscall.Mount("overlay", paths[merged], "overlay", 0, opts); err != nil {
 		return "", fmt.Errorf("failed to mount overlayfs: %w", err)
 	}
 
-	for _, v := range volumes {
-		target := filepath.Join(paths[merged], v.Target)
-
-		// Create host source directory if does not exist
-		if _, err := os.Stat(v.Source); os.IsNotExist(err) {
-			if err := os.MkdirAll(v.Source, 0755); err != nil {
-				return "", fmt.Errorf("failed to create volume source %s: %w", v.Source, err)
+	// Undo steps in reverse order if a later one fails
+	var rollback []func() error
+	defer func() {
+		if err == nil {
+			return
+		}
+		for i := len(rollback) - 1; i >= 0; i-- {
+			if err := rollback[i](); err != nil {
+				log.Printf("Failed to roll back overlay setup: %v", err)
 			}
-		} else if err != nil {
-			return "", fmt.Errorf("failed to check volume source %s: %w", v.Source, err)
 		}
+	}()
+	rollback = append(rollback, func() error {
+		return syscall.Unmount(paths[merged], 0)
+	})
+
+	if err := hold(containerID, layers); err != nil {
+		return "", err
+	}
+	rollback = append(rollback, func() error {
+		return unhold(containerID)
+	})
 
-		if err := os.MkdirAll(target, 0755); err != nil {
-			return "", fmt.Errorf("failed to create volume target %s: %w", target, err)
+	for _, id := range layers {
+		if err := touchImage(id); err != nil {
+			log.Printf("Failed to record image use: %v", err)
 		}
+	}
+
+	if err := evictImages(); err != nil {
+		log.Printf("Failed to evict image cache: %v", err)
+	}
 
-		if err := syscall.Mount(v.Source, target, "", uintptr(syscall.MS_BIND), ""); err != nil {
-			return "", fmt.Errorf("failed to mount volume %s to %s: %w", v.Source, target, err)
+	for _, v := range volumes {
+		undo, err := mountVolume(paths[merged], v)
+		rollback = append(rollback, undo...)
+		if err != nil {
+			return "", err
 		}
 	}
 
 	return paths[merged], nil
 }
 
-// SaveImage creates a new tarball image from a container's merged directory.
-func SaveImage(containerID, imageName string) error {
-	tarballPath := filepath.Join(RegistryDir, imageName+".tar.gz")
-	if _, err := os.Stat(tarballPath); err == nil {
+// AddVolume mounts volume into overlay of a container that is already set up,
+// then calls attach to make it visible to running container. The volume is
+// unmounted again if attach fails.
+func AddVolume(containerID string, v volume.Volume, attach func() error) error {
+	undo, err := mountVolume(filepath.Join(overlayDir(), containerID, merged), v)
+	if err == nil {
+		err = attach()
+	}
+	if err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				log.Printf("Failed to roll back volume mount: %v", err)
+			}
+		}
+		return err
+	}
+
+	return nil
+}
+
+// mountVolume bind mounts source of volume onto its target in merged directory,
+// creating both if missing. It returns steps undoing what was done, also when
+// failing midway.
+func mountVolume(mergedPath string, v volume.Volume) ([]func() error, error) {
+	var undo []func() error
+
+	// Create host source directory if does not exist
+	if _, err := os.Stat(v.Source); os.IsNotExist(err) {
+		if err := os.MkdirAll(v.Source, 0755); err != nil {
+			return undo, fmt.Errorf("failed to create volume source %s: %w", v.Source, err)
+		}
+	} else if err != nil {
+		return undo, fmt.Errorf("failed to check volume source %s: %w", v.Source, err)
+	}
+
+	// Target is resolved within merged directory, so symlinks of image
+	// cannot redirect the mount to host
+	target, created, err := inroot.MkdirAll(mergedPath, v.Target, 0755)
+	if err != nil {
+		return undo, fmt.Errorf("failed to create volume target %s: %w", v.Target, err)
+	}
+
+	// Only remove what was created here, removing a directory that exists in
+	// lower layer would leave a whiteout in container's writable layer
+	if created != "" {
+		undo = append(undo, func() error {
+			return os.RemoveAll(created)
+		})
+	}
+
+	if err := syscall.Mount(v.Source, target, "", uintptr(syscall.MS_BIND), ""); err != nil {
+		return undo, fmt.Errorf("failed to mount volume %s to %s: %w", v.Source, target, err)
+	}
+	undo = append(undo, func() error {
+		return syscall.Unmount(target, unix.UMOUNT_NOFOLLOW)
+	})
+
+	return undo, nil
+}
+
+// mountData builds overlay mount options from layer directories and extra options.
+func mountData(lowerDir, upperDir, workDir string, mountOpts MountOptions) string {
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", lowerDir, upperDir, workDir)
+	for _, o := range mountOpts {
+		opts += "," + o
+	}
+	return opts
+}
+
+// UpperDir returns path of writable layer of a container.
+func UpperDir(containerID string) string {
+	return filepath.Join(overlayDir(), containerID, upper)
+}
+
+// MergedDir returns path where filesystem of a container is mounted.
+func MergedDir(containerID string) string {
+	return filepath.Join(overlayDir(), containerID, merged)
+}
+
+// Mounted reports whether overlay of a container is mounted, which it no longer
+// is after host reboots.
+func Mounted(containerID string) bool {
+	var st, parent syscall.Stat_t
+	if syscall.Stat(MergedDir(containerID), &st) != nil ||
+		syscall.Stat(filepath.Join(overlayDir(), containerID), &parent) != nil {
+		return false
+	}
+	return st.Dev != parent.Dev
+}
+
+// Layout describes directories overlay filesystem of a container is made of.
+type Layout struct {
+	LowerDirs []string `json:"lowerDirs"`
+	UpperDir  string   `json:"upperDir"`
+	WorkDir   string   `json:"workDir"`
+	MergedDir string   `json:"mergedDir"`
+}
+
+// ContainerLayout returns directories overlay of a container is made of, lower
+// ones topmost first as recorded when it was mounted.
+func ContainerLayout(containerID string) (Layout, error) {
+	h, err := loadHolds()
+	if err != nil {
+		return Layout{}, err
+	}
+
+	layout := Layout{
+		UpperDir:  UpperDir(containerID),
+		WorkDir:   filepath.Join(overlayDir(), containerID, work),
+		MergedDir: MergedDir(containerID),
+	}
+	for _, id := range h[containerID] {
+		layout.LowerDirs = append(layout.LowerDirs, filepath.Join(rootfsDir(), id))
+	}
+
+	return layout, nil
+}
+
+// MountReadOnly mounts a read-only view of filesystem of a container whose
+// overlay is not mounted at target, with its writable layer stacked on layers
+// recorded when it was last mounted. It returns a function unmounting it.
+func MountReadOnly(containerID, target string) (func() error, error) {
+	layout, err := ContainerLayout(containerID)
+	if err != nil {
+		return nil, err
+	}
+	if len(layout.LowerDirs) == 0 {
+		return nil, fmt.Errorf("image layers of container %s are unknown", containerID)
+	}
+
+	// Upper directory of container is just topmost layer of view
+	lowerDir := strings.Join(append([]string{layout.UpperDir}, layout.LowerDirs...), ":")
+	if err := syscall.Mount("overlay", target, "overlay", syscall.MS_RDONLY, "lowerdir="+lowerDir); err != nil {
+		return nil, fmt.Errorf("failed to mount overlayfs: %w", err)
+	}
+
+	return func() error {
+		return syscall.Unmount(target, 0)
+	}, nil
+}
+
+// SaveImage creates a new tarball image from a container's filesystem.
+//
+// New image inherits default config and history of parent image container was
+// created from, with createdBy recorded as command that created its own layer.
+// An incremental image holds only container's writable layer and is stacked on
+// parent image when used. Otherwise it holds the writable layer too, stacked on
+// blobs container runs on by content, so derived images share their layers;
+// merged filesystem is flattened into it only if those cannot be determined or
+// are too many.
+func SaveImage(containerID, imageName, parent, createdBy string, incremental bool) error {
+	key, err := imageKey(imageName)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := lookupImage(key); err != nil {
+		return err
+	} else if existing != nil {
 		return fmt.Errorf("image '%s' already exists", imageName)
 	}
 
-	mergedPath := filepath.Join(overlayDir, containerID, merged)
-	if _, err := os.Stat(mergedPath); err != nil {
+	parentKey, err := imageKey(parent)
+	if err != nil {
+		return err
+	}
+	parentMeta, err := lookupImage(parentKey)
+	if err != nil {
+		return err
+	}
+
+	srcPath := filepath.Join(overlayDir(), containerID, merged)
+	var base []string
+	if incremental {
+		if parentMeta == nil {
+			return fmt.Errorf("image '%s' not found", parent)
+		}
+		chain, err := imageChain(parentKey)
+		if err != nil {
+			return err
+		}
+		layers, err := chainLayers(chain)
+		if err != nil {
+			return err
+		}
+		if len(layers) >= maxLayers {
+			return fmt.Errorf("image '%s' already has %d layers", parent, len(layers))
+		}
+
+		// Parent is stacked on by content, so tagging another image with its
+		// name later leaves this one unchanged
+		for _, id := range layers {
+			base = append(base, "sha256:"+id)
+		}
+		srcPath = filepath.Join(overlayDir(), containerID, upper)
+	} else {
+		if base, err = containerBase(containerID); err != nil {
+			log.Printf("Storing full copy of container filesystem: %v", err)
+		} else {
+			srcPath = filepath.Join(overlayDir(), containerID, upper)
+		}
+	}
+
+	if _, err := os.Stat(srcPath); err != nil {
 		return fmt.Errorf("container filesystem not found: %w", err)
 	}
 
-	if err := os.MkdirAll(filepath.Dir(tarballPath), 0755); err != nil {
-		return fmt.Errorf("failed to create tarball directory: %w", err)
+	compress, err := compressFlag()
+	if err != nil {
+		return err
+	}
+
+	f, err := newBlobFile()
+	if err != nil {
+		return err
 	}
+	f.Close()
+	defer os.Remove(f.Name())
 
-	cmd := exec.Command("tar", "czf", tarballPath, "-C", mergedPath, ".")
+	// Keep overlay xattrs so opaque directories of a writable layer stay opaque
+	cmd := exec.Command("tar", "cf", f.Name(), compress,
+		"--xattrs", "--xattrs-include=trusted.overlay.*",
+		"-C", srcPath, ".",
+	)
 	if out, err := cmd.CombinedOutput(); err != nil {
-		os.Remove(tarballPath)
 		return fmt.Errorf("failed to create image tarball: %s", out)
 	}
 
-	return nil
+	digest, err := putBlob(f.Name())
+	if err != nil {
+		return err
+	}
+
+	meta := &Metadata{
+		Digest:  digest,
+		Created: time.Now(),
+		Source:  fmt.Sprintf("container %s from %s", containerID, parent),
+		Layers:  []string{digest},
+		Base:    base,
+	}
+	if len(base) > 0 {
+		meta.Layers = append(slices.Clone(base), digest)
+		slices.Reverse(meta.Layers[:len(base)])
+	}
+	if parentMeta != nil {
+		meta.Config = parentMeta.Config
+
+		if meta.History, err = historyOf(parentKey); err != nil {
+			return err
+		}
+		meta.History = slices.Clone(meta.History)
+
+		// Layers of a flattened copy are merged into its blob
+		if !incremental && len(base) == 0 {
+			for i := range meta.History {
+				meta.History[i].Digest = ""
+			}
+		}
+	}
+	meta.History = append(meta.History, History{
+		Created:   meta.Created,
+		CreatedBy: createdBy,
+		Comment:   meta.Source,
+		Digest:    digest,
+	})
+	if incremental {
+		meta.Parent = imageRef(parentKey)
+		if len(parentMeta.Layers) > 0 {
+			meta.Layers = append(parentMeta.Layers, digest)
+		} else {
+			meta.Layers = []string{parentMeta.Digest, digest}
+		}
+	}
+
+	return saveMetadata(key, meta)
 }
 
 // Cleanup unmounts any volumes and removes all overlay filesystem resources for a container.
 func Cleanup(containerID string, volumes volume.Volumes) error {
-	mergedPath := filepath.Join(overlayDir, containerID, merged)
+	mergedPath := filepath.Join(overlayDir(), containerID, merged)
 
 	for _, v := range volumes {
-		target := filepath.Join(mergedPath, v.Target)
-		if err := syscall.Unmount(target, 0); err != nil {
+		target, err := inroot.Resolve(mergedPath, v.Target)
+		if err != nil {
+			return fmt.Errorf("failed to find volume %s: %w", v.Target, err)
+		}
+		if err := syscall.Unmount(target, unix.UMOUNT_NOFOLLOW); err != nil {
 			return fmt.Errorf("failed to unmount volume %s: %w", target, err)
 		}
 	}
@@ -121,68 +435,202 @@ func Cleanup(containerID string, volumes volume.Volumes) error {
 		return fmt.Errorf("failed to unmount overlayfs: %w", err)
 	}
 
-	containerDir := filepath.Join(overlayDir, containerID)
+	containerDir := filepath.Join(overlayDir(), containerID)
 	if err := os.RemoveAll(containerDir); err != nil {
 		return fmt.Errorf("failed to remove overlay directory: %w", err)
 	}
 
-	return nil
+	return unhold(containerID)
 }
 
-// extractImage extracts the specified image tarball if not already extracted.
-//
-// The function manages two directories:
-//   - registry/: stores compressed images (.tar.gz).
-//     Custom images and committed images should be placed here.
-//   - rootfs/: stores uncompressed filesystems to be used as lower directories for overlayfs.
+// extractImage extracts blob of given layer ID if not already extracted, and
+// returns path of extracted tree under rootfs/, used as overlay lower directory.
 //
-// If base image tarball is missing, it will be copied from project assets.
-func extractImage(image string) (string, error) {
-	registryPath := filepath.Join(RegistryDir, image+".tar.gz")
-	rootfsPath := filepath.Join(rootfsDir, image)
+// Caller must hold the image lock. The tarball is extracted into a temporary
+// directory that is renamed into place only on success, so a half-extracted
+// rootfs is never visible. Images evicted from cache are re-extracted here.
+func extractImage(id string) (string, error) {
+	tarballPath := blobPath(id)
+	rootfsPath := filepath.Join(rootfsDir(), id)
 
 	// Check if already extracted
 	if _, err := os.Stat(rootfsPath); err == nil {
 		return rootfsPath, nil
 	}
 
-	// Check if tarball exists, base image can be copied from embedded assets if not
-	if _, err := os.Stat(registryPath); err != nil {
-		if image == baseImage {
-			src, err := assets.Files.Open(baseImage + ".tar.gz")
-			if err != nil {
-				return "", fmt.Errorf("failed to open embedded tarball file: %w", err)
-			}
-			defer src.Close()
-
-			if err := os.MkdirAll(filepath.Dir(registryPath), 0755); err != nil {
-				return "", fmt.Errorf("failed to create tarball directory: %w", err)
-			}
-
-			dst, err := os.Create(registryPath)
-			if err != nil {
-				return "", fmt.Errorf("failed to create tarball file: %w", err)
-			}
-			defer dst.Close()
-
-			if _, err := io.Copy(dst, src); err != nil {
-				return "", fmt.Errorf("failed to write tarball file: %w", err)
-			}
-		} else {
-			return "", fmt.Errorf("image '%s' not found", image)
-		}
+	if _, err := os.Stat(tarballPath); err != nil {
+		return "", fmt.Errorf("blob %s not found in store", shortID(id))
 	}
 
-	// Extract tarball
-	if err := os.MkdirAll(rootfsPath, 0755); err != nil {
+	// Extract tarball into temporary directory next to final location
+	tmpPath, err := os.MkdirTemp(rootfsDir(), "."+id+"-")
+	if err != nil {
 		return "", fmt.Errorf("failed to create extracted directory: %w", err)
 	}
 
-	cmd := exec.Command("tar", "xzf", registryPath, "-C", rootfsPath)
-	if err := cmd.Run(); err != nil {
-		os.RemoveAll(rootfsPath)
+	if err := extractTarball(tarballPath, tmpPath); err != nil {
+		os.RemoveAll(tmpPath)
 		return "", fmt.Errorf("failed to extract image: %w", err)
 	}
 
+	// MkdirTemp creates directory with 0700, restore usual permission for rootfs
+	if err := os.Chmod(tmpPath, 0755); err != nil {
+		os.RemoveAll(tmpPath)
+		return "", fmt.Errorf("failed to set extracted directory permission: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, rootfsPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return "", fmt.Errorf("failed to move extracted image into place: %w", err)
+	}
+
 	return rootfsPath, nil
 }
+
+// ImageDigest returns digest of given image's tarball, identifying its content.
+func ImageDigest(ref string) (string, error) {
+	key, err := imageKey(ref)
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := requireImage(key)
+	if err != nil {
+		return "", err
+	}
+
+	return meta.Digest, nil
+}
+
+// fileDigest computes sha256 digest of file at given path in "sha256:<hex>" form.
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to compute digest of %s: %w", path, err)
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// lockImage takes an exclusive lock on given layer ID and returns a function releasing it.
+//
+// The lock is held on a file under rootfs/ through flock, so it is released by the
+// kernel even if the process dies while holding it.
+func lockImage(image string) (func(), error) {
+	return flockImage(image, syscall.LOCK_EX)
+}
+
+// tryLockImage is like lockImage but fails with syscall.EWOULDBLOCK instead of
+// waiting if image is locked by another process.
+func tryLockImage(image string) (func(), error) {
+	return flockImage(image, syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// flockImage takes a lock on given image with given flock operation.
+func flockImage(image string, how int) (func(), error) {
+	if err := os.MkdirAll(rootfsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rootfs directory: %w", err)
+	}
+
+	lockPath := filepath.Join(rootfsDir(), "."+image+".lock")
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image lock: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock image '%s': %w", image, err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// ImportImage creates or replaces image with given name from a root filesystem
+// populated by fill in a temporary directory.
+//
+// Content of a replaced image is dropped once no other image refers to it,
+// unless containers still use it. meta is stored along with image, with
+// creation time set to now. History of meta, if any, describes layers merged
+// into rootfs, and is completed with an entry of the flattened blob.
+func ImportImage(ref string, meta Metadata, fill func(rootfs string) error) error {
+	name, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+	if err := checkReplaceable(name); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(imageDir(), ".import-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	rootfs := filepath.Join(tmpDir, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+
+	if err := fill(rootfs); err != nil {
+		return err
+	}
+
+	compress, err := compressFlag()
+	if err != nil {
+		return err
+	}
+
+	tmpTarball := filepath.Join(tmpDir, "image.tar")
+	cmd := exec.Command("tar", "cf", tmpTarball, compress, "-C", rootfs, ".")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create image tarball: %s", out)
+	}
+
+	old, err := loadMetadata(name)
+	if err != nil {
+		return err
+	}
+
+	if meta.Digest, err = putBlob(tmpTarball); err != nil {
+		return err
+	}
+	meta.Created = time.Now()
+	meta.History = append(slices.Clone(meta.History), History{
+		Created: meta.Created,
+		Comment: meta.Source,
+		Digest:  meta.Digest,
+	})
+	if err := saveMetadata(name, &meta); err != nil {
+		return err
+	}
+
+	return releaseBlobs(old, &meta)
+}
+
+// validImageName reports whether name can be used as a local image name.
+func validImageName(name string) bool {
+	if name == "" || name[0] == '.' || name[0] == '-' {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
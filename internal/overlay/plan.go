@@ -0,0 +1,76 @@
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/volume"
+)
+
+// Plan describes steps Setup would take for a container, without changing
+// anything.
+func Plan(ref, containerID string, volumes volume.Volumes, mountOpts MountOptions) ([]string, error) {
+	image, err := imageKey(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(overlayDir(), containerID)
+	upperDir, workDir, mergedDir := filepath.Join(dir, upper), filepath.Join(dir, work), filepath.Join(dir, merged)
+
+	steps := []string{fmt.Sprintf("mkdir %s %s %s", upperDir, workDir, mergedDir)}
+
+	chain, err := walkChain(image, peekImage)
+	if err != nil {
+		return nil, err
+	}
+
+	lowerDirs := make([]string, 0, len(chain))
+	for _, key := range chain {
+		meta, err := peekImage(key)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			return nil, fmt.Errorf("image '%s' not found", imageRef(key))
+		}
+
+		// Images not in store yet are added from a dropped tarball or assets first
+		digest := meta.Digest
+		if digest == "" {
+			if legacyPath := legacyTarball(key); legacyPath != "" {
+				if digest, err = fileDigest(legacyPath); err != nil {
+					return nil, err
+				}
+				steps = append(steps, fmt.Sprintf("move %s to %s", legacyPath, blobPath(digest)))
+			} else {
+				if digest, err = embeddedDigest(); err != nil {
+					return nil, err
+				}
+				steps = append(steps, fmt.Sprintf("copy embedded %s tarball to %s", baseImage, blobPath(digest)))
+			}
+		}
+
+		for _, digest := range append([]string{digest}, meta.Base...) {
+			rootfsPath := filepath.Join(rootfsDir(), layerID(digest))
+			if _, err := os.Stat(rootfsPath); err != nil {
+				steps = append(steps, fmt.Sprintf("extract %s to %s", blobPath(digest), rootfsPath))
+			}
+			lowerDirs = append(lowerDirs, rootfsPath)
+		}
+	}
+
+	steps = append(steps, fmt.Sprintf("mount -t overlay overlay -o %s %s",
+		mountData(strings.Join(lowerDirs, ":"), upperDir, workDir, mountOpts), mergedDir))
+
+	for _, v := range volumes {
+		if _, err := os.Stat(v.Source); os.IsNotExist(err) {
+			steps = append(steps, fmt.Sprintf("mkdir %s", v.Source))
+		}
+		steps = append(steps, fmt.Sprintf("mount --bind %s %s", v.Source, filepath.Join(mergedDir, v.Target)))
+	}
+
+	return steps, nil
+}
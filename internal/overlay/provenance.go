@@ -0,0 +1,300 @@
+package overlay
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Identifiers of provenance documents, following in-toto attestation framework
+// and SLSA provenance.
+const (
+	statementType   = "https://in-toto.io/Statement/v1"
+	provenanceType  = "https://slsa.dev/provenance/v1"
+	envelopeType    = "application/vnd.in-toto+json"
+	builderID       = "https://github.com/lutaod/tinydock"
+	commitBuildType = builderID + "/commit@v1"
+	fileBuildType   = builderID + "/build@v1"
+)
+
+// Statement is an in-toto statement attesting how an image was produced.
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Predicate            `json:"predicate"`
+}
+
+// ResourceDescriptor identifies an artifact by content.
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate is SLSA provenance of an image.
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition describes inputs an image was produced from.
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   Parameters           `json:"externalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// Parameters describe how an image was produced, by commit of a container or
+// by a build file.
+type Parameters struct {
+	// Image is image container was created from, or FROM image of build.
+	Image string `json:"image"`
+
+	// Container and Command are container committed and its command.
+	Container string   `json:"container,omitempty"`
+	Command   []string `json:"command,omitempty"`
+
+	// BuildFile and Steps are build file image was built from and its steps.
+	BuildFile string   `json:"buildFile,omitempty"`
+	Steps     []string `json:"steps,omitempty"`
+
+	// History lists commands that created layers of image, oldest first.
+	History []string `json:"history,omitempty"`
+}
+
+// RunDetails describes who produced an image and when.
+type RunDetails struct {
+	Builder  Builder     `json:"builder"`
+	Metadata RunMetadata `json:"metadata"`
+}
+
+// Builder identifies tool that produced an image.
+type Builder struct {
+	ID string `json:"id"`
+}
+
+// RunMetadata records when an image was produced.
+type RunMetadata struct {
+	InvocationID string    `json:"invocationId,omitempty"`
+	StartedOn    time.Time `json:"startedOn"`
+	FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// Envelope is a DSSE envelope carrying a statement, with signatures over it if
+// image was signed.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures,omitempty"`
+}
+
+// Signature is an ed25519 signature of an envelope by key with given ID.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   []byte `json:"sig"`
+}
+
+// provenanceInfo is provenance of an image as printed by InspectImage.
+type provenanceInfo struct {
+	Statement Statement `json:"statement"`
+	SignedBy  []string  `json:"signedBy,omitempty"`
+	Verified  *bool     `json:"verified,omitempty"`
+}
+
+// AttestImage records provenance of given image, produced from params since
+// started, and signs it with signKey unless nil. Any provenance recorded before,
+// e.g. of an image tagged from, is replaced.
+func AttestImage(ref string, params Parameters, started time.Time, signKey ed25519.PrivateKey) error {
+	key, err := imageKey(ref)
+	if err != nil {
+		return err
+	}
+
+	meta, err := requireImage(key)
+	if err != nil {
+		return err
+	}
+
+	buildType := commitBuildType
+	if params.BuildFile != "" {
+		buildType = fileBuildType
+	}
+
+	history, err := historyOf(key)
+	if err != nil {
+		return err
+	}
+	for _, h := range history {
+		if h.CreatedBy != "" {
+			params.History = append(params.History, h.CreatedBy)
+		}
+	}
+
+	// Layers image is stacked on are its inputs, its own blob is its output
+	var deps []ResourceDescriptor
+	for _, digest := range meta.Layers {
+		if digest != meta.Digest {
+			deps = append(deps, descriptor("", digest))
+		}
+	}
+
+	statement := Statement{
+		Type:          statementType,
+		Subject:       []ResourceDescriptor{descriptor(imageRef(key), meta.Digest)},
+		PredicateType: provenanceType,
+		Predicate: Predicate{
+			BuildDefinition: BuildDefinition{
+				BuildType:            buildType,
+				ExternalParameters:   params,
+				ResolvedDependencies: deps,
+			},
+			RunDetails: RunDetails{
+				Builder: Builder{ID: builderID},
+				Metadata: RunMetadata{
+					InvocationID: params.Container,
+					StartedOn:    started.UTC(),
+					FinishedOn:   time.Now().UTC(),
+				},
+			},
+		},
+	}
+
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provenance: %w", err)
+	}
+
+	envelope := &Envelope{PayloadType: envelopeType, Payload: payload}
+	if signKey != nil {
+		envelope.Signatures = []Signature{{
+			KeyID: keyID(signKey.Public().(ed25519.PublicKey)),
+			Sig:   ed25519.Sign(signKey, pae(envelopeType, payload)),
+		}}
+	}
+	meta.Provenance = envelope
+
+	return saveMetadata(key, meta)
+}
+
+// inspect decodes statement of envelope and, with key given, reports whether
+// it carries a valid signature by that key over an in-toto statement about
+// blob of given digest. A signed envelope copied from another image is thus
+// not verified.
+func (e *Envelope) inspect(key ed25519.PublicKey, digest string) (*provenanceInfo, error) {
+	var info provenanceInfo
+	if err := json.Unmarshal(e.Payload, &info.Statement); err != nil {
+		return nil, fmt.Errorf("failed to parse provenance: %w", err)
+	}
+
+	for _, s := range e.Signatures {
+		info.SignedBy = append(info.SignedBy, s.KeyID)
+	}
+
+	if key != nil {
+		verified := false
+		if e.PayloadType != envelopeType || info.Statement.Type != statementType || !info.Statement.describes(digest) {
+			info.Verified = &verified
+			return &info, nil
+		}
+		for _, s := range e.Signatures {
+			if s.KeyID == keyID(key) && ed25519.Verify(key, pae(e.PayloadType, e.Payload), s.Sig) {
+				verified = true
+			}
+		}
+		info.Verified = &verified
+	}
+
+	return &info, nil
+}
+
+// describes reports whether statement has blob of given digest as a subject.
+func (s *Statement) describes(digest string) bool {
+	alg, hash, _ := strings.Cut(digest, ":")
+	for _, subject := range s.Subject {
+		if hash != "" && subject.Digest[alg] == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptor describes blob of given digest, e.g. "sha256:<hex>".
+func descriptor(name, digest string) ResourceDescriptor {
+	alg, hash, _ := strings.Cut(digest, ":")
+	return ResourceDescriptor{Name: name, Digest: map[string]string{alg: hash}}
+}
+
+// pae returns DSSE pre-authentication encoding of payload, the bytes signed.
+func pae(payloadType string, payload []byte) []byte {
+	return fmt.Appendf(nil, "DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload)
+}
+
+// keyID identifies a public key by hex encoded sha256 digest of it.
+func keyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadSigningKey reads a PEM encoded PKCS #8 ed25519 private key, such as one
+// generated by `openssl genpkey -algorithm ed25519`.
+func LoadSigningKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key is not an ed25519 key")
+	}
+
+	return priv, nil
+}
+
+// LoadVerifyKey reads a PEM encoded PKIX ed25519 public key, such as one
+// derived by `openssl pkey -pubout`.
+func LoadVerifyKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ed25519 key")
+	}
+
+	return pub, nil
+}
+
+// readPEM reads first PEM block of file at path.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	return block, nil
+}
@@ -0,0 +1,183 @@
+package overlay
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// holdsPath returns path of file recording layers overlay of each container
+// is mounted on, so references of containers to layers are counted without
+// scanning containers.
+func holdsPath() string {
+	return filepath.Join(imageDir(), "holds.json")
+}
+
+// holds maps container IDs to IDs of layers their overlay is mounted on,
+// topmost first. A layer is held as long as any container lists it.
+type holds map[string][]string
+
+// holders returns IDs of containers holding given layer.
+func (h holds) holders(layer string) []string {
+	var ids []string
+	for id, layers := range h {
+		for _, l := range layers {
+			if l == layer {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// count returns number of containers holding given layer.
+func (h holds) count(layer string) int {
+	return len(h.holders(layer))
+}
+
+// hold records that overlay of container is mounted on given layers.
+func hold(containerID string, layers []string) error {
+	return updateHolds(func(h holds) {
+		h[containerID] = layers
+	})
+}
+
+// unhold drops layers held by container.
+func unhold(containerID string) error {
+	return updateHolds(func(h holds) {
+		delete(h, containerID)
+	})
+}
+
+// updateHolds applies fn to recorded holds under an exclusive lock.
+func updateHolds(fn func(holds)) error {
+	unlock, err := lockHolds(syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	h, err := readHolds()
+	if err != nil {
+		return err
+	}
+	fn(h)
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		return fmt.Errorf("failed to marshal layer holds: %w", err)
+	}
+
+	tmpPath := holdsPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to save layer holds: %w", err)
+	}
+	if err := os.Rename(tmpPath, holdsPath()); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to save layer holds: %w", err)
+	}
+
+	return nil
+}
+
+// loadHolds returns layers held by containers.
+func loadHolds() (holds, error) {
+	unlock, err := lockHolds(syscall.LOCK_SH)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	return readHolds()
+}
+
+// readHolds reads recorded holds. Caller must hold the holds lock.
+//
+// Holds of containers set up before they were recorded are read from their
+// mounts on first use.
+func readHolds() (holds, error) {
+	data, err := os.ReadFile(holdsPath())
+	if os.IsNotExist(err) {
+		return scanHolds()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layer holds: %w", err)
+	}
+
+	h := make(holds)
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("failed to parse layer holds: %w", err)
+	}
+	return h, nil
+}
+
+// scanHolds returns layers container overlays are mounted on, as read from
+// their mount options.
+func scanHolds() (holds, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+	defer f.Close()
+
+	h := make(holds)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// Mount point is fifth field, mount options follow fstype and source
+		before, after, ok := strings.Cut(scanner.Text(), " - ")
+		fields, opts := strings.Fields(before), strings.Fields(after)
+		if !ok || len(fields) < 5 || len(opts) < 3 || opts[0] != "overlay" {
+			continue
+		}
+
+		containerDir, name := filepath.Split(fields[4])
+		if name != merged || filepath.Dir(containerDir) != overlayDir() {
+			continue
+		}
+		containerID := filepath.Base(containerDir)
+
+		for _, opt := range strings.Split(opts[2], ",") {
+			lower, ok := strings.CutPrefix(opt, "lowerdir=")
+			if !ok {
+				continue
+			}
+			for _, dir := range strings.Split(lower, ":") {
+				if filepath.Dir(dir) == rootfsDir() {
+					h[containerID] = append(h[containerID], filepath.Base(dir))
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read mountinfo: %w", err)
+	}
+
+	return h, nil
+}
+
+// lockHolds takes a lock on recorded holds with given flock operation.
+func lockHolds(how int) (func(), error) {
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	f, err := os.OpenFile(holdsPath()+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open layer holds lock: %w", err)
+	}
+
+	if err := syscall.Flock(int(f.Fd()), how); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock layer holds: %w", err)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,387 @@
+package overlay
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/lutaod/tinydock/assets"
+)
+
+// Images are stored by content: each tarball is a blob named after its sha256
+// digest, and references map NAME[:TAG] to a blob along with image metadata.
+//
+//   - blobs/sha256/<hex>: gzip or zstd compressed image tarballs.
+//   - refs/<key>.json: reference records, see Metadata.
+//   - rootfs/<hex>: extracted blobs used as overlay lower directories.
+//
+// Images sharing content, e.g. tags of one image, share one blob and one
+// extraction. Tarballs dropped into RegistryDir are moved into the store on
+// first use.
+
+// layerID returns name under which blob of given digest is stored and extracted.
+// The algorithm prefix is dropped, as ':' would split overlay lower directories.
+func layerID(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")
+}
+
+// blobPath returns path of blob of given digest.
+func blobPath(digest string) string {
+	return filepath.Join(blobsDir(), layerID(digest))
+}
+
+// validDigest reports whether digest is a well-formed sha256 digest.
+func validDigest(digest string) bool {
+	sum, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok || len(sum) != 64 {
+		return false
+	}
+	for _, c := range sum {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// putBlob moves file at path into blob store and returns its digest. If store
+// already holds same content, file is removed instead.
+func putBlob(path string) (string, error) {
+	digest, err := fileDigest(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(blobsDir(), 0755); err != nil {
+		return "", fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	if _, err := os.Stat(blobPath(digest)); err == nil {
+		os.Remove(path)
+		return digest, nil
+	}
+
+	if err := os.Rename(path, blobPath(digest)); err != nil {
+		return "", fmt.Errorf("failed to move blob into store: %w", err)
+	}
+
+	return digest, nil
+}
+
+// newBlobFile creates a temporary file in blob store, so it can be renamed
+// into place by putBlob.
+func newBlobFile() (*os.File, error) {
+	if err := os.MkdirAll(blobsDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(blobsDir(), ".tmp-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob file: %w", err)
+	}
+
+	return f, nil
+}
+
+// lookupImage returns reference record of image stored under key, or nil if
+// there is no such image.
+//
+// Tarballs dropped into RegistryDir, and the embedded base image, are added
+// to store on first lookup.
+func lookupImage(key string) (*Metadata, error) {
+	// A dropped tarball replaces image of same reference, as it did before
+	// images were stored by content
+	if legacyTarball(key) != "" {
+		return importLegacy(key)
+	}
+
+	meta, err := loadMetadata(key)
+	if err != nil || meta != nil {
+		return meta, err
+	}
+
+	if key == baseImage {
+		return importBaseImage()
+	}
+
+	return nil, nil
+}
+
+// requireImage is like lookupImage but fails if image does not exist.
+func requireImage(key string) (*Metadata, error) {
+	meta, err := lookupImage(key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, fmt.Errorf("image '%s' not found", imageRef(key))
+	}
+
+	return meta, nil
+}
+
+// peekImage is like lookupImage but leaves store unchanged, describing images
+// not yet added to store from their tarball in RegistryDir or assets.
+func peekImage(key string) (*Metadata, error) {
+	if legacyTarball(key) != "" {
+		return loadLegacyMetadata(key)
+	}
+
+	meta, err := loadMetadata(key)
+	if err != nil || meta != nil {
+		return meta, err
+	}
+
+	if key == baseImage {
+		return &Metadata{}, nil
+	}
+
+	return nil, nil
+}
+
+// importLegacy moves tarball of image stored under key in RegistryDir into
+// store, keeping metadata saved next to it and replacing any image stored
+// under key before.
+func importLegacy(key string) (*Metadata, error) {
+	meta, err := loadLegacyMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := loadMetadata(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tarballPath := legacyTarball(key)
+	if meta.Created.IsZero() {
+		if fi, err := os.Stat(tarballPath); err == nil {
+			meta.Created = fi.ModTime()
+		}
+	}
+
+	// Tags used to be hard links of one tarball, each is moved and deduplicated
+	if meta.Digest, err = putBlob(tarballPath); err != nil {
+		return nil, err
+	}
+	if err := saveMetadata(key, meta); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(legacyMetadataPath(key)); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove %s: %v", legacyMetadataPath(key), err)
+	}
+
+	if err := releaseBlobs(old, meta); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Added image '%s' from %s to store", imageRef(key), tarballPath)
+	return meta, nil
+}
+
+// importBaseImage adds embedded base image to store.
+func importBaseImage() (*Metadata, error) {
+	f, err := newBlobFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	src, err := assets.Files.Open(baseImage + ".tar.gz")
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open embedded tarball file: %w", err)
+	}
+	defer src.Close()
+
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write tarball file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write tarball file: %w", err)
+	}
+
+	meta := &Metadata{Source: "embedded"}
+	if meta.Digest, err = putBlob(f.Name()); err != nil {
+		return nil, err
+	}
+	if fi, err := os.Stat(blobPath(meta.Digest)); err == nil {
+		meta.Created = fi.ModTime()
+	}
+	if err := saveMetadata(baseImage, meta); err != nil {
+		return nil, err
+	}
+
+	return meta, nil
+}
+
+// embeddedDigest returns digest of embedded base image tarball.
+func embeddedDigest() (string, error) {
+	f, err := assets.Files.Open(baseImage + ".tar.gz")
+	if err != nil {
+		return "", fmt.Errorf("failed to open embedded tarball file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to read embedded tarball file: %w", err)
+	}
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// legacyMetadataPath returns path of metadata saved next to a tarball in RegistryDir.
+func legacyMetadataPath(key string) string {
+	return filepath.Join(RegistryDir(), key+".json")
+}
+
+// loadLegacyMetadata reads metadata saved next to a tarball in RegistryDir,
+// returning empty metadata if there is none.
+func loadLegacyMetadata(key string) (*Metadata, error) {
+	meta, err := readMetadata(legacyMetadataPath(key))
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = &Metadata{}
+	}
+
+	return meta, nil
+}
+
+// imageKeys returns storage names of all images, adding tarballs dropped into
+// RegistryDir to store first.
+func imageKeys() ([]string, error) {
+	entries, err := os.ReadDir(RegistryDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read image registry: %w", err)
+	}
+	for _, entry := range entries {
+		for _, ext := range legacyExts {
+			if key, ok := strings.CutSuffix(entry.Name(), ext); ok && validKey(key) {
+				if _, err := lookupImage(key); err != nil {
+					log.Printf("Failed to add %s to store: %v", entry.Name(), err)
+				}
+			}
+		}
+	}
+
+	entries, err = os.ReadDir(refsDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image references: %w", err)
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if key, ok := strings.CutSuffix(entry.Name(), ".json"); ok && validKey(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// blobs returns digests of blobs stored for image: its own and those it is
+// stacked on by content, topmost first.
+func (m *Metadata) blobs() []string {
+	return append([]string{m.Digest}, m.Base...)
+}
+
+// stackedOnParent reports whether image is stacked on Parent by name, as
+// incremental images committed before parents were recorded by content are.
+func (m *Metadata) stackedOnParent() bool {
+	return m.Parent != "" && len(m.Base) == 0
+}
+
+// releaseBlobs releases blobs old image was stored in that its replacement,
+// which may be nil, does not use.
+func releaseBlobs(old, replacement *Metadata) error {
+	if old == nil {
+		return nil
+	}
+
+	for _, digest := range old.blobs() {
+		if replacement != nil && slices.Contains(replacement.blobs(), digest) {
+			continue
+		}
+		if err := releaseBlob(digest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// referencesOf returns storage names of images stored in or stacked on blob of
+// given digest.
+func referencesOf(digest string) ([]string, error) {
+	keys, err := imageKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, key := range keys {
+		meta, err := loadMetadata(key)
+		if err == nil && meta != nil && slices.Contains(meta.blobs(), digest) {
+			refs = append(refs, key)
+		}
+	}
+
+	return refs, nil
+}
+
+// releaseBlob removes blob of given digest and its extraction once no image
+// refers to it. An extraction still used by containers is kept with a warning,
+// to be dropped by cache eviction once unused.
+func releaseBlob(digest string) error {
+	if digest == "" {
+		return nil
+	}
+
+	refs, err := referencesOf(digest)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 {
+		return nil
+	}
+
+	if err := os.Remove(blobPath(digest)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove image blob: %w", err)
+	}
+
+	id := layerID(digest)
+	removed, err := removeImage(id)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		if _, err := os.Stat(filepath.Join(rootfsDir(), id)); err == nil {
+			log.Printf("Extracted image %s is in use, it will be removed from cache once unused", shortID(id))
+		}
+	}
+
+	return nil
+}
+
+// shortID abbreviates a blob or layer ID for display.
+func shortID(id string) string {
+	id = layerID(id)
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,254 @@
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// defaultTag is implied by image references without a tag.
+const defaultTag = "latest"
+
+// Image describes an image in registry.
+type Image struct {
+	Name    string
+	Tag     string
+	ID      string
+	Created time.Time
+
+	// Size is logical size of image, SharedSize is part of it other images share.
+	Size       int64
+	SharedSize int64
+}
+
+// imageKey returns name under which image referenced as NAME[:TAG] is stored.
+//
+// Images tagged latest are stored as NAME, others as NAME@TAG, as ':' would
+// split overlay lower directories.
+func imageKey(ref string) (string, error) {
+	name, tag, ok := strings.Cut(ref, ":")
+	if !validImageName(name) {
+		return "", fmt.Errorf("invalid image name %q: use lowercase letters, digits, '.', '_' and '-'", name)
+	}
+	if !ok || tag == defaultTag {
+		return name, nil
+	}
+	if !validTag(tag) {
+		return "", fmt.Errorf("invalid image tag %q: use letters, digits, '.', '_' and '-', up to 128 characters", tag)
+	}
+
+	return name + "@" + tag, nil
+}
+
+// splitKey returns name and tag of image stored under key, inverse of imageKey.
+func splitKey(key string) (string, string) {
+	if name, tag, ok := strings.Cut(key, "@"); ok {
+		return name, tag
+	}
+	return key, defaultTag
+}
+
+// imageRef returns reference of image stored under key.
+func imageRef(key string) string {
+	name, tag := splitKey(key)
+	return name + ":" + tag
+}
+
+// validTag reports whether tag can be used as a local image tag.
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > 128 || tag[0] == '.' || tag[0] == '-' {
+		return false
+	}
+	for _, c := range tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			c == '.' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateRef reports an error if ref is not a valid NAME[:TAG] reference.
+func ValidateRef(ref string) error {
+	_, err := imageKey(ref)
+	return err
+}
+
+// FlatTarball returns path of a tarball holding whole filesystem of given
+// image, along with a function removing it once no longer needed.
+//
+// The blob of an image made of a single gzipped layer is returned as is, other
+// images are flattened into a temporary gzipped tarball.
+func FlatTarball(ref string) (string, func(), error) {
+	key, err := imageKey(ref)
+	if err != nil {
+		return "", nil, err
+	}
+
+	meta, err := requireImage(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if meta.Parent == "" && len(meta.Base) == 0 {
+		gzipped, err := isGzip(blobPath(meta.Digest))
+		if err != nil {
+			return "", nil, err
+		}
+		if gzipped {
+			return blobPath(meta.Digest), func() {}, nil
+		}
+	}
+
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create image directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(imageDir(), ".flatten-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(tmpDir) }
+
+	rootfs := filepath.Join(tmpDir, "rootfs")
+	unmount, err := mountReadOnly(ref, rootfs, tmpDir)
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+
+	tarball := filepath.Join(tmpDir, "image.tar.gz")
+	out, err := exec.Command("tar", "czf", tarball, "-C", rootfs, ".").CombinedOutput()
+	unmount()
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to flatten image: %s", out)
+	}
+
+	return tarball, cleanup, nil
+}
+
+// Images returns all images in store sorted by reference.
+//
+// Size of an image counts every blob it is made of, including those of its
+// parents and those it is stacked on by content. SharedSize counts the part
+// other images, not merely other tags of it, are made of too.
+func Images() ([]Image, error) {
+	keys, err := imageKeys()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	metas := make(map[string]*Metadata)
+	layers := make(map[string][]string)
+	users := make(map[string]map[string]bool) // by blob, digests of images made of it
+	for _, key := range keys {
+		meta, err := loadMetadata(key)
+		if err != nil || meta == nil {
+			continue
+		}
+		chain, err := walkChain(key, loadMetadata)
+		if err != nil {
+			continue
+		}
+
+		for _, k := range chain {
+			m, err := loadMetadata(k)
+			if err != nil || m == nil {
+				continue
+			}
+			for _, digest := range m.blobs() {
+				if users[digest] == nil {
+					users[digest] = make(map[string]bool)
+				}
+				users[digest][meta.Digest] = true
+				layers[key] = append(layers[key], digest)
+			}
+		}
+		metas[key] = meta
+	}
+
+	var images []Image
+	for _, key := range keys {
+		meta := metas[key]
+		if meta == nil {
+			continue
+		}
+
+		img := Image{ID: shortID(meta.Digest), Created: meta.Created}
+		img.Name, img.Tag = splitKey(key)
+		for _, digest := range layers[key] {
+			fi, err := os.Stat(blobPath(digest))
+			if err != nil {
+				continue
+			}
+			img.Size += fi.Size()
+			if len(users[digest]) > 1 {
+				img.SharedSize += fi.Size()
+			}
+		}
+		images = append(images, img)
+	}
+
+	return images, nil
+}
+
+// StoredSize returns size of all blobs in store, each stored once however many
+// images are made of it.
+func StoredSize() (int64, error) {
+	entries, err := os.ReadDir(blobsDir())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob directory: %w", err)
+	}
+
+	var total int64
+	for _, entry := range entries {
+		if fi, err := entry.Info(); err == nil && !strings.HasPrefix(entry.Name(), ".") {
+			total += fi.Size()
+		}
+	}
+
+	return total, nil
+}
+
+// Tag makes target reference an alias of source image, sharing its content,
+// replacing any image target referred to before.
+func Tag(source, target string) error {
+	srcKey, err := imageKey(source)
+	if err != nil {
+		return err
+	}
+	dstKey, err := imageKey(target)
+	if err != nil {
+		return err
+	}
+
+	if srcKey == dstKey {
+		return nil
+	}
+
+	meta, err := requireImage(srcKey)
+	if err != nil {
+		return err
+	}
+
+	old, err := lookupImage(dstKey)
+	if err != nil {
+		return err
+	}
+	if err := checkReplaceable(dstKey); err != nil {
+		return err
+	}
+
+	if err := saveMetadata(dstKey, meta); err != nil {
+		return err
+	}
+
+	return releaseBlobs(old, meta)
+}
@@ -0,0 +1,50 @@
+package overlay
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// UnpackImage copies filesystem of given image, with every layer it is stacked
+// on applied, into dir on host, e.g. to chroot into or inspect it without a
+// container. Dir is created if missing, and must be empty otherwise.
+//
+// Files removed by upper layers are left out, and ownership, permissions and
+// symlinks are kept as they are in image.
+func UnpackImage(ref, dir string) error {
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("directory %s is not empty", dir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read directory %s: %w", dir, err)
+	}
+
+	if err := os.MkdirAll(imageDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create image directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp(imageDir(), ".unpack-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imageRoot := filepath.Join(tmpDir, "image")
+	unmount, err := mountReadOnly(ref, imageRoot, tmpDir)
+	if err != nil {
+		return err
+	}
+	defer unmount()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	if out, err := exec.Command("cp", "-a", imageRoot+"/.", dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to unpack image: %s", strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
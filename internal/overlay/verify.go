@@ -0,0 +1,317 @@
+package overlay
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/lutaod/tinydock/internal/untar"
+	"golang.org/x/sys/unix"
+)
+
+// VerifyImages checks blobs of images, including those they are stacked on by
+// content, against their digests, and extracted trees against blobs they came
+// from, re-extracting those that are missing or inconsistent and printing
+// outcome of each.
+//
+// Every image in store is verified if none are given. A blob whose content no
+// longer matches its digest is corrupted and cannot be repaired. An extracted
+// tree is inconsistent if any file differs from blob content. Images used by
+// containers are reported but not repaired.
+func VerifyImages(refs []string) error {
+	var keys []string
+	if len(refs) == 0 {
+		var err error
+		if keys, err = imageKeys(); err != nil {
+			return err
+		}
+	}
+	for _, ref := range refs {
+		key, err := imageKey(ref)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	failed := 0
+	outcomes := make(map[string]outcome) // by layer ID, as tags share layers
+	for _, key := range keys {
+		ref := imageRef(key)
+
+		meta, err := requireImage(key)
+		if err != nil {
+			fmt.Printf("%s: %v\n", ref, err)
+			failed++
+			continue
+		}
+
+		// Layers image is stacked on by content are reported along with it
+		var messages []string
+		imageFailed := false
+		for i, digest := range meta.blobs() {
+			id := layerID(digest)
+			out, ok := outcomes[id]
+			if !ok {
+				out = checkLayer(id)
+				outcomes[id] = out
+			}
+			imageFailed = imageFailed || out.failed
+
+			switch {
+			case i == 0:
+				messages = append(messages, out.message)
+			case out.message != "ok":
+				messages = append(messages, fmt.Sprintf("base layer %s: %s", shortID(id), out.message))
+			}
+		}
+		if imageFailed {
+			failed++
+		}
+		fmt.Printf("%s: %s\n", ref, strings.Join(messages, "; "))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d image(s) failed verification", failed)
+	}
+
+	return nil
+}
+
+// outcome is result of verifying a layer.
+type outcome struct {
+	message string
+	failed  bool
+}
+
+// checkLayer verifies and if needed repairs layer of given ID.
+func checkLayer(id string) outcome {
+	problem, err := verifyImage(id)
+	if err != nil {
+		return outcome{err.Error(), true}
+	}
+	if problem == "" {
+		return outcome{"ok", false}
+	}
+
+	if err := repairImage(id); err != nil {
+		return outcome{fmt.Sprintf("%s, not repaired: %v", problem, err), true}
+	}
+	return outcome{problem + ", re-extracted", false}
+}
+
+// verifyImage returns a description of what is wrong with extracted tree of
+// given layer ID, or an empty string if it is consistent with its blob.
+func verifyImage(id string) (string, error) {
+	tarballPath := blobPath(id)
+	rootfsPath := filepath.Join(rootfsDir(), id)
+
+	digest, err := fileDigest(tarballPath)
+	if err != nil {
+		return "", fmt.Errorf("blob unreadable: %w", err)
+	}
+	if layerID(digest) != id {
+		return "", fmt.Errorf("blob corrupted, content digest is %s", digest)
+	}
+
+	if _, err := os.Stat(rootfsPath); os.IsNotExist(err) {
+		return "not extracted", nil
+	}
+
+	diffs, err := compareTree(tarballPath, rootfsPath)
+	if err != nil {
+		return "", err
+	}
+	if len(diffs) > 0 {
+		return fmt.Sprintf("%d file(s) differ from tarball", len(diffs)), nil
+	}
+
+	return "", nil
+}
+
+// compareTree lists differences between tarball members and files under dir,
+// as extracted by extractTarball: type, mode, ownership, modification time,
+// content, link targets and device numbers are compared.
+//
+// Files present only in dir are not reported, as tarball members are compared.
+func compareTree(tarball, dir string) ([]string, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return nil, fmt.Errorf("tarball unreadable: %w", err)
+	}
+	defer f.Close()
+
+	r, wait, err := decompress(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			wait()
+			return nil, fmt.Errorf("tarball unreadable: %w", err)
+		}
+
+		path, err := untar.SecurePath(dir, hdr.Name)
+		if err != nil {
+			wait()
+			return nil, err
+		}
+		// Root directory itself is created by extraction, not restored from tarball
+		if path == dir {
+			continue
+		}
+
+		diff, err := compareEntry(dir, path, hdr, tr)
+		if err != nil {
+			wait()
+			return nil, err
+		}
+		if diff != "" {
+			diffs = append(diffs, hdr.Name+": "+diff)
+		}
+	}
+
+	if err := wait(); err != nil {
+		return nil, err
+	}
+
+	return diffs, nil
+}
+
+// compareEntry describes how file at path differs from tarball entry hdr with
+// content r, or returns an empty string if it does not.
+func compareEntry(dir, path string, hdr *tar.Header, r io.Reader) (string, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return "does not exist", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Hard link shares inode of its target, compared as its own entry
+	if hdr.Typeflag == tar.TypeLink {
+		target, err := untar.SecurePath(dir, hdr.Linkname)
+		if err != nil {
+			return "", err
+		}
+		if tfi, err := os.Lstat(target); err != nil || !os.SameFile(fi, tfi) {
+			return "not linked to " + hdr.Linkname, nil
+		}
+		return "", nil
+	}
+
+	want := hdr.FileInfo()
+	if fi.Mode().Type() != want.Mode().Type() {
+		return "file type differs", nil
+	}
+
+	st := fi.Sys().(*syscall.Stat_t)
+	switch {
+	case int(st.Uid) != hdr.Uid:
+		return "uid differs", nil
+	case int(st.Gid) != hdr.Gid:
+		return "gid differs", nil
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeSymlink:
+		if link, err := os.Readlink(path); err != nil || link != hdr.Linkname {
+			return "symlink differs", nil
+		}
+		return "", nil
+	case tar.TypeChar, tar.TypeBlock:
+		if unix.Major(st.Rdev) != uint32(hdr.Devmajor) || unix.Minor(st.Rdev) != uint32(hdr.Devminor) {
+			return "device number differs", nil
+		}
+	}
+
+	if fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) != want.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky) {
+		return "mode differs", nil
+	}
+
+	// Directory times change whenever entries are added, so only files count
+	if hdr.Typeflag != tar.TypeReg {
+		return "", nil
+	}
+	if !fi.ModTime().Equal(hdr.ModTime) {
+		return "mod time differs", nil
+	}
+	if fi.Size() != hdr.Size {
+		return "size differs", nil
+	}
+
+	same, err := sameContent(path, r)
+	if err != nil {
+		return "", err
+	}
+	if !same {
+		return "contents differ", nil
+	}
+
+	return "", nil
+}
+
+// sameContent reports whether file at path holds exactly what r yields.
+func sameContent(path string, r io.Reader) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	a, b := make([]byte, 32<<10), make([]byte, 32<<10)
+	for {
+		n, errA := io.ReadFull(f, a)
+		m, errB := io.ReadFull(r, b)
+		if !bytes.Equal(a[:n], b[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return errB == io.EOF || errB == io.ErrUnexpectedEOF, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+		if errB != nil {
+			if errB == io.EOF || errB == io.ErrUnexpectedEOF {
+				return false, nil
+			}
+			return false, fmt.Errorf("tarball unreadable: %w", errB)
+		}
+	}
+}
+
+// repairImage replaces extracted tree of given layer ID with a fresh extraction.
+func repairImage(image string) error {
+	if _, err := os.Stat(filepath.Join(rootfsDir(), image)); err == nil {
+		removed, err := removeImage(image)
+		if err != nil {
+			return err
+		}
+		if !removed {
+			return fmt.Errorf("image is in use")
+		}
+	}
+
+	unlock, err := lockImage(image)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	_, err = extractImage(image)
+	return err
+}
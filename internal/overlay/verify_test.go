@@ -0,0 +1,134 @@
+package overlay
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTarball writes a gzipped tarball with a directory, a file, a hard link
+// to it and a symlink, and returns its path.
+func writeTarball(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "layer.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create tarball: %v", err)
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	mtime := time.Unix(1700000000, 0)
+	entries := []struct {
+		hdr  tar.Header
+		data string
+	}{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime}},
+		{hdr: tar.Header{Name: "etc/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: mtime}},
+		{hdr: tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0640, ModTime: mtime}, data: "port=80\n"},
+		{hdr: tar.Header{Name: "etc/app.link", Typeflag: tar.TypeLink, Linkname: "etc/app.conf", ModTime: mtime}},
+		{hdr: tar.Header{Name: "etc/current", Typeflag: tar.TypeSymlink, Linkname: "app.conf", Mode: 0777, ModTime: mtime}},
+	}
+	for _, e := range entries {
+		e.hdr.Size = int64(len(e.data))
+		if err := tw.WriteHeader(&e.hdr); err != nil {
+			t.Fatalf("Failed to write tarball: %v", err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatalf("Failed to write tarball: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to write tarball: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatalf("Failed to write tarball: %v", err)
+	}
+
+	return path
+}
+
+func TestCompareTree(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(dir string) error
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(dir string) error { return nil },
+		},
+		{
+			name: "content changed in place",
+			change: func(dir string) error {
+				path := filepath.Join(dir, "etc/app.conf")
+				fi, err := os.Stat(path)
+				if err != nil {
+					return err
+				}
+				if err := os.WriteFile(path, []byte("port=81\n"), 0640); err != nil {
+					return err
+				}
+				return os.Chtimes(path, fi.ModTime(), fi.ModTime())
+			},
+			want: []string{"etc/app.conf: contents differ"},
+		},
+		{
+			name:   "mode changed",
+			change: func(dir string) error { return os.Chmod(filepath.Join(dir, "etc"), 0700) },
+			want:   []string{"etc/: mode differs"},
+		},
+		{
+			name:   "file removed",
+			change: func(dir string) error { return os.Remove(filepath.Join(dir, "etc/app.link")) },
+			want:   []string{"etc/app.link: does not exist"},
+		},
+		{
+			name: "symlink retargeted",
+			change: func(dir string) error {
+				path := filepath.Join(dir, "etc/current")
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				return os.Symlink("/etc/passwd", path)
+			},
+			want: []string{"etc/current: symlink differs"},
+		},
+		{
+			name: "symlink replaced by file",
+			change: func(dir string) error {
+				path := filepath.Join(dir, "etc/current")
+				if err := os.Remove(path); err != nil {
+					return err
+				}
+				return os.WriteFile(path, nil, 0644)
+			},
+			want: []string{"etc/current: file type differs"},
+		},
+	}
+
+	tarball := writeTarball(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := extractTarball(tarball, dir); err != nil {
+				t.Fatalf("Failed to extract tarball: %v", err)
+			}
+			if err := tt.change(dir); err != nil {
+				t.Fatalf("Failed to change tree: %v", err)
+			}
+
+			diffs, err := compareTree(tarball, dir)
+			if err != nil {
+				t.Fatalf("compareTree() unexpected error: %v", err)
+			}
+			if strings.Join(diffs, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("compareTree() = %q, want %q", diffs, tt.want)
+			}
+		})
+	}
+}
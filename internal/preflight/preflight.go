@@ -0,0 +1,196 @@
+// Package preflight verifies that host provides the kernel features and tools
+// tinydock relies on, so that missing prerequisites are reported up front with
+// a hint on how to fix them instead of surfacing as cryptic mount or cgroup
+// errors halfway through container setup.
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// Check verifies a single host feature.
+type Check struct {
+	// Name is a short description of verified feature.
+	Name string
+
+	// Hint tells user how to satisfy the check when it fails.
+	Hint string
+
+	verify func() error
+}
+
+// Result is outcome of running a Check.
+type Result struct {
+	Check
+	Err error
+}
+
+var (
+	// Overlay verifies overlayfs is supported by kernel.
+	Overlay = Check{
+		Name:   "overlayfs support",
+		Hint:   "load the overlay module with 'modprobe overlay'",
+		verify: verifyOverlay,
+	}
+
+	// CgroupV2 verifies unified cgroup hierarchy is mounted with required controllers.
+	CgroupV2 = Check{
+		Name:   "cgroup v2 with cpu, memory, io and pids controllers",
+		Hint:   "boot with systemd.unified_cgroup_hierarchy=1 and enable cpu/memory/io/pids controllers",
+		verify: verifyCgroupV2,
+	}
+
+	// Iptables verifies iptables binary is available for networking.
+	Iptables = Check{
+		Name:   "iptables",
+		Hint:   "install iptables (e.g., 'apt install iptables')",
+		verify: verifyCommand("iptables"),
+	}
+
+	// IPForward verifies kernel forwards packets between interfaces.
+	IPForward = Check{
+		Name:   "net.ipv4.ip_forward=1",
+		Hint:   "run 'sysctl -w net.ipv4.ip_forward=1'",
+		verify: verifySysctl("net.ipv4.ip_forward", "1"),
+	}
+
+	// TC verifies tc binary is available for network emulation.
+	TC = Check{
+		Name:   "tc (netem only)",
+		Hint:   "install iproute2 (e.g., 'apt install iproute2') and load sch_netem",
+		verify: verifyCommand("tc"),
+	}
+
+	// Busctl verifies busctl binary is available for systemd cgroup driver.
+	Busctl = Check{
+		Name:   "busctl (systemd cgroup driver only)",
+		Hint:   "install systemd or keep default cgroupfs driver",
+		verify: verifyCommand("busctl"),
+	}
+)
+
+// Host returns checks of every known feature, split into required ones host
+// must pass and optional ones only some setups rely on, whose failures are mere
+// warnings, such as tc used for network emulation only. busctl is required with
+// systemd cgroup driver.
+func Host(systemdDriver bool) (required, optional []Check) {
+	required = []Check{Overlay, CgroupV2, Iptables, IPForward}
+	optional = []Check{TC}
+	if systemdDriver {
+		return append(required, Busctl), optional
+	}
+	return required, append(optional, Busctl)
+}
+
+// Run executes given checks and returns their results.
+func Run(checks ...Check) []Result {
+	results := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		results = append(results, Result{Check: c, Err: c.verify()})
+	}
+	return results
+}
+
+// Verify executes given checks and returns an error describing every failed one.
+func Verify(checks ...Check) error {
+	var errs []error
+	for _, r := range Run(checks...) {
+		if r.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w (hint: %s)", r.Name, r.Err, r.Hint))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("host is missing required features:\n%w", errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// ForRun returns checks needed to run a container, including networking ones if
+// container is connected to a network.
+func ForRun(networked bool) []Check {
+	checks := []Check{Overlay, CgroupV2}
+	if networked {
+		checks = append(checks, Iptables, IPForward)
+	}
+	return checks
+}
+
+// verifyOverlay checks overlay filesystem type is registered in kernel.
+func verifyOverlay() error {
+	data, err := os.ReadFile("/proc/filesystems")
+	if err != nil {
+		return fmt.Errorf("failed to read /proc/filesystems: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[len(fields)-1] == "overlay" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("overlay filesystem not registered")
+}
+
+// verifyCgroupV2 checks cgroup2 is mounted at root and controllers are available.
+func verifyCgroupV2() error {
+	data, err := os.ReadFile(cgroupRoot + "/cgroup.controllers")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s is not a cgroup v2 mount", cgroupRoot)
+		}
+		return fmt.Errorf("failed to read cgroup controllers: %w", err)
+	}
+
+	available := strings.Fields(string(data))
+	for _, c := range []string{"cpu", "memory", "io", "pids"} {
+		if !contains(available, c) {
+			return fmt.Errorf("%s controller not available", c)
+		}
+	}
+
+	return nil
+}
+
+// verifyCommand returns a verifier checking given command is found in PATH.
+func verifyCommand(name string) func() error {
+	return func() error {
+		if _, err := exec.LookPath(name); err != nil {
+			return fmt.Errorf("%s not found in PATH", name)
+		}
+		return nil
+	}
+}
+
+// verifySysctl returns a verifier checking given sysctl is set to expected value.
+func verifySysctl(key, expected string) func() error {
+	return func() error {
+		path := "/proc/sys/" + strings.ReplaceAll(key, ".", "/")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		if value := strings.TrimSpace(string(data)); value != expected {
+			return fmt.Errorf("%s is %s", key, value)
+		}
+		return nil
+	}
+}
+
+func contains(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
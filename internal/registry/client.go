@@ -0,0 +1,249 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Media types of manifests and layers understood by client.
+const (
+	mediaTypeOCIIndex        = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest     = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList      = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest  = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCILayer        = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGzip    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeDockerLayerGzip = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+// errNotFound is returned when registry has no content at requested path.
+var errNotFound = errors.New("not found")
+
+// descriptor points to content in registry.
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// platform identifies OS and architecture an image is built for.
+type platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// manifest is either an image manifest or an index of per-platform manifests.
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers,omitempty"`
+	Manifests     []descriptor `json:"manifests,omitempty"`
+}
+
+// client talks to registry API v2 on behalf of a single repository.
+type client struct {
+	ref   *Reference
+	http  *http.Client
+	token string
+}
+
+func newClient(ref *Reference) *client {
+	return &client{
+		ref:  ref,
+		http: &http.Client{Timeout: 30 * time.Minute},
+	}
+}
+
+// fetchManifest downloads manifest with given tag or digest, returning it along
+// with its raw content and media type.
+func (c *client) fetchManifest(reference string) (*manifest, []byte, string, error) {
+	resp, err := c.do(http.MethodGet, c.url("/manifests/"+reference), http.Header{
+		"Accept": {mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest},
+	}, nil)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0])
+	}
+
+	return &m, data, mediaType, nil
+}
+
+// fetchBlob opens blob with given digest for reading.
+func (c *client) fetchBlob(digest string) (io.ReadCloser, error) {
+	resp, err := c.do(http.MethodGet, c.url("/blobs/"+digest), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// do sends a request to given URL, authenticating with a bearer token when
+// registry asks for one.
+//
+// Body is held in memory so request can be resent after authentication.
+func (c *client) do(method, u string, header http.Header, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach registry: %w", err)
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+
+			if err := c.authenticate(challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotFound && method == http.MethodHead {
+			resp.Body.Close()
+			return nil, errNotFound
+		}
+
+		if resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			return nil, fmt.Errorf("registry returned %s for %s %s: %s",
+				resp.Status, method, u, strings.TrimSpace(string(msg)))
+		}
+
+		return resp, nil
+	}
+}
+
+// authenticate obtains an anonymous bearer token as described by challenge, e.g.:
+//
+//	Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"
+func (c *client) authenticate(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("unsupported registry authentication: %q", challenge)
+	}
+
+	values := parseChallenge(params)
+	realm := values["realm"]
+	if realm == "" {
+		return fmt.Errorf("registry authentication challenge has no realm: %q", challenge)
+	}
+
+	query := url.Values{}
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	if scope := values["scope"]; scope != "" {
+		query.Set("scope", scope)
+	} else {
+		query.Set("scope", "repository:"+c.ref.Repository+":pull")
+	}
+
+	resp, err := c.http.Get(realm + "?" + query.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to request registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request returned %s", resp.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to parse registry token: %w", err)
+	}
+
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+
+	return nil
+}
+
+// parseChallenge parses comma separated key="value" pairs of an auth challenge.
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, ", "), "=")
+		if !ok {
+			break
+		}
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, params = rest[1:end+1], rest[end+2:]
+		} else {
+			value, params, _ = strings.Cut(rest, ",")
+		}
+
+		values[strings.TrimSpace(key)] = value
+	}
+	return values
+}
+
+// resolve returns absolute URL of a Location header, which may be relative to
+// registry API.
+func (c *client) resolve(location string) (string, error) {
+	base, err := url.Parse(c.url(""))
+	if err != nil {
+		return "", err
+	}
+
+	ref, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("invalid upload location %q: %w", location, err)
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// url returns API URL of given path under repository.
+func (c *client) url(path string) string {
+	return fmt.Sprintf("%s://%s/v2/%s%s", c.ref.scheme(), c.ref.apiHost(), c.ref.Repository, path)
+}
@@ -0,0 +1,72 @@
+package registry
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+		want   map[string]string
+	}{
+		{
+			name:   "quoted values",
+			params: `realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`,
+			want: map[string]string{
+				"realm":   "https://auth.docker.io/token",
+				"service": "registry.docker.io",
+				"scope":   "repository:library/alpine:pull",
+			},
+		},
+		{
+			name:   "unquoted values",
+			params: `realm=https://ghcr.io/token,service=ghcr.io`,
+			want:   map[string]string{"realm": "https://ghcr.io/token", "service": "ghcr.io"},
+		},
+		{
+			name:   "spaces between pairs",
+			params: `realm="https://r/token", service="r"`,
+			want:   map[string]string{"realm": "https://r/token", "service": "r"},
+		},
+		{
+			name:   "comma in quoted value",
+			params: `realm="https://r/token",scope="repository:app:pull,push"`,
+			want:   map[string]string{"realm": "https://r/token", "scope": "repository:app:pull,push"},
+		},
+		{
+			name:   "empty quoted value",
+			params: `realm="",service="r"`,
+			want:   map[string]string{"realm": "", "service": "r"},
+		},
+		{
+			name:   "unterminated quote",
+			params: `service="r",realm="https://r/token`,
+			want:   map[string]string{"service": "r"},
+		},
+		{
+			name:   "pair without value",
+			params: `realm="https://r/token",error`,
+			want:   map[string]string{"realm": "https://r/token"},
+		},
+		{
+			name:   "no pairs",
+			params: `garbage`,
+			want:   map[string]string{},
+		},
+		{
+			name:   "empty",
+			params: ``,
+			want:   map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseChallenge(tt.params); !maps.Equal(got, tt.want) {
+				t.Errorf("parseChallenge(%q) = %v, want %v", tt.params, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package registry
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/untar"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// applyLayer unpacks a layer tarball of given media type on top of root,
+// processing whiteouts that delete files of lower layers.
+func applyLayer(root string, r io.Reader, mediaType string) error {
+	switch mediaType {
+	case mediaTypeOCILayerGzip, mediaTypeDockerLayerGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("failed to decompress layer: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	case mediaTypeOCILayer:
+	default:
+		return fmt.Errorf("unsupported layer media type: %s", mediaType)
+	}
+
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+
+	// Opaque whiteouts hide lower layers only, not entries of this layer
+	created := make(map[string]bool)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read layer: %w", err)
+		}
+
+		path, err := untar.SecurePath(root, hdr.Name)
+		if err != nil {
+			return err
+		}
+		dir, base := filepath.Dir(path), filepath.Base(path)
+
+		if base == whiteoutOpaque {
+			if err := clearDir(dir, created); err != nil {
+				return err
+			}
+			continue
+		}
+		if name, ok := strings.CutPrefix(base, whiteoutPrefix); ok {
+			// Whiteout of "." or ".." would remove a directory above its own
+			if name == "" || name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) {
+				return fmt.Errorf("invalid whiteout %s", hdr.Name)
+			}
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return fmt.Errorf("failed to apply whiteout %s: %w", hdr.Name, err)
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+
+		if err := untar.Entry(root, path, hdr, tr); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+		created[path] = true
+
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTime{path, hdr.ModTime})
+		}
+	}
+
+	// Directory times change as entries are created in them, restore them last
+	for _, d := range dirs {
+		os.Chtimes(d.path, d.mtime, d.mtime)
+	}
+
+	return nil
+}
+
+// clearDir removes entries of dir not in keep, keeping dir itself.
+func clearDir(dir string, keep map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if keep[filepath.Join(dir, e.Name())] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return fmt.Errorf("failed to apply opaque whiteout to %s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyLayerWhiteout(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     string
+		gone      string
+		wantError bool
+	}{
+		{
+			name:  "file",
+			entry: "dir/.wh.file",
+			gone:  "dir/file",
+		},
+		{
+			name:  "directory",
+			entry: ".wh.dir",
+			gone:  "dir",
+		},
+		{
+			name:      "empty name",
+			entry:     "dir/.wh.",
+			wantError: true,
+		},
+		{
+			name:      "dot",
+			entry:     "dir/.wh..",
+			wantError: true,
+		},
+		{
+			name:      "dot dot",
+			entry:     "dir/.wh...",
+			wantError: true,
+		},
+		{
+			name:      "dot dot at top level",
+			entry:     ".wh...",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			root := filepath.Join(parent, "root")
+			if err := os.MkdirAll(filepath.Join(root, "dir"), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "dir", "file"), []byte("lower"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			if err := tw.WriteHeader(&tar.Header{Name: tt.entry, Typeflag: tar.TypeReg, Mode: 0644}); err != nil {
+				t.Fatalf("Failed to write layer: %v", err)
+			}
+			if err := tw.Close(); err != nil {
+				t.Fatalf("Failed to write layer: %v", err)
+			}
+
+			err := applyLayer(root, &buf, mediaTypeOCILayer)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("applyLayer(%q) expected error", tt.entry)
+				}
+				if _, err := os.Stat(filepath.Join(root, "dir", "file")); err != nil {
+					t.Errorf("applyLayer(%q) removed entries of root: %v", tt.entry, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyLayer(%q) unexpected error: %v", tt.entry, err)
+			}
+
+			if _, err := os.Lstat(filepath.Join(root, tt.gone)); !os.IsNotExist(err) {
+				t.Errorf("applyLayer(%q) left %s", tt.entry, tt.gone)
+			}
+			if _, err := os.Stat(root); err != nil {
+				t.Errorf("applyLayer(%q) removed root: %v", tt.entry, err)
+			}
+		})
+	}
+}
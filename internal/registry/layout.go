@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+// Annotations of index entries naming an image, as written by docker save.
+const (
+	annotationImageName = "io.containerd.image.name"
+	annotationRefName   = "org.opencontainers.image.ref.name"
+)
+
+// Load adds image of an archive to store and returns its reference.
+//
+// Archives written by image save are loaded as they are. OCI image layout
+// archives, e.g. written by docker save or skopeo, are resolved to host
+// platform and flattened like pulled images, under name if given or under
+// name recorded in archive otherwise.
+func Load(input, name string) (string, error) {
+	l := layout(input)
+
+	data, err := l.read("index.json")
+	if err == errNotFound {
+		if name != "" {
+			return "", fmt.Errorf("image name can only be given for OCI image layout archives")
+		}
+		return overlay.LoadArchive(input)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var index manifest
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", fmt.Errorf("failed to parse index.json: %w", err)
+	}
+
+	// Top level index may list a single image without platform, which is
+	// either a manifest or an index of its own
+	var d descriptor
+	if len(index.Manifests) == 1 && index.Manifests[0].Platform == nil {
+		d = index.Manifests[0]
+	} else if d, err = selectManifest(index.Manifests); err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		if name = imageName(d.Annotations); name == "" {
+			return "", fmt.Errorf("archive does not name its image, give one with -t")
+		}
+	}
+	if err := overlay.ValidateRef(name); err != nil {
+		return "", err
+	}
+
+	m, err := l.resolveManifest(d)
+	if err != nil {
+		return "", err
+	}
+
+	data, err = l.readBlob(m.Config.Digest)
+	if err != nil {
+		return "", err
+	}
+	cfg, history, err := parseConfig(m.Config, data)
+	if err != nil {
+		return "", err
+	}
+
+	meta := overlay.Metadata{Source: "archive " + input, Config: cfg, History: history}
+	for _, layer := range m.Layers {
+		meta.Layers = append(meta.Layers, layer.Digest)
+	}
+
+	err = overlay.ImportImage(name, meta, func(rootfs string) error {
+		for _, layer := range m.Layers {
+			if err := l.applyBlob(rootfs, layer); err != nil {
+				return fmt.Errorf("layer %s: %w", layer.Digest, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// imageName returns NAME[:TAG] of image named by index entry annotations, or
+// an empty string if they do not name it.
+func imageName(annotations map[string]string) string {
+	full := annotations[annotationImageName]
+	if full == "" && strings.ContainsAny(annotations[annotationRefName], ":/") {
+		full = annotations[annotationRefName]
+	}
+	if full == "" {
+		return ""
+	}
+
+	ref, err := ParseReference(full)
+	if err != nil {
+		return ""
+	}
+	return ref.LocalName()
+}
+
+// layout is path of an OCI image layout archive, whose entries are looked up
+// by name. Archive is scanned again for each entry, which is cheap as tar
+// reader seeks over content of other ones.
+type layout string
+
+// resolveManifest reads manifest of given descriptor, selecting one for current
+// platform if it points to an index.
+func (l layout) resolveManifest(d descriptor) (*manifest, error) {
+	for depth := 0; ; depth++ {
+		data, err := l.readBlob(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyManifestDigest(d.Digest, data); err != nil {
+			return nil, err
+		}
+
+		var m manifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+
+		mediaType := m.MediaType
+		if mediaType == "" {
+			mediaType = d.MediaType
+		}
+
+		switch {
+		case mediaType == mediaTypeOCIManifest, mediaType == mediaTypeDockerManifest:
+			return &m, nil
+		case !isIndex(mediaType):
+			return nil, fmt.Errorf("unsupported manifest media type: %s", mediaType)
+		case depth == maxIndexDepth:
+			return nil, fmt.Errorf("image indexes nested too deeply")
+		}
+
+		if d, err = selectManifest(m.Manifests); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// applyBlob applies layer stored in archive to rootfs, verifying its digest.
+func (l layout) applyBlob(rootfs string, layer descriptor) error {
+	rc, err := l.openBlob(layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	return applyVerified(rootfs, rc, layer)
+}
+
+// readBlob returns content of blob of given digest.
+func (l layout) readBlob(digest string) ([]byte, error) {
+	rc, err := l.openBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", shortDigest(digest), err)
+	}
+	return data, nil
+}
+
+// openBlob opens blob of given digest for reading.
+func (l layout) openBlob(digest string) (io.ReadCloser, error) {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" || strings.ContainsAny(hex, "/.") {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+
+	rc, err := l.open("blobs/sha256/" + hex)
+	if err == errNotFound {
+		return nil, fmt.Errorf("archive is missing blob %s", shortDigest(digest))
+	}
+	return rc, err
+}
+
+// read returns content of archive entry with given name.
+func (l layout) read(name string) ([]byte, error) {
+	rc, err := l.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from archive: %w", name, err)
+	}
+	return data, nil
+}
+
+// open returns reader of archive entry with given name, or errNotFound.
+func (l layout) open(name string) (io.ReadCloser, error) {
+	f, err := os.Open(string(l))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			f.Close()
+			return nil, errNotFound
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if hdr.Typeflag == tar.TypeReg && path.Clean(strings.TrimPrefix(hdr.Name, "./")) == name {
+			return struct {
+				io.Reader
+				io.Closer
+			}{tr, f}, nil
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// maxIndexDepth bounds indexes nested in one another.
+const maxIndexDepth = 4
+
+// String renders platform as OS/ARCH[/VARIANT].
+func (p *platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// hostPlatform returns platform of images runnable on this host.
+func hostPlatform() platform {
+	p := platform{OS: "linux", Architecture: runtime.GOARCH}
+
+	switch runtime.GOARCH {
+	case "arm64":
+		p.Variant = "v8"
+	case "arm":
+		// Binary runs on ARM version it was built for, or later ones
+		p.Variant = "v7"
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "GOARM" {
+					p.Variant = "v" + strings.SplitN(s.Value, ",", 2)[0]
+				}
+			}
+		}
+	}
+
+	return p
+}
+
+// isIndex reports whether media type is that of a manifest list or image index.
+func isIndex(mediaType string) bool {
+	return mediaType == mediaTypeOCIIndex || mediaType == mediaTypeDockerList
+}
+
+// selectManifest returns manifest of index matching host platform. A manifest
+// of matching variant is preferred, one without variant is accepted too.
+func selectManifest(manifests []descriptor) (descriptor, error) {
+	host := hostPlatform()
+
+	var match *descriptor
+	var available []string
+	for i, d := range manifests {
+		p := d.Platform
+		if p == nil || p.OS == "unknown" {
+			// Attestations and other artifacts carry no runnable platform
+			continue
+		}
+		available = append(available, p.String())
+
+		if p.OS != host.OS || p.Architecture != host.Architecture {
+			continue
+		}
+		if p.Variant == host.Variant {
+			return manifests[i], nil
+		}
+		if match == nil && (p.Variant == "" || host.Variant == "") {
+			match = &manifests[i]
+		}
+	}
+
+	if match != nil {
+		return *match, nil
+	}
+	if len(available) == 0 {
+		return descriptor{}, fmt.Errorf("image index lists no platform, %s required", host.String())
+	}
+	return descriptor{}, fmt.Errorf("no image found for %s, available platforms: %s", host.String(), strings.Join(available, ", "))
+}
@@ -0,0 +1,212 @@
+// Package registry pulls and pushes images using the Docker Registry HTTP API
+// v2 / OCI distribution spec, as implemented by Docker Hub and others.
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+// Pull downloads image identified by reference and stores it locally under
+// given name, or under last component of its repository and its tag if name is
+// empty.
+//
+// Layers are applied in order into a single root filesystem, as local images
+// are flat tarballs. Multi-platform images resolve to current architecture.
+func Pull(reference, name string) error {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = ref.LocalName()
+	}
+
+	c := newClient(ref)
+
+	m, err := c.resolveManifest()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pulling %s\n", ref)
+
+	cfg, history, err := c.fetchConfig(m.Config)
+	if err != nil {
+		return err
+	}
+
+	meta := overlay.Metadata{Source: ref.String(), Config: cfg, History: history}
+	for _, layer := range m.Layers {
+		meta.Layers = append(meta.Layers, layer.Digest)
+	}
+
+	err = overlay.ImportImage(name, meta, func(rootfs string) error {
+		for _, layer := range m.Layers {
+			fmt.Printf("%s: downloading %s\n", shortDigest(layer.Digest), formatSize(layer.Size))
+			if err := c.applyBlob(rootfs, layer); err != nil {
+				return fmt.Errorf("layer %s: %w", layer.Digest, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pulled %s as %s\n", ref, name)
+	return nil
+}
+
+// resolveManifest fetches image manifest, selecting one for current platform if
+// reference points to an index.
+func (c *client) resolveManifest() (*manifest, error) {
+	reference, digest := c.ref.manifestRef(), c.ref.Digest
+	for depth := 0; ; depth++ {
+		m, data, mediaType, err := c.fetchManifest(reference)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyManifestDigest(digest, data); err != nil {
+			return nil, err
+		}
+
+		switch {
+		case mediaType == mediaTypeOCIManifest, mediaType == mediaTypeDockerManifest:
+			return m, nil
+		case !isIndex(mediaType):
+			return nil, fmt.Errorf("unsupported manifest media type: %s", mediaType)
+		case depth == maxIndexDepth:
+			return nil, fmt.Errorf("image indexes nested too deeply")
+		}
+
+		d, err := selectManifest(m.Manifests)
+		if err != nil {
+			return nil, err
+		}
+		reference, digest = d.Digest, d.Digest
+	}
+}
+
+// fetchConfig downloads image config blob and returns runtime defaults and
+// layer history in it.
+func (c *client) fetchConfig(d descriptor) (overlay.ImageConfig, []overlay.History, error) {
+	body, err := c.fetchBlob(d.Digest)
+	if err != nil {
+		return overlay.ImageConfig{}, nil, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return overlay.ImageConfig{}, nil, fmt.Errorf("failed to download image config: %w", err)
+	}
+
+	return parseConfig(d, data)
+}
+
+// parseConfig checks image config blob against its descriptor and returns
+// runtime defaults and layer history in it.
+func parseConfig(d descriptor, data []byte) (overlay.ImageConfig, []overlay.History, error) {
+	if digest := digestOf(data); digest != d.Digest {
+		return overlay.ImageConfig{}, nil, fmt.Errorf("image config digest mismatch: got %s", digest)
+	}
+
+	var cfg struct {
+		Config  runtimeConfig `json:"config"`
+		History []struct {
+			Created   time.Time `json:"created"`
+			CreatedBy string    `json:"created_by"`
+			Comment   string    `json:"comment"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return overlay.ImageConfig{}, nil, fmt.Errorf("failed to parse image config: %w", err)
+	}
+
+	// Layers are flattened on import, so entries carry no digest of their own
+	var history []overlay.History
+	for _, h := range cfg.History {
+		history = append(history, overlay.History{
+			Created:   h.Created,
+			CreatedBy: h.CreatedBy,
+			Comment:   h.Comment,
+		})
+	}
+
+	return overlay.ImageConfig{
+		Env:        cfg.Config.Env,
+		Entrypoint: cfg.Config.Entrypoint,
+		Cmd:        cfg.Config.Cmd,
+		WorkingDir: cfg.Config.WorkingDir,
+	}, history, nil
+}
+
+// applyBlob downloads layer and applies it to rootfs, verifying its digest.
+func (c *client) applyBlob(rootfs string, layer descriptor) error {
+	if !strings.HasPrefix(layer.Digest, "sha256:") {
+		return fmt.Errorf("unsupported digest algorithm")
+	}
+
+	body, err := c.fetchBlob(layer.Digest)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return applyVerified(rootfs, body, layer)
+}
+
+// applyVerified applies layer read from r to rootfs, checking r against digest
+// of layer.
+func applyVerified(rootfs string, r io.Reader, layer descriptor) error {
+	h := sha256.New()
+	if err := applyLayer(rootfs, io.TeeReader(r, h), layer.MediaType); err != nil {
+		return err
+	}
+
+	// Tar reader may stop before end of blob, hash all of it
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("failed to read layer: %w", err)
+	}
+
+	if digest := "sha256:" + hex.EncodeToString(h.Sum(nil)); digest != layer.Digest {
+		return fmt.Errorf("digest mismatch: got %s", digest)
+	}
+
+	return nil
+}
+
+// verifyManifestDigest checks manifest content matches expected digest, if any.
+func verifyManifestDigest(expected string, data []byte) error {
+	if expected == "" {
+		return nil
+	}
+
+	if digest := digestOf(data); digest != expected {
+		return fmt.Errorf("manifest digest mismatch: expected %s, got %s", expected, digest)
+	}
+
+	return nil
+}
+
+// shortDigest returns first 12 hex characters of a digest.
+func shortDigest(digest string) string {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return hex
+}
+
+// formatSize renders a byte count in MB.
+func formatSize(n int64) string {
+	return fmt.Sprintf("%.2f MB", float64(n)/1024/1024)
+}
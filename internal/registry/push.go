@@ -0,0 +1,274 @@
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+const (
+	mediaTypeOCIConfig = "application/vnd.oci.image.config.v1+json"
+
+	// uploadChunkSize is size of each PATCH request of a blob upload.
+	uploadChunkSize = 8 << 20
+)
+
+// imageConfig is minimal OCI image configuration of a single layer image.
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	Config runtimeConfig `json:"config"`
+}
+
+// runtimeConfig holds default runtime settings in an OCI image configuration.
+type runtimeConfig struct {
+	Env        []string `json:"Env,omitempty"`
+	Entrypoint []string `json:"Entrypoint,omitempty"`
+	Cmd        []string `json:"Cmd,omitempty"`
+	WorkingDir string   `json:"WorkingDir,omitempty"`
+}
+
+// newImageConfig returns OCI image configuration of a single layer image with
+// uncompressed digest diffID and given runtime defaults.
+func newImageConfig(diffID string, cfg overlay.ImageConfig) ([]byte, error) {
+	var c imageConfig
+	c.Architecture, c.OS = runtime.GOARCH, "linux"
+	c.RootFS.Type, c.RootFS.DiffIDs = "layers", []string{diffID}
+	c.Config = runtimeConfig{
+		Env:        cfg.Env,
+		Entrypoint: cfg.Entrypoint,
+		Cmd:        cfg.Cmd,
+		WorkingDir: cfg.WorkingDir,
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal image config: %w", err)
+	}
+	return data, nil
+}
+
+// Push uploads local image with given name to reference, or image named after
+// last component of its repository and its tag if name is empty.
+//
+// Image tarball is uploaded as a single layer, along with a config and an OCI
+// manifest put under reference's tag. Blobs already in registry are skipped.
+// Only anonymous pushes are supported, as used by local registries.
+func Push(reference, name string) error {
+	ref, err := ParseReference(reference)
+	if err != nil {
+		return err
+	}
+	if ref.Digest != "" {
+		return fmt.Errorf("cannot push to a digest reference, use a tag")
+	}
+	if name == "" {
+		name = ref.LocalName()
+	}
+
+	// Layers of stacked images are in overlay format, not the one registries
+	// use, so they are pushed flattened
+	tarball, cleanup, err := overlay.FlatTarball(name)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	c := newClient(ref)
+
+	fmt.Printf("Pushing %s to %s\n", name, ref)
+
+	layer, diffID, err := describeLayer(tarball)
+	if err != nil {
+		return err
+	}
+
+	// Runtime defaults go along, so pulling image back runs it as before
+	var cfg overlay.ImageConfig
+	meta, err := overlay.ImageMetadata(name)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		cfg = meta.Config
+	}
+	cfgData, err := newImageConfig(diffID, cfg)
+	if err != nil {
+		return err
+	}
+	config := descriptor{MediaType: mediaTypeOCIConfig, Digest: digestOf(cfgData), Size: int64(len(cfgData))}
+
+	f, err := os.Open(tarball)
+	if err != nil {
+		return fmt.Errorf("failed to open image tarball: %w", err)
+	}
+	defer f.Close()
+
+	fmt.Printf("%s: uploading %s\n", shortDigest(layer.Digest), formatSize(layer.Size))
+	if err := c.pushBlob(layer, f); err != nil {
+		return fmt.Errorf("layer %s: %w", layer.Digest, err)
+	}
+	if err := c.pushBlob(config, bytes.NewReader(cfgData)); err != nil {
+		return fmt.Errorf("config %s: %w", config.Digest, err)
+	}
+
+	m := manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config:        config,
+		Layers:        []descriptor{layer},
+	}
+	digest, err := c.putManifest(ref.Tag, &m)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pushed %s as %s@%s\n", name, ref, digest)
+	return nil
+}
+
+// describeLayer returns descriptor of a gzipped tarball as a layer, along with
+// digest of its uncompressed content.
+func describeLayer(tarball string) (descriptor, string, error) {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return descriptor{}, "", fmt.Errorf("failed to open image tarball: %w", err)
+	}
+	defer f.Close()
+
+	compressed := sha256.New()
+	counter := &countingWriter{}
+	zr, err := gzip.NewReader(io.TeeReader(f, io.MultiWriter(compressed, counter)))
+	if err != nil {
+		return descriptor{}, "", fmt.Errorf("failed to read image tarball: %w", err)
+	}
+
+	uncompressed := sha256.New()
+	if _, err := io.Copy(uncompressed, zr); err != nil {
+		return descriptor{}, "", fmt.Errorf("failed to read image tarball: %w", err)
+	}
+
+	// Gzip reader may stop before end of file, hash all of it
+	if _, err := io.Copy(io.MultiWriter(compressed, counter), f); err != nil {
+		return descriptor{}, "", fmt.Errorf("failed to read image tarball: %w", err)
+	}
+
+	layer := descriptor{
+		MediaType: mediaTypeOCILayerGzip,
+		Digest:    "sha256:" + hex.EncodeToString(compressed.Sum(nil)),
+		Size:      counter.n,
+	}
+	return layer, "sha256:" + hex.EncodeToString(uncompressed.Sum(nil)), nil
+}
+
+// pushBlob uploads blob read from r in chunks, unless registry already has it.
+func (c *client) pushBlob(blob descriptor, r io.Reader) error {
+	resp, err := c.do(http.MethodHead, c.url("/blobs/"+blob.Digest), nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return nil
+	}
+	if err != errNotFound {
+		return err
+	}
+
+	resp, err = c.do(http.MethodPost, c.url("/blobs/uploads/"), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+	resp.Body.Close()
+
+	buf := make([]byte, uploadChunkSize)
+	var offset int64
+	for {
+		location, err := c.resolve(resp.Header.Get("Location"))
+		if err != nil {
+			return err
+		}
+
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			return c.finishUpload(location, blob.Digest)
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("failed to read blob: %w", err)
+		}
+
+		resp, err = c.do(http.MethodPatch, location, http.Header{
+			"Content-Type":  {"application/octet-stream"},
+			"Content-Range": {fmt.Sprintf("%d-%d", offset, offset+int64(n)-1)},
+		}, buf[:n])
+		if err != nil {
+			return fmt.Errorf("failed to upload chunk: %w", err)
+		}
+		resp.Body.Close()
+		offset += int64(n)
+	}
+}
+
+// finishUpload completes upload at given location, committing it as digest.
+func (c *client) finishUpload(location, digest string) error {
+	u, err := url.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid upload location %q: %w", location, err)
+	}
+	query := u.Query()
+	query.Set("digest", digest)
+	u.RawQuery = query.Encode()
+
+	resp, err := c.do(http.MethodPut, u.String(), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// putManifest uploads manifest under given tag, returning its digest.
+func (c *client) putManifest(tag string, m *manifest) (string, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	resp, err := c.do(http.MethodPut, c.url("/manifests/"+tag), http.Header{
+		"Content-Type": {m.MediaType},
+	}, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload manifest: %w", err)
+	}
+	resp.Body.Close()
+
+	return digestOf(data), nil
+}
+
+// digestOf returns sha256 digest of data in "sha256:<hex>" form.
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// countingWriter counts bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
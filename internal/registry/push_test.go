@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lutaod/tinydock/internal/overlay"
+)
+
+func TestImageConfigRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  overlay.ImageConfig
+	}{
+		{
+			name: "empty",
+			cfg:  overlay.ImageConfig{},
+		},
+		{
+			name: "command only",
+			cfg:  overlay.ImageConfig{Cmd: []string{"/bin/sh"}},
+		},
+		{
+			name: "all settings",
+			cfg: overlay.ImageConfig{
+				Env:        []string{"PATH=/usr/bin:/bin", "MODE=prod"},
+				Entrypoint: []string{"/entrypoint.sh"},
+				Cmd:        []string{"serve", "--port", "8080"},
+				WorkingDir: "/app",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := newImageConfig("sha256:abc", tt.cfg)
+			if err != nil {
+				t.Fatalf("newImageConfig() unexpected error: %v", err)
+			}
+
+			got, _, err := parseConfig(descriptor{MediaType: mediaTypeOCIConfig, Digest: digestOf(data), Size: int64(len(data))}, data)
+			if err != nil {
+				t.Fatalf("parseConfig() unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.cfg) {
+				t.Errorf("parseConfig() = %+v, want %+v", got, tt.cfg)
+			}
+		})
+	}
+}
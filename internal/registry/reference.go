@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	dockerHub        = "docker.io"
+	dockerHubAPIHost = "registry-1.docker.io"
+	defaultTag       = "latest"
+)
+
+// Reference identifies an image in a registry, e.g. "alpine:3.20" or
+// "ghcr.io/owner/app@sha256:...".
+type Reference struct {
+	// Registry is host (and optional port) of registry, docker.io for Docker Hub.
+	Registry string
+
+	// Repository is path of image in registry, e.g. "library/alpine".
+	Repository string
+
+	// Tag is image tag, used when Digest is empty.
+	Tag string
+
+	// Digest pins image manifest by content, e.g. "sha256:...".
+	Digest string
+}
+
+// ParseReference parses an image reference in Docker's format.
+//
+// Registry defaults to Docker Hub, where single-component repositories live
+// under "library/". Tag defaults to "latest".
+func ParseReference(s string) (*Reference, error) {
+	ref := &Reference{Registry: dockerHub}
+
+	remainder := s
+	if name, digest, ok := strings.Cut(remainder, "@"); ok {
+		if !strings.HasPrefix(digest, "sha256:") {
+			return nil, fmt.Errorf("invalid reference %q: unsupported digest algorithm", s)
+		}
+		remainder, ref.Digest = name, digest
+	}
+
+	// Tag separator must come after last path component, as registry may have a port
+	if i := strings.LastIndex(remainder, ":"); i > strings.LastIndex(remainder, "/") {
+		remainder, ref.Tag = remainder[:i], remainder[i+1:]
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = defaultTag
+	}
+
+	// First component is a registry if it looks like a host name
+	if first, rest, ok := strings.Cut(remainder, "/"); ok &&
+		(strings.ContainsAny(first, ".:") || first == "localhost") {
+		ref.Registry, remainder = first, rest
+	}
+
+	if remainder == "" || strings.ToLower(remainder) != remainder {
+		return nil, fmt.Errorf("invalid reference %q: repository must be non-empty and lowercase", s)
+	}
+
+	if ref.Registry == dockerHub && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+	ref.Repository = remainder
+
+	return ref, nil
+}
+
+// Name returns default local image name for reference, i.e. last path
+// component of repository.
+func (r *Reference) Name() string {
+	return path.Base(r.Repository)
+}
+
+// LocalName returns default local image reference for reference, i.e. its Name
+// along with its tag, if any.
+func (r *Reference) LocalName() string {
+	if r.Tag == "" {
+		return r.Name()
+	}
+	return r.Name() + ":" + r.Tag
+}
+
+// String returns reference in canonical form.
+func (r *Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// apiHost returns host serving registry API.
+func (r *Reference) apiHost() string {
+	if r.Registry == dockerHub {
+		return dockerHubAPIHost
+	}
+	return r.Registry
+}
+
+// scheme returns URL scheme of registry API, plain HTTP for local registries.
+func (r *Reference) scheme() string {
+	host := r.Registry
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	if host == "localhost" || host == "127.0.0.1" {
+		return "http"
+	}
+	return "https"
+}
+
+// manifestRef returns digest if pinned, otherwise tag.
+func (r *Reference) manifestRef() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
@@ -0,0 +1,124 @@
+package registry
+
+import "testing"
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		want      Reference
+		wantError bool
+	}{
+		{
+			name: "official image",
+			ref:  "alpine",
+			want: Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		},
+		{
+			name: "official image with tag",
+			ref:  "alpine:3.19",
+			want: Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "3.19"},
+		},
+		{
+			name: "namespaced image",
+			ref:  "user/app",
+			want: Reference{Registry: "docker.io", Repository: "user/app", Tag: "latest"},
+		},
+		{
+			name: "explicit default registry",
+			ref:  "docker.io/alpine",
+			want: Reference{Registry: "docker.io", Repository: "library/alpine", Tag: "latest"},
+		},
+		{
+			name: "other registry",
+			ref:  "ghcr.io/org/team/app:v1",
+			want: Reference{Registry: "ghcr.io", Repository: "org/team/app", Tag: "v1"},
+		},
+		{
+			name: "registry with port",
+			ref:  "localhost:5000/app",
+			want: Reference{Registry: "localhost:5000", Repository: "app", Tag: "latest"},
+		},
+		{
+			name: "localhost registry",
+			ref:  "localhost/app:dev",
+			want: Reference{Registry: "localhost", Repository: "app", Tag: "dev"},
+		},
+		{
+			name: "tag looking like port",
+			ref:  "registry:5000",
+			want: Reference{Registry: "docker.io", Repository: "library/registry", Tag: "5000"},
+		},
+		{
+			name: "digest",
+			ref:  "alpine@sha256:abc",
+			want: Reference{Registry: "docker.io", Repository: "library/alpine", Digest: "sha256:abc"},
+		},
+		{
+			name: "tag and digest",
+			ref:  "localhost:5000/app:v1@sha256:abc",
+			want: Reference{Registry: "localhost:5000", Repository: "app", Tag: "v1", Digest: "sha256:abc"},
+		},
+		{
+			name:      "unsupported digest algorithm",
+			ref:       "alpine@sha512:abc",
+			wantError: true,
+		},
+		{
+			name:      "upper case repository",
+			ref:       "Alpine",
+			wantError: true,
+		},
+		{
+			name:      "registry only",
+			ref:       "ghcr.io/",
+			wantError: true,
+		},
+		{
+			name:      "empty",
+			ref:       "",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReference(tt.ref)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("ParseReference(%q) = %+v, expected error", tt.ref, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseReference(%q) unexpected error: %v", tt.ref, err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseReference(%q) = %+v, want %+v", tt.ref, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReferenceLocalName(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "alpine", want: "alpine:latest"},
+		{ref: "ghcr.io/org/app:v1", want: "app:v1"},
+		{ref: "alpine@sha256:abc", want: "alpine"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			ref, err := ParseReference(tt.ref)
+			if err != nil {
+				t.Fatalf("ParseReference(%q) unexpected error: %v", tt.ref, err)
+			}
+			if got := ref.LocalName(); got != tt.want {
+				t.Errorf("LocalName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Copy copies src on host to name in dir, a directory resolved in a root
+// filesystem, entry by entry as an image layer is extracted, keeping ownership,
+// permissions, symlinks and hard links. Name "." copies contents of directory
+// src into dir itself.
+//
+// Files of root are never written through: a symlink in place of a copied file
+// or directory is replaced, and a symlink in a parent of one fails the copy.
+func Copy(src, dir, name string) error {
+	type dirTime struct {
+		path  string
+		mtime time.Time
+	}
+	var dirs []dirTime
+
+	// First entry copied for each inode linked more than once
+	links := map[[2]uint64]string{}
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		entry := filepath.Join(name, rel)
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = entry
+
+		if st := fi.Sys().(*syscall.Stat_t); fi.Mode().IsRegular() && st.Nlink > 1 {
+			key := [2]uint64{uint64(st.Dev), st.Ino}
+			if first, ok := links[key]; ok {
+				hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeLink, first, 0
+			} else {
+				links[key] = entry
+			}
+		}
+
+		target, err := SecurePath(dir, entry)
+		if err != nil {
+			return err
+		}
+		if existing, err := os.Lstat(target); err == nil && existing.Mode()&fs.ModeSymlink == 0 && existing.IsDir() != fi.IsDir() {
+			if fi.IsDir() {
+				return fmt.Errorf("cannot overwrite non-directory %s with directory", entry)
+			}
+			return fmt.Errorf("cannot overwrite directory %s with non-directory", entry)
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			err = Entry(dir, target, hdr, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		} else if err := Entry(dir, target, hdr, nil); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeDir {
+			dirs = append(dirs, dirTime{target, hdr.ModTime})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+
+	// Directory times change as entries are created in them, restore them last
+	for _, d := range dirs {
+		os.Chtimes(d.path, d.mtime, d.mtime)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package untar creates files described by tar archive entries, as done by
+// image extraction and layer application alike.
+package untar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// xattrPrefix prefixes PAX records holding extended attributes of an entry.
+const xattrPrefix = "SCHILY.xattr."
+
+// Entry creates file described by hdr at path, which must have been resolved
+// under root with SecurePath.
+func Entry(root, path string, hdr *tar.Header, r io.Reader) error {
+	// Entries of upper layers replace those of lower ones, except directories
+	// which are merged
+	if fi, err := os.Lstat(path); err == nil && !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(hdr.Mode).Perm()
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(path, mode); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg:
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(hdr.Linkname, path); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		target, err := SecurePath(root, hdr.Linkname)
+		if err != nil {
+			return err
+		}
+		// Hard link shares inode of its target, which already has its metadata
+		return os.Link(target, path)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		devMode := uint32(syscall.S_IFIFO)
+		if hdr.Typeflag == tar.TypeChar {
+			devMode = syscall.S_IFCHR
+		} else if hdr.Typeflag == tar.TypeBlock {
+			devMode = syscall.S_IFBLK
+		}
+		dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+		if err := unix.Mknod(path, devMode|uint32(mode), int(dev)); err != nil {
+			return err
+		}
+	default:
+		// Other entries, e.g. PAX global headers, carry no file
+		return nil
+	}
+
+	if err := os.Lchown(path, hdr.Uid, hdr.Gid); err != nil {
+		return err
+	}
+
+	// Attributes are set after chown, which clears file capabilities
+	for key, value := range hdr.PAXRecords {
+		if name, ok := strings.CutPrefix(key, xattrPrefix); ok {
+			if err := unix.Lsetxattr(path, name, []byte(value), 0); err != nil {
+				return fmt.Errorf("failed to set xattr %s: %w", name, err)
+			}
+		}
+	}
+
+	if hdr.Typeflag == tar.TypeSymlink {
+		return nil
+	}
+
+	// chown clears setuid and setgid bits, so mode is applied after it
+	if err := os.Chmod(path, mode|specialBits(hdr.Mode)); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, hdr.ModTime, hdr.ModTime)
+}
+
+// specialBits converts setuid, setgid and sticky bits of a tar mode to os.FileMode.
+func specialBits(mode int64) os.FileMode {
+	var m os.FileMode
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
+
+// SecurePath resolves tarball entry name under root, rejecting names that
+// would escape root either directly or through a symlink of a parent directory.
+func SecurePath(root, name string) (string, error) {
+	clean := filepath.Clean("/" + name)
+	if clean == "/" {
+		return root, nil
+	}
+
+	path := root
+	parts := strings.Split(strings.TrimPrefix(clean, "/"), "/")
+	for i, part := range parts {
+		path = filepath.Join(path, part)
+		if i == len(parts)-1 {
+			break
+		}
+
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to extract %s through symlink %s", name, path)
+		}
+	}
+
+	return path, nil
+}
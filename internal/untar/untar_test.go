@@ -0,0 +1,90 @@
+package untar
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecurePath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for name, target := range map[string]string{"link": "/etc", "rel": "dir"} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Fatalf("Failed to create symlink %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		entry     string
+		want      string
+		wantError bool
+	}{
+		{
+			name:  "plain entry",
+			entry: "dir/file",
+			want:  "dir/file",
+		},
+		{
+			name:  "leading dot",
+			entry: "./dir/file",
+			want:  "dir/file",
+		},
+		{
+			name:  "absolute entry",
+			entry: "/dir/file",
+			want:  "dir/file",
+		},
+		{
+			name:  "dot dot above root",
+			entry: "../../etc/passwd",
+			want:  "etc/passwd",
+		},
+		{
+			name:  "dot dot within root",
+			entry: "dir/../file",
+			want:  "file",
+		},
+		{
+			name:  "root itself",
+			entry: "./",
+			want:  "",
+		},
+		{
+			name:  "symlink as last component",
+			entry: "link",
+			want:  "link",
+		},
+		{
+			name:      "through absolute symlink",
+			entry:     "link/passwd",
+			wantError: true,
+		},
+		{
+			name:      "through relative symlink",
+			entry:     "rel/file",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SecurePath(root, tt.entry)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("SecurePath(%q) = %s, expected error", tt.entry, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SecurePath(%q) unexpected error: %v", tt.entry, err)
+			}
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("SecurePath(%q) = %s, want %s", tt.entry, got, want)
+			}
+		})
+	}
+}
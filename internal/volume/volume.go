@@ -1,7 +1,9 @@
 package volume
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 )
 
@@ -18,15 +20,82 @@ func (v *Volumes) String() string {
 	return fmt.Sprintf("%v", *v)
 }
 
+// Set parses a SOURCE:TARGET volume. A relative source is taken relative to
+// working directory, target must be an absolute path in container other than "/"
+// and not be target of another volume.
 func (v *Volumes) Set(value string) error {
+	vol, err := Parse(value)
+	if err != nil {
+		return err
+	}
+	return v.Add(vol)
+}
+
+// Add appends vol, failing if its target is already target of another volume.
+func (v *Volumes) Add(vol Volume) error {
+	for _, existing := range *v {
+		if existing.Target == vol.Target {
+			return fmt.Errorf("volume target %s is already mounted from %s", vol.Target, existing.Source)
+		}
+	}
+
+	*v = append(*v, vol)
+	return nil
+}
+
+// Parse parses a SOURCE:TARGET volume as Set does, without checking it against
+// other volumes.
+func Parse(value string) (Volume, error) {
 	parts := strings.Split(value, ":")
 	if len(parts) != 2 {
-		return fmt.Errorf("expect /host:/container")
+		return Volume{}, fmt.Errorf("expect SOURCE:TARGET, got %d colon-separated fields", len(parts))
+	}
+	if parts[0] == "" {
+		return Volume{}, fmt.Errorf("volume source is empty")
+	}
+	if parts[1] == "" {
+		return Volume{}, fmt.Errorf("volume target is empty")
+	}
+
+	source, err := filepath.Abs(parts[0])
+	if err != nil {
+		return Volume{}, fmt.Errorf("failed to resolve volume source %s: %w", parts[0], err)
 	}
 
-	*v = append(*v, Volume{
-		Source: parts[0],
-		Target: parts[1],
-	})
+	if !filepath.IsAbs(parts[1]) {
+		return Volume{}, fmt.Errorf("volume target %s must be an absolute path", parts[1])
+	}
+	target := filepath.Clean(parts[1])
+	if target == "/" {
+		return Volume{}, fmt.Errorf("volume target cannot be /")
+	}
+
+	return Volume{Source: source, Target: target}, nil
+}
+
+// Flag collects volumes given with a repeated flag, implementing flag.Value.
+//
+// Unlike Volumes, it keeps going past invalid values, so all of them are
+// reported at once by Err along with their position among values of flag.
+type Flag struct {
+	Volumes Volumes
+	errs    []error
+	n       int
+}
+
+func (f *Flag) String() string {
+	return f.Volumes.String()
+}
+
+func (f *Flag) Set(value string) error {
+	f.n++
+	if err := f.Volumes.Set(value); err != nil {
+		f.errs = append(f.errs, fmt.Errorf("volume #%d %q: %w", f.n, value, err))
+	}
 	return nil
 }
+
+// Err returns errors of all invalid values, or nil if there are none.
+func (f *Flag) Err() error {
+	return errors.Join(f.errs...)
+}
@@ -0,0 +1,168 @@
+package volume
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		value     string
+		want      Volume
+		wantError bool
+	}{
+		{
+			name:  "absolute source",
+			value: "/data:/data",
+			want:  Volume{Source: "/data", Target: "/data"},
+		},
+		{
+			name:  "relative source",
+			value: "data:/data",
+			want:  Volume{Source: filepath.Join(wd, "data"), Target: "/data"},
+		},
+		{
+			name:  "dot source",
+			value: ".:/src",
+			want:  Volume{Source: wd, Target: "/src"},
+		},
+		{
+			name:  "unclean target",
+			value: "/data:/var//lib/../data/",
+			want:  Volume{Source: "/data", Target: "/var/data"},
+		},
+		{
+			name:      "relative target",
+			value:     "/data:data",
+			wantError: true,
+		},
+		{
+			name:      "root target",
+			value:     "/data:/",
+			wantError: true,
+		},
+		{
+			name:      "target cleaned to root",
+			value:     "/data:/tmp/..",
+			wantError: true,
+		},
+		{
+			name:      "read-only option",
+			value:     "/data:/data:ro",
+			wantError: true,
+		},
+		{
+			name:      "missing target",
+			value:     "/data",
+			wantError: true,
+		},
+		{
+			name:      "empty source",
+			value:     ":/data",
+			wantError: true,
+		},
+		{
+			name:      "empty target",
+			value:     "/data:",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Parse(%q) = %v, expected error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.value, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlag(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   []string
+		want     Volumes
+		wantErrs []string
+	}{
+		{
+			name:   "distinct targets",
+			values: []string{"/a:/a", "/b:/b"},
+			want:   Volumes{{Source: "/a", Target: "/a"}, {Source: "/b", Target: "/b"}},
+		},
+		{
+			name:     "duplicate target",
+			values:   []string{"/a:/data", "/b:/data/"},
+			want:     Volumes{{Source: "/a", Target: "/data"}},
+			wantErrs: []string{`volume #2 "/b:/data/"`},
+		},
+		{
+			name:   "duplicate source",
+			values: []string{"/a:/x", "/a:/y"},
+			want:   Volumes{{Source: "/a", Target: "/x"}, {Source: "/a", Target: "/y"}},
+		},
+		{
+			name:     "every invalid value reported",
+			values:   []string{"/a:a", "/b:/b", "/c:/c:ro"},
+			want:     Volumes{{Source: "/b", Target: "/b"}},
+			wantErrs: []string{`volume #1 "/a:a"`, `volume #3 "/c:/c:ro"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f Flag
+			for _, value := range tt.values {
+				if err := f.Set(value); err != nil {
+					t.Fatalf("Set(%q) returned error: %v", value, err)
+				}
+			}
+
+			if len(f.Volumes) != len(tt.want) {
+				t.Fatalf("Volumes = %v, want %v", f.Volumes, tt.want)
+			}
+			for i := range tt.want {
+				if f.Volumes[i] != tt.want[i] {
+					t.Errorf("Volumes[%d] = %v, want %v", i, f.Volumes[i], tt.want[i])
+				}
+			}
+
+			err := f.Err()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("Err() unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Err() = nil, expected error")
+			}
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != len(tt.wantErrs) {
+				t.Fatalf("Err() = %q, want %d errors", err, len(tt.wantErrs))
+			}
+			for i, want := range tt.wantErrs {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("Err() error %d = %q, want prefix %q", i, lines[i], want)
+				}
+			}
+		})
+	}
+}
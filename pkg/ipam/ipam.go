@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 )
 
@@ -22,12 +23,9 @@ type Prefix struct {
 	AllocatedIPs []string `json:"allocated_ips"`
 }
 
-// New creates a new IPAM instance with the given state file path.
+// New creates a new IPAM instance with the given state file path. Directory of
+// state file is created on first save.
 func New(statePath string) (*IPAM, error) {
-	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
-	}
-
 	ipam := &IPAM{
 		statePath: statePath,
 		Prefixes:  make(map[string]*Prefix),
@@ -58,6 +56,10 @@ func (i *IPAM) saveState() error {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
+	if err := os.MkdirAll(filepath.Dir(i.statePath), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
 	if err := os.WriteFile(i.statePath, data, 0644); err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
@@ -89,6 +91,49 @@ func (i *IPAM) CreatePrefix(cidr string) error {
 	return i.saveState()
 }
 
+// HasPrefix reports whether the given prefix exists.
+func (i *IPAM) HasPrefix(prefix *net.IPNet) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	_, exists := i.Prefixes[prefix.String()]
+	return exists
+}
+
+// ReserveIP allocates the given IP from the prefix containing it.
+//
+// Unlike RequestIP, the IP is chosen by caller. Reserving an IP that is already
+// allocated succeeds, so state left behind by an interrupted run can be adopted.
+func (i *IPAM) ReserveIP(ip *net.IPNet) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	cidr := (&net.IPNet{IP: ip.IP.Mask(ip.Mask), Mask: ip.Mask}).String()
+	p, exists := i.Prefixes[cidr]
+	if !exists {
+		return fmt.Errorf("prefix %s not found", cidr)
+	}
+
+	ipStr := ip.IP.String()
+	if contains(p.AllocatedIPs, ipStr) {
+		return nil
+	}
+
+	n := ipToUint32(ip.IP)
+	network := ipToUint32(ip.IP.Mask(ip.Mask))
+	if n == network || n == network|^ipToUint32(net.IP(ip.Mask)) {
+		return fmt.Errorf("cannot reserve network or broadcast address %s", ipStr)
+	}
+
+	p.AllocatedIPs = append(p.AllocatedIPs, ipStr)
+	if err := i.saveState(); err != nil {
+		p.AllocatedIPs = p.AllocatedIPs[:len(p.AllocatedIPs)-1]
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+
+	return nil
+}
+
 // RequestIP requests an available IP from the given prefix.
 func (i *IPAM) RequestIP(prefix *net.IPNet) (*net.IPNet, error) {
 	i.mu.Lock()
@@ -188,6 +233,85 @@ func (i *IPAM) ReleasePrefix(prefix *net.IPNet) error {
 	return i.saveState()
 }
 
+// Usage summarizes address usage of a prefix.
+type Usage struct {
+	CIDR string
+	// Total counts allocatable addresses, excluding network and broadcast ones.
+	Total uint64
+	Used  uint64
+}
+
+// Free returns number of addresses still available for allocation.
+func (u Usage) Free() uint64 {
+	if u.Used > u.Total {
+		return 0
+	}
+	return u.Total - u.Used
+}
+
+// Utilization returns percentage of allocatable addresses in use.
+func (u Usage) Utilization() float64 {
+	if u.Total == 0 {
+		return 0
+	}
+	return float64(u.Used) / float64(u.Total) * 100
+}
+
+// Usage returns address usage of the given prefix.
+func (i *IPAM) Usage(prefix *net.IPNet) (Usage, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	cidr := prefix.String()
+	p, exists := i.Prefixes[cidr]
+	if !exists {
+		return Usage{}, fmt.Errorf("prefix %s not found", cidr)
+	}
+
+	return p.usage()
+}
+
+// Usages returns address usage of all prefixes, ordered by CIDR.
+func (i *IPAM) Usages() ([]Usage, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	usages := make([]Usage, 0, len(i.Prefixes))
+	for _, p := range i.Prefixes {
+		u, err := p.usage()
+		if err != nil {
+			return nil, err
+		}
+		usages = append(usages, u)
+	}
+
+	sort.Slice(usages, func(a, b int) bool {
+		return usages[a].CIDR < usages[b].CIDR
+	})
+
+	return usages, nil
+}
+
+func (p *Prefix) usage() (Usage, error) {
+	_, prefix, err := net.ParseCIDR(p.CIDR)
+	if err != nil {
+		return Usage{}, fmt.Errorf("invalid CIDR %s: %w", p.CIDR, err)
+	}
+
+	// Prefixes of fewer than 4 addresses leave none between network and broadcast
+	ones, bits := prefix.Mask.Size()
+	var total uint64
+	if bits-ones >= 2 {
+		total = 1<<(bits-ones) - 2
+	}
+
+	return Usage{
+		CIDR:  p.CIDR,
+		Total: total,
+		Used:  uint64(len(p.AllocatedIPs)),
+	}, nil
+}
+
 func prefixesOverlap(a, b *net.IPNet) bool {
 	return a.Contains(b.IP) || b.Contains(a.IP)
 }
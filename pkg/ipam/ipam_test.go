@@ -431,3 +431,223 @@ func TestReleasePrefix(t *testing.T) {
 		})
 	}
 }
+
+func TestReserveIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		ip        string
+		reserve   int // number of times to reserve the IP
+		wantError bool
+		errorMsg  string // expected error message substring
+	}{
+		{
+			name:    "reserve free IP",
+			ip:      "192.168.1.1/24",
+			reserve: 1,
+		},
+		{
+			name:    "reserve allocated IP again",
+			ip:      "192.168.1.1/24",
+			reserve: 2,
+		},
+		{
+			name:      "reserve from non-existent prefix",
+			ip:        "192.168.2.1/24",
+			reserve:   1,
+			wantError: true,
+			errorMsg:  "not found",
+		},
+		{
+			name:      "reserve network address",
+			ip:        "192.168.1.0/24",
+			reserve:   1,
+			wantError: true,
+			errorMsg:  "network or broadcast",
+		},
+		{
+			name:      "reserve broadcast address",
+			ip:        "192.168.1.255/24",
+			reserve:   1,
+			wantError: true,
+			errorMsg:  "network or broadcast",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := New(filepath.Join(t.TempDir(), "test.json"))
+			if err != nil {
+				t.Fatalf("Failed to create IPAM: %v", err)
+			}
+
+			if err := ipam.CreatePrefix("192.168.1.0/24"); err != nil {
+				t.Fatalf("Failed to create prefix: %v", err)
+			}
+
+			ip, ipNet, err := net.ParseCIDR(tt.ip)
+			if err != nil {
+				t.Fatalf("Failed to parse CIDR %s: %v", tt.ip, err)
+			}
+			reserved := &net.IPNet{IP: ip, Mask: ipNet.Mask}
+
+			for i := 0; i < tt.reserve; i++ {
+				err = ipam.ReserveIP(reserved)
+			}
+			if tt.wantError {
+				if err == nil {
+					t.Error("Expected error but got none")
+				} else if tt.errorMsg != "" && !strings.Contains(err.Error(), tt.errorMsg) {
+					t.Errorf("Expected error containing %q but got: %v", tt.errorMsg, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Reserved IP must not be handed out again
+			next, err := ipam.RequestIP(ipNet)
+			if err != nil {
+				t.Fatalf("Failed to request IP: %v", err)
+			}
+			if next.IP.Equal(ip) {
+				t.Errorf("Reserved IP %s was allocated again", ip)
+			}
+		})
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	ipam, err := New(filepath.Join(t.TempDir(), "test.json"))
+	if err != nil {
+		t.Fatalf("Failed to create IPAM: %v", err)
+	}
+
+	if err := ipam.CreatePrefix("192.168.1.0/24"); err != nil {
+		t.Fatalf("Failed to create prefix: %v", err)
+	}
+
+	if !ipam.HasPrefix(mustParseCIDR(t, "192.168.1.0/24")) {
+		t.Error("Expected existing prefix to be found")
+	}
+	if ipam.HasPrefix(mustParseCIDR(t, "192.168.1.0/25")) {
+		t.Error("Expected overlapping but different prefix not to be found")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		cidr      string
+		requests  int
+		wantTotal uint64
+		wantUsed  uint64
+		wantUtil  float64
+	}{
+		{
+			name:      "empty prefix",
+			cidr:      "10.0.0.0/24",
+			wantTotal: 254,
+		},
+		{
+			name:      "partially used prefix",
+			cidr:      "10.0.0.0/29",
+			requests:  3,
+			wantTotal: 6,
+			wantUsed:  3,
+			wantUtil:  50,
+		},
+		{
+			name:      "exhausted prefix",
+			cidr:      "10.0.0.0/30",
+			requests:  2,
+			wantTotal: 2,
+			wantUsed:  2,
+			wantUtil:  100,
+		},
+		{
+			name:      "single IP",
+			cidr:      "10.0.0.1/32",
+			wantTotal: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipam, err := New(filepath.Join(t.TempDir(), "test.json"))
+			if err != nil {
+				t.Fatalf("Failed to create IPAM: %v", err)
+			}
+
+			if err := ipam.CreatePrefix(tt.cidr); err != nil {
+				t.Fatalf("Failed to create prefix: %v", err)
+			}
+
+			prefix := mustParseCIDR(t, tt.cidr)
+			for i := 0; i < tt.requests; i++ {
+				if _, err := ipam.RequestIP(prefix); err != nil {
+					t.Fatalf("Failed to request IP: %v", err)
+				}
+			}
+
+			u, err := ipam.Usage(prefix)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if u.Total != tt.wantTotal || u.Used != tt.wantUsed {
+				t.Errorf("Expected %d/%d used, got %d/%d", tt.wantUsed, tt.wantTotal, u.Used, u.Total)
+			}
+			if u.Free() != tt.wantTotal-tt.wantUsed {
+				t.Errorf("Expected %d free, got %d", tt.wantTotal-tt.wantUsed, u.Free())
+			}
+			if u.Utilization() != tt.wantUtil {
+				t.Errorf("Expected %.1f%% utilization, got %.1f%%", tt.wantUtil, u.Utilization())
+			}
+		})
+	}
+}
+
+func TestUsageUnknownPrefix(t *testing.T) {
+	ipam, err := New(filepath.Join(t.TempDir(), "test.json"))
+	if err != nil {
+		t.Fatalf("Failed to create IPAM: %v", err)
+	}
+
+	if _, err := ipam.Usage(mustParseCIDR(t, "10.0.0.0/24")); err == nil {
+		t.Error("Expected error but got none")
+	}
+}
+
+func TestUsages(t *testing.T) {
+	ipam, err := New(filepath.Join(t.TempDir(), "test.json"))
+	if err != nil {
+		t.Fatalf("Failed to create IPAM: %v", err)
+	}
+
+	for _, cidr := range []string{"192.168.1.0/24", "10.0.0.0/16"} {
+		if err := ipam.CreatePrefix(cidr); err != nil {
+			t.Fatalf("Failed to create prefix: %v", err)
+		}
+	}
+
+	if _, err := ipam.RequestIP(mustParseCIDR(t, "10.0.0.0/16")); err != nil {
+		t.Fatalf("Failed to request IP: %v", err)
+	}
+
+	usages, err := ipam.Usages()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(usages) != 2 {
+		t.Fatalf("Expected 2 prefixes, got %d", len(usages))
+	}
+	if usages[0].CIDR != "10.0.0.0/16" || usages[1].CIDR != "192.168.1.0/24" {
+		t.Errorf("Expected prefixes ordered by CIDR, got %s, %s", usages[0].CIDR, usages[1].CIDR)
+	}
+	if usages[0].Used != 1 || usages[1].Used != 0 {
+		t.Errorf("Expected 1 and 0 used addresses, got %d and %d", usages[0].Used, usages[1].Used)
+	}
+}